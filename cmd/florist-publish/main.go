@@ -0,0 +1,117 @@
+// Command florist-publish creates the signed bundles fetched by the pull subcommand
+// of a provisioner. See package pull.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/marco-m/clim"
+
+	"github.com/marco-m/florist/pkg/pull"
+)
+
+func main() {
+	os.Exit(MainInt())
+}
+
+func MainInt() int {
+	err := mainErr(os.Args[1:])
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, clim.ErrHelp) {
+		fmt.Fprintln(os.Stdout, err)
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
+
+type Application struct {
+	GenKey   string
+	Key      string
+	Binary   string
+	Settings string
+	Out      string
+}
+
+func mainErr(args []string) error {
+	var app Application
+	cli, err := clim.NewTop("florist-publish",
+		"creates a signed bundle for the pull mode", app.run)
+	if err != nil {
+		return err
+	}
+
+	if err := cli.AddFlags(
+		&clim.Flag{
+			Value: clim.String(&app.GenKey, ""),
+			Long:  "gen-key", Label: "PATH",
+			Help: "Generate a key pair: PATH (private) and PATH.pub (public), then exit",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Key, ""),
+			Long:  "key", Label: "PATH", Help: "Private key to sign the bundle",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Binary, ""),
+			Long:  "binary", Label: "PATH", Help: "Provisioner binary",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Settings, ""),
+			Long:  "settings", Label: "PATH", Help: "Settings file (JSON)",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Out, ""),
+			Long:  "out", Label: "DIR", Help: "Output directory, to upload to the HTTP server",
+		},
+	); err != nil {
+		return err
+	}
+
+	action, err := cli.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	return action(0)
+}
+
+func (app *Application) run(uctx int) error {
+	if app.GenKey != "" {
+		pub, priv, err := pull.GenerateKey()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(app.GenKey, []byte(priv+"\n"), 0o600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(app.GenKey+".pub", []byte(pub+"\n"), 0o644); err != nil {
+			return err
+		}
+		fmt.Println("public key:", pub)
+		return nil
+	}
+
+	if app.Key == "" || app.Binary == "" || app.Settings == "" || app.Out == "" {
+		return fmt.Errorf("--key, --binary, --settings and --out are required")
+	}
+	buf, err := os.ReadFile(app.Key)
+	if err != nil {
+		return err
+	}
+	privateKey, err := pull.ParsePrivateKey(string(buf))
+	if err != nil {
+		return err
+	}
+	manifest, err := pull.Publish(app.Out, app.Binary, app.Settings, privateKey)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("published %s (sha256 %s) and %s (sha256 %s) to %s\n",
+		manifest.Provisioner.Name, manifest.Provisioner.SHA256,
+		manifest.Settings.Name, manifest.Settings.SHA256, app.Out)
+	return nil
+}
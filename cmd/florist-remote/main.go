@@ -0,0 +1,288 @@
+// Command florist-remote pushes a provisioner binary to one or more hosts over SSH
+// and runs install and/or configure there. See package remote.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marco-m/clim"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/marco-m/florist/pkg/remote"
+)
+
+func main() {
+	os.Exit(MainInt())
+}
+
+func MainInt() int {
+	err := mainErr(os.Args[1:])
+	if err == nil {
+		return 0
+	}
+	if errors.Is(err, clim.ErrHelp) {
+		fmt.Fprintln(os.Stdout, err)
+		return 0
+	}
+	fmt.Fprintln(os.Stderr, err)
+	return 1
+}
+
+type Application struct {
+	Hosts           string
+	User            string
+	Identity        string
+	KnownHosts      string
+	InsecureHostKey bool
+	Binary          string
+	Settings        string
+	Phases          string
+	NoSudo          bool
+	DialTimeout     time.Duration
+	Result          string
+	Inventory       string
+	BatchSize       string
+	MaxFailures     string
+	HealthPort      string
+	HealthCmd       string
+	HealthTimeout   time.Duration
+}
+
+func mainErr(args []string) error {
+	var app Application
+	cli, err := clim.NewTop("florist-remote",
+		"runs a florist provisioner on remote hosts over SSH", app.run)
+	if err != nil {
+		return err
+	}
+
+	home, _ := os.UserHomeDir()
+	if err := cli.AddFlags(
+		&clim.Flag{
+			Value: clim.String(&app.Hosts, ""),
+			Long:  "hosts", Label: "HOST[:PORT],...",
+			Help: "Hosts to provision (with --inventory: names of hosts or groups, default all)",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Binary, ""),
+			Long:  "binary", Label: "PATH", Help: "Provisioner binary (linux, static)",
+			Required: true,
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Settings, ""),
+			Long:  "settings", Label: "PATH", Help: "Settings file (JSON) for configure",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Phases, "install,configure"),
+			Long:  "phases", Label: "PHASE,...", Help: "Provisioner subcommands to run",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.User, os.Getenv("USER")),
+			Long:  "user", Help: "SSH user",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Identity, ""),
+			Long:  "identity", Label: "PATH",
+			Help: "SSH private key (default: use ssh-agent)",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.KnownHosts, filepath.Join(home, ".ssh/known_hosts")),
+			Long:  "known-hosts", Label: "PATH", Help: "SSH known_hosts file",
+		},
+		&clim.Flag{
+			Value: clim.Bool(&app.InsecureHostKey, false),
+			Long:  "insecure-ignore-host-key",
+			Help:  "Do not verify the host keys (only for throwaway VMs)",
+		},
+		&clim.Flag{
+			Value: clim.Bool(&app.NoSudo, false),
+			Long:  "no-sudo", Help: "Run the provisioner without sudo",
+		},
+		&clim.Flag{
+			Value: clim.Duration(&app.DialTimeout, 30*time.Second),
+			Long:  "dial-timeout", Label: "DURATION", Help: "SSH connection timeout",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Inventory, ""),
+			Long:  "inventory", Label: "PATH",
+			Help: "Inventory file (JSON); enables the rolling rollout",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.BatchSize, "1"),
+			Long:  "batch-size", Label: "N", Help: "Hosts per batch (with --inventory)",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.MaxFailures, "0"),
+			Long:  "max-failures", Label: "N",
+			Help: "Failed hosts tolerated before aborting (with --inventory)",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.HealthPort, ""),
+			Long:  "health-port", Label: "PORT",
+			Help: "Health gate: wait for this TCP port after each batch",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.HealthCmd, ""),
+			Long:  "health-cmd", Label: "COMMAND",
+			Help: "Health gate: run this command over SSH after each batch",
+		},
+		&clim.Flag{
+			Value: clim.Duration(&app.HealthTimeout, 5*time.Minute),
+			Long:  "health-timeout", Label: "DURATION", Help: "Health gate timeout per host",
+		},
+		&clim.Flag{
+			Value: clim.String(&app.Result, ""),
+			Long:  "result", Label: "PATH",
+			Help: "Write the result (JSON) to this file",
+		},
+	); err != nil {
+		return err
+	}
+
+	action, err := cli.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	return action(0)
+}
+
+func (app *Application) run(uctx int) error {
+	cfg := remote.Config{
+		Binary:      app.Binary,
+		Settings:    app.Settings,
+		Phases:      splitList(app.Phases),
+		User:        app.User,
+		DialTimeout: app.DialTimeout,
+		NoSudo:      app.NoSudo,
+		LogOutput:   os.Stdout,
+	}
+
+	auth, err := authMethod(app.Identity)
+	if err != nil {
+		return err
+	}
+	cfg.Auth = []ssh.AuthMethod{auth}
+
+	if app.InsecureHostKey {
+		cfg.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		cfg.HostKeyCallback, err = knownhosts.New(app.KnownHosts)
+		if err != nil {
+			return fmt.Errorf("known hosts: %s", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if app.Inventory != "" {
+		return app.rollout(ctx, cfg)
+	}
+	if app.Hosts == "" {
+		return fmt.Errorf("one of --hosts or --inventory is required")
+	}
+	results, err := remote.Run(ctx, cfg, splitList(app.Hosts))
+	if err != nil {
+		return err
+	}
+
+	if err := app.writeResult(results); err != nil {
+		return err
+	}
+	if failed := remote.Failed(results); len(failed) > 0 {
+		return fmt.Errorf("failed hosts (%d/%d): %s", len(failed), len(results),
+			strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (app *Application) rollout(ctx context.Context, cfg remote.Config) error {
+	inv, err := remote.LoadInventory(app.Inventory)
+	if err != nil {
+		return err
+	}
+	rcfg := remote.RolloutConfig{HealthTimeout: app.HealthTimeout}
+	if rcfg.BatchSize, err = strconv.Atoi(app.BatchSize); err != nil {
+		return fmt.Errorf("--batch-size: %s", err)
+	}
+	if rcfg.MaxFailures, err = strconv.Atoi(app.MaxFailures); err != nil {
+		return fmt.Errorf("--max-failures: %s", err)
+	}
+	switch {
+	case app.HealthPort != "" && app.HealthCmd != "":
+		return fmt.Errorf("--health-port and --health-cmd are mutually exclusive")
+	case app.HealthPort != "":
+		rcfg.HealthCheck = remote.ConnHealthCheck(app.HealthPort, 2*time.Second)
+	case app.HealthCmd != "":
+		rcfg.HealthCheck = remote.CommandHealthCheck(cfg, app.HealthCmd, 5*time.Second)
+	}
+
+	rr, err := remote.Rollout(ctx, cfg, rcfg, inv, splitList(app.Hosts)...)
+	if err != nil {
+		return err
+	}
+	if err := app.writeResult(rr); err != nil {
+		return err
+	}
+	return rr.Err()
+}
+
+// writeResult writes 'result' as JSON to the file of flag --result, if set.
+func (app *Application) writeResult(result any) error {
+	if app.Result == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(app.Result, append(buf, '\n'), 0o644)
+}
+
+// authMethod returns the SSH authentication method using the private key in file
+// 'identity' or, if empty, the ssh-agent.
+func authMethod(identity string) (ssh.AuthMethod, error) {
+	if identity != "" {
+		buf, err := os.ReadFile(identity)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(buf)
+		if err != nil {
+			return nil, fmt.Errorf("identity %s: %s", identity, err)
+		}
+		return ssh.PublicKeys(signer), nil
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, fmt.Errorf("no --identity and no ssh-agent (SSH_AUTH_SOCK not set)")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("ssh-agent: %s", err)
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, elem := range strings.Split(s, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			list = append(list, elem)
+		}
+	}
+	return list
+}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net"
 	"os"
 	"time"
 
 	"github.com/marco-m/clim"
+
+	"github.com/marco-m/florist/pkg/remote"
 )
 
 func main() {
@@ -78,22 +79,13 @@ func (app *Application) run(uctx int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), app.MaxWait)
 	defer cancel()
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			_, err := net.DialTimeout("tcp", app.Address, app.PollInterval)
-			if err != nil {
-				if app.Verbose {
-					fmt.Println(err)
-				}
-				break
-			}
-			elapsed := time.Since(now).Round(time.Second)
-			fmt.Println("connected to", app.Address, "after", elapsed)
-			return nil
-		}
-		time.Sleep(app.PollInterval)
+	if app.Verbose {
+		fmt.Println("waiting for", app.Address)
+	}
+	if err := remote.WaitForConn(ctx, app.Address, app.PollInterval); err != nil {
+		return err
 	}
+	elapsed := time.Since(now).Round(time.Second)
+	fmt.Println("connected to", app.Address, "after", elapsed)
+	return nil
 }
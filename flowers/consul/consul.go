@@ -4,12 +4,8 @@ package consul
 
 import (
 	"log/slog"
-	"net/http"
-	"net/url"
-	"os"
-	"path"
-	"time"
 
+	"github.com/marco-m/florist/flowers/hashicorp"
 	"github.com/marco-m/florist/pkg/florist"
 )
 
@@ -21,7 +17,10 @@ const (
 )
 
 // CommonInstall performs the install steps common to the client and the server.
-func CommonInstall(log *slog.Logger, version string, hash string) error {
+// If pgpKey (the ASCII-armored OpenPGP public key of HashiCorp) is not empty, the
+// download is verified with the signed SHA256SUMS of the release, otherwise with
+// hash.
+func CommonInstall(log *slog.Logger, version string, hash string, pgpKey string) error {
 	log.Info("Add system user", "user", Username)
 	if err := florist.UserAdd(Username, &florist.UserAddArgs{
 		System:  true,
@@ -30,40 +29,8 @@ func CommonInstall(log *slog.Logger, version string, hash string) error {
 		return err
 	}
 
-	if err := installConsulExe(log, version, hash); err != nil {
-		return err
-	}
-
-	log.Info("Create cfg dir", "dst", CfgDir)
-	if err := os.MkdirAll(CfgDir, 0o755); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func installConsulExe(log *slog.Logger, version string, hash string) error {
-	log.Info("Download Consul package")
-	uri, err := url.JoinPath("https://releases.hashicorp.com/consul",
-		version, "consul_"+version+"_linux_amd64.zip")
-	if err != nil {
-		return err
-	}
-	client := &http.Client{Timeout: 30 * time.Second}
-	zipPath, err := florist.NetFetch(client, uri, florist.SHA256, hash, florist.WorkDir)
-	if err != nil {
-		return err
-	}
-
-	extracted := path.Join(florist.WorkDir, "consul")
-	log.Info("Unzipping Consul package", "dst", extracted)
-	if err := florist.UnzipOne(zipPath, "consul", extracted); err != nil {
-		return err
-	}
-
-	exeDst := path.Join(BinDir, "consul")
-	log.Info("Install consul executable", "dst", exeDst)
-	if err := florist.CopyFile(extracted, exeDst, 0o755, "root"); err != nil {
+	if err := hashicorp.InstallExe(log, "consul", version, hash, pgpKey,
+		BinDir); err != nil {
 		return err
 	}
 
@@ -88,5 +55,15 @@ func installConsulExe(log *slog.Logger, version string, hash string) error {
 	// 	return err
 	// }
 
+	log.Info("Create cfg dir", "dst", CfgDir)
+	if err := florist.MkdirAll(CfgDir, 0o755); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// Artifact returns the Consul zip. See [CommonInstall] for hash and pgpKey.
+func Artifact(version string, hash string, pgpKey string) (florist.Artifact, error) {
+	return hashicorp.Artifact("consul", version, hash, pgpKey)
+}
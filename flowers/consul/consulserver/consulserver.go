@@ -13,6 +13,7 @@ import (
 
 	"github.com/marco-m/florist/flowers/consul"
 	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
 	"github.com/marco-m/florist/pkg/systemd"
 )
 
@@ -26,7 +27,10 @@ const (
 	UnitFile   = "embedded/consul-server.service"
 )
 
-var _ florist.Flower = (*Flower)(nil)
+var (
+	_ florist.Flower     = (*Flower)(nil)
+	_ florist.Artifacter = (*Flower)(nil)
+)
 
 // WARNING: Do NOT install alongside a Consul client.
 type Flower struct {
@@ -36,8 +40,16 @@ type Flower struct {
 
 type Inst struct {
 	Version string
-	Hash    string
-	Fsys    fs.FS
+	// SHA-256 of the Consul zip. Can be empty if PGPKey is set.
+	Hash string
+	// SHA-256 of the Consul zip per architecture ("amd64", "arm64"). If set, it
+	// replaces Hash.
+	Hashes map[string]string
+	// ASCII-armored OpenPGP public key of HashiCorp (see
+	// https://www.hashicorp.com/security). If set, the download is verified
+	// with the signed SHA256SUMS of the release instead of with Hash.
+	PGPKey string
+	Fsys   fs.FS
 }
 
 type Conf struct {
@@ -70,17 +82,34 @@ func (fl *Flower) Init() error {
 	if fl.Version == "" {
 		return fmt.Errorf("%s.init: %s", Name, "missing version")
 	}
-	if fl.Hash == "" {
-		return fmt.Errorf("%s.init: %s", Name, "missing hash")
+	if fl.Hash == "" && len(fl.Hashes) == 0 && fl.PGPKey == "" {
+		return fmt.Errorf("%s.init: %s", Name, "missing hash or PGP key")
 	}
 
 	return nil
 }
 
+// Artifacts returns the Consul zip.
+func (fl *Flower) Artifacts() ([]florist.Artifact, error) {
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return nil, err
+	}
+	artifact, err := consul.Artifact(fl.Version, hash, fl.PGPKey)
+	if err != nil {
+		return nil, err
+	}
+	return []florist.Artifact{artifact}, nil
+}
+
 func (fl *Flower) Install() error {
 	log := slog.With("flower", Name+".install")
 
-	if err := consul.CommonInstall(log, fl.Version, fl.Hash); err != nil {
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return fmt.Errorf("%s.install: %s", Name, err)
+	}
+	if err := consul.CommonInstall(log, fl.Version, hash, fl.PGPKey); err != nil {
 		return fmt.Errorf("%s.install: %s", Name, err)
 	}
 	return nil
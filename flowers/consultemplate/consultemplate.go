@@ -5,15 +5,14 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
-	"net/http"
-	"os"
 	"path"
 	"path/filepath"
-	"time"
 
 	"github.com/creasty/defaults"
 
+	"github.com/marco-m/florist/flowers/hashicorp"
 	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
 	"github.com/marco-m/florist/pkg/systemd"
 )
 
@@ -34,7 +33,10 @@ const (
 
 const Name = "consul-template"
 
-var _ florist.Flower = (*Flower)(nil)
+var (
+	_ florist.Flower     = (*Flower)(nil)
+	_ florist.Artifacter = (*Flower)(nil)
+)
 
 type Flower struct {
 	Inst
@@ -42,8 +44,16 @@ type Flower struct {
 }
 
 type Inst struct {
-	Version            string
-	Hash               string
+	Version string
+	// SHA-256 of the consul-template zip. Can be empty if PGPKey is set.
+	Hash string
+	// SHA-256 of the consul-template zip per architecture ("amd64", "arm64"). If
+	// set, it replaces Hash.
+	Hashes map[string]string
+	// ASCII-armored OpenPGP public key of HashiCorp (see
+	// https://www.hashicorp.com/security). If set, the download is verified with the
+	// signed SHA256SUMS of the release instead of with Hash.
+	PGPKey             string
 	ConfigurationFiles []string
 	TemplateFiles      []string
 	Fsys               fs.FS
@@ -73,12 +83,25 @@ func (fl *Flower) Init() error {
 	if fl.Version == "" {
 		return fmt.Errorf("%s: %s", Name, "Version cannot be empty")
 	}
-	if fl.Hash == "" {
-		return fmt.Errorf("%s: %s", Name, "Hash cannot be empty")
+	if fl.Hash == "" && len(fl.Hashes) == 0 && fl.PGPKey == "" {
+		return fmt.Errorf("%s: %s", Name, "Hash, Hashes and PGPKey cannot be all empty")
 	}
 	return nil
 }
 
+// Artifacts returns the consul-template zip.
+func (fl *Flower) Artifacts() ([]florist.Artifact, error) {
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return nil, err
+	}
+	artifact, err := hashicorp.Artifact(Name, fl.Version, hash, fl.PGPKey)
+	if err != nil {
+		return nil, err
+	}
+	return []florist.Artifact{artifact}, nil
+}
+
 func (fl *Flower) Install() error {
 	log := slog.With("flower", Name+".install")
 
@@ -91,12 +114,12 @@ func (fl *Flower) Install() error {
 	}
 
 	log.Info("Create consul-template configuration dir", "dir", ConfigDir)
-	if err := os.MkdirAll(ConfigDir, 0o755); err != nil {
+	if err := florist.MkdirAll(ConfigDir, 0o755); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 
 	log.Info("Create consul-template templates dir", "dir", TemplatesDir)
-	if err := os.MkdirAll(TemplatesDir, 0o755); err != nil {
+	if err := florist.MkdirAll(TemplatesDir, 0o755); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 
@@ -109,7 +132,12 @@ func (fl *Flower) Install() error {
 	// unit file instead of starting the service, starts a dedicated consul-template),
 	// so that we can avoid having it running as root!
 
-	if err := installExe(log, fl.Version, fl.Hash, "root"); err != nil {
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return fmt.Errorf("%s: %s", Name, err)
+	}
+	if err := hashicorp.InstallExe(log, Name, fl.Version, hash, fl.PGPKey,
+		BinDir); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 
@@ -150,34 +178,3 @@ func (fl *Flower) Install() error {
 func (fl *Flower) Configure() error {
 	return nil
 }
-
-func installExe(
-	log *slog.Logger,
-	version string,
-	hash string,
-	owner string,
-) error {
-	log.Info("Download consul-template package")
-	url := fmt.Sprintf("https://releases.hashicorp.com/consul-template/%s/consul-template_%s_linux_amd64.zip", version, version)
-	client := &http.Client{Timeout: 30 * time.Second}
-	zipPath, err := florist.NetFetch(client, url, florist.SHA256, hash,
-		florist.WorkDir)
-	if err != nil {
-		return err
-	}
-
-	extracted := path.Join(florist.WorkDir, "consul-template")
-	log.Info("Unzipping consul-template package", "dst", extracted)
-	if err := florist.UnzipOne(zipPath, "consul-template",
-		extracted); err != nil {
-		return err
-	}
-
-	exe := path.Join(BinDir, "consul-template")
-	log.Info("Install consul-template", "dst", exe)
-	if err := florist.CopyFile(extracted, exe, 0o755, owner); err != nil {
-		return err
-	}
-
-	return nil
-}
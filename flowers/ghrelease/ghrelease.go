@@ -0,0 +1,339 @@
+// Package ghrelease installs a command-line tool from the assets of a GitHub release.
+// It is configured, not programmed: to add a tool, fill Inst.
+//
+// Example, Task:
+//
+//	&ghrelease.Flower{
+//	    Inst: ghrelease.Inst{
+//	        Owner:      "go-task",
+//	        Repo:       "task",
+//	        Version:    "3.44.0",
+//	        Asset:      "task_{{.Os}}_{{.Arch}}.tar.gz",
+//	        Hash:       "d6c9c0a14793659766ee0c06f9843452942ae6982a3151c6bbd78959c1682b82",
+//	        Files:      map[string]string{"task": "task"},
+//	        VersionCmd: "task --version",
+//	    },
+//	}
+package ghrelease
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/creasty/defaults"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
+)
+
+const Name = "ghrelease"
+
+// DefaultVersionRegexp is the default of Inst.VersionRegexp. It matches the first
+// version number, such as 3.9.0 in "Task version: v3.9.0 (h1:k6ZH...)".
+const DefaultVersionRegexp = `(\d+\.\d+[\w.+-]*)`
+
+var (
+	_ florist.Flower     = (*Flower)(nil)
+	_ florist.Artifacter = (*Flower)(nil)
+)
+
+type Flower struct {
+	Inst
+	Conf
+}
+
+// Inst configures the release asset and what to install from it. The fields marked
+// as templates are Go text templates, with fields Version, Tag, Os and Arch (see
+// [AssetData]).
+type Inst struct {
+	// GitHub owner and repository, for example "go-task" and "task".
+	Owner string
+	Repo  string
+	// Version to install, without the leading "v".
+	Version string
+	// Template of the tag of the release.
+	Tag string `default:"v{{.Version}}"`
+	// Template of the name of the release asset, for example
+	// "task_{{.Os}}_{{.Arch}}.tar.gz". Assets ending in .zip, .tar, .tar.gz, .tgz,
+	// .tar.xz, .txz, .tar.zst, .tar.bz2 or .tbz2 are archives; any other asset is
+	// the executable itself.
+	Asset string
+	// Map from GOOS and GOARCH to the names used by the asset. For example
+	// ArchMap {"amd64": "x86_64", "arm64": "aarch64"} makes Arch follow the
+	// naming of "uname -m" (see platform.Arch.Uname). The architecture is the one
+	// of the machine (see platform.MachineArch).
+	OsMap   map[string]string
+	ArchMap map[string]string
+	// Verify the asset with Hash (of algorithm HashType, default SHA256) or with
+	// the checksum file named by template Checksums, an asset of the same release
+	// (for example "checksums.txt"). One of the two is required. Hashes is Hash
+	// per architecture ("amd64", "arm64"); if set, it replaces Hash.
+	Hash      string
+	Hashes    map[string]string
+	HashType  florist.Hash
+	Checksums string
+	// Files to install: path in the archive (a template) to name in Dir. For an
+	// asset that is not an archive, the key is ignored. Default: {Repo: Repo}.
+	Files map[string]string
+	// Directory where the files are installed, with mode 0755 and owner root.
+	Dir string `default:"/usr/local/bin"`
+	// Optional command line printing the installed version, for example
+	// "task --version". If the command is not an absolute path, it is looked up
+	// in Dir. If the installed version is Version, Install does nothing.
+	VersionCmd string
+	// Regular expression extracting the version from the output of VersionCmd: the
+	// first submatch, or the whole match. Default: [DefaultVersionRegexp].
+	VersionRegexp string
+}
+
+type Conf struct{}
+
+// AssetData is the data passed to the templates of Inst.
+type AssetData struct {
+	Version string
+	Tag     string
+	Os      string
+	Arch    string
+}
+
+func (fl *Flower) String() string {
+	return Name + "." + fl.Repo
+}
+
+func (fl *Flower) Description() string {
+	return fmt.Sprintf("install %s/%s from its GitHub release", fl.Owner, fl.Repo)
+}
+
+func (fl *Flower) Embedded() []string {
+	return nil
+}
+
+func (fl *Flower) Init() error {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("%s.init: "+format, append([]any{fl}, a...)...)
+	}
+	if err := defaults.Set(fl); err != nil {
+		return errorf("%s", err)
+	}
+	for _, field := range []struct{ name, value string }{
+		{"Owner", fl.Owner},
+		{"Repo", fl.Repo},
+		{"Version", fl.Version},
+		{"Asset", fl.Asset},
+	} {
+		if field.value == "" {
+			return errorf("missing %s", field.name)
+		}
+	}
+	hasHash := fl.Hash != "" || len(fl.Hashes) > 0
+	if hasHash == (fl.Checksums != "") {
+		return errorf("need exactly one of Hash (or Hashes) and Checksums")
+	}
+	if fl.HashType != 0 && !fl.HashType.Available() {
+		return errorf("unknown HashType %d", fl.HashType)
+	}
+	if len(fl.Files) == 0 {
+		fl.Files = map[string]string{fl.Repo: fl.Repo}
+	}
+	for _, name := range fl.Files {
+		if !filepath.IsLocal(name) {
+			return errorf("Files: invalid name %q", name)
+		}
+	}
+	if fl.VersionCmd != "" && len(strings.Fields(fl.VersionCmd)) == 0 {
+		return errorf("VersionCmd: blank command")
+	}
+	fl.VersionRegexp = cmp.Or(fl.VersionRegexp, DefaultVersionRegexp)
+	if _, err := regexp.Compile(fl.VersionRegexp); err != nil {
+		return errorf("VersionRegexp: %s", err)
+	}
+	// Catch errors in the templates now instead of during Install.
+	if _, err := fl.Artifacts(); err != nil {
+		return errorf("%s", err)
+	}
+	return nil
+}
+
+// Artifacts returns the release asset.
+func (fl *Flower) Artifacts() ([]florist.Artifact, error) {
+	data, err := fl.assetData()
+	if err != nil {
+		return nil, err
+	}
+	asset, err := render("Asset", fl.Asset, data)
+	if err != nil {
+		return nil, err
+	}
+	// https://github.com/go-task/task/releases/download/v3.9.0/task_linux_amd64.tar.gz
+	base, err := url.JoinPath("https://github.com/", fl.Owner, fl.Repo,
+		"releases/download", data.Tag)
+	if err != nil {
+		return nil, err
+	}
+	art := florist.Artifact{URL: base + "/" + asset, HashType: fl.HashType}
+	if fl.Checksums == "" {
+		if art.Hash, err = platform.HashFor(fl.Hashes, fl.Hash); err != nil {
+			return nil, err
+		}
+	} else {
+		checksums, err := render("Checksums", fl.Checksums, data)
+		if err != nil {
+			return nil, err
+		}
+		art.ChecksumFile = &florist.ChecksumFile{
+			URL:      base + "/" + checksums,
+			HashType: fl.HashType,
+		}
+	}
+	return []florist.Artifact{art}, nil
+}
+
+func (fl *Flower) Install() error {
+	log := slog.With("flower", fl.String()+".install")
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("%s.install: "+format, append([]any{fl}, a...)...)
+	}
+
+	if fl.VersionCmd != "" {
+		installed := fl.installedVersion(log)
+		if installed == strings.TrimPrefix(fl.Version, "v") {
+			log.Debug("already installed with matching version", "version", installed)
+			return nil
+		}
+	}
+
+	log.Info("downloading", "version", fl.Version)
+	artifacts, err := fl.Artifacts()
+	if err != nil {
+		return errorf("%s", err)
+	}
+	assetPath, err := artifacts[0].Fetch(florist.NewNetClient(), florist.WorkDir)
+	if err != nil {
+		return errorf("%s", err)
+	}
+
+	tmpDir, err := florist.MkdirTemp(florist.WorkDir, Name)
+	if err != nil {
+		return errorf("%s", err)
+	}
+	data, err := fl.assetData()
+	if err != nil {
+		return errorf("%s", err)
+	}
+	// Sort to install always in the same order.
+	members := make([]string, 0, len(fl.Files))
+	for member := range fl.Files {
+		members = append(members, member)
+	}
+	slices.Sort(members)
+	for _, member := range members {
+		name := fl.Files[member]
+		src := assetPath
+		member, err := render("Files", member, data)
+		if err != nil {
+			return errorf("%s", err)
+		}
+		if isArchive(assetPath) {
+			src = path.Join(tmpDir, path.Base(name))
+			err = florist.ExtractOne(assetPath, member, src)
+		}
+		if err != nil {
+			return errorf("%s", err)
+		}
+		dst := path.Join(fl.Dir, name)
+		if err := florist.CopyFile(src, dst, 0o755, "root"); err != nil {
+			return errorf("%s", err)
+		}
+		log.Info("installed", "path", dst, "version", fl.Version)
+	}
+
+	// We remove the tmpdir only on success; in case of failure we leave
+	// it around, it can be useful to troubleshoot.
+	if err := florist.RemoveAll(tmpDir); err != nil {
+		log.Info("removing tmpdir", "dir", tmpDir, "err", err)
+	}
+	return nil
+}
+
+func (fl *Flower) Configure() error {
+	log := slog.With("flower", fl.String()+".configure")
+	log.Debug("nothing to do")
+	return nil
+}
+
+// assetData returns the data for the templates of Inst, for the current platform.
+func (fl *Flower) assetData() (AssetData, error) {
+	arch := platform.MachineArch().String()
+	data := AssetData{
+		Version: fl.Version,
+		Os:      cmp.Or(fl.OsMap[runtime.GOOS], runtime.GOOS),
+		Arch:    cmp.Or(fl.ArchMap[arch], arch),
+	}
+	tag, err := render("Tag", fl.Tag, data)
+	if err != nil {
+		return AssetData{}, err
+	}
+	data.Tag = tag
+	return data, nil
+}
+
+// installedVersion returns the version printed by VersionCmd, or the empty string if
+// the command is not installed or its output does not match VersionRegexp.
+func (fl *Flower) installedVersion(log *slog.Logger) string {
+	args := strings.Fields(fl.VersionCmd)
+	if !path.IsAbs(args[0]) {
+		args[0] = path.Join(fl.Dir, args[0])
+	}
+	log = log.With("path", args[0])
+	if _, err := os.Stat(florist.Path(args[0])); err != nil {
+		log.Debug("executable not found")
+		return ""
+	}
+	out, err := florist.CmdOutput(log, exec.Command(args[0], args[1:]...))
+	if err != nil {
+		log.Debug("unexpected", "err", err)
+		return ""
+	}
+	match := regexp.MustCompile(fl.VersionRegexp).FindStringSubmatch(string(out))
+	if match == nil {
+		log.Debug("version not found", "output", string(out))
+		return ""
+	}
+	version := match[0]
+	if len(match) > 1 {
+		version = match[1]
+	}
+	version = strings.TrimPrefix(version, "v")
+	log.Debug("found", "version", version)
+	return version
+}
+
+// archiveExts are the extensions of the assets that are archives.
+var archiveExts = []string{
+	".zip", ".tar", ".tar.gz", ".tgz", ".tar.xz", ".txz", ".tar.zst", ".tar.bz2", ".tbz2",
+}
+
+func isArchive(assetPath string) bool {
+	return slices.ContainsFunc(archiveExts, func(ext string) bool {
+		return strings.HasSuffix(assetPath, ext)
+	})
+}
+
+// render renders template tmplText, the field of Inst named field.
+func render(field string, tmplText string, data AssetData) (string, error) {
+	out, err := florist.TemplateFromText(tmplText, data, field)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", field, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,244 @@
+package ghrelease_test
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+	"github.com/ulikunitz/xz"
+
+	"github.com/marco-m/florist/flowers/ghrelease"
+	"github.com/marco-m/florist/pkg/flowertest"
+	"github.com/marco-m/florist/pkg/platform"
+)
+
+const releases = "https://github.com/acme/rocket/releases/download/"
+
+func TestGhreleaseInstallTarGz(t *testing.T) {
+	h := flowertest.New(t)
+	asset := flowertest.MakeTarGz(t, map[string]string{
+		"rocket_1.2.3/rocket":  "rocket binary",
+		"rocket_1.2.3/booster": "booster binary",
+		"rocket_1.2.3/README":  "readme",
+	})
+	url := fmt.Sprintf("%sv1.2.3/rocket_%s_banana.tar.gz", releases, runtime.GOOS)
+	hash := h.Serve(url, asset)
+
+	fl := &ghrelease.Flower{Inst: ghrelease.Inst{
+		Owner:   "acme",
+		Repo:    "rocket",
+		Version: "1.2.3",
+		Asset:   "rocket_{{.Os}}_{{.Arch}}.tar.gz",
+		ArchMap: map[string]string{runtime.GOARCH: "banana"},
+		Hash:    hash,
+		Files: map[string]string{
+			"rocket_{{.Version}}/rocket":  "rocket",
+			"rocket_{{.Version}}/booster": "rocket-booster",
+		},
+		VersionCmd: "rocket version",
+	}}
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertFile("/usr/local/bin/rocket", "rocket binary")
+	h.AssertFile("/usr/local/bin/rocket-booster", "booster binary")
+	h.AssertMode("/usr/local/bin/rocket", 0o755)
+	h.AssertOwner("/usr/local/bin/rocket", "root", "root")
+	h.AssertNoFile("/usr/local/bin/README")
+
+	// Installed with the same version: nothing to download.
+	h.Runner.On("/usr/local/bin/rocket version", "rocket version v1.2.3 (abcdef)\n", nil)
+	err = h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+	h.AssertCommands("/usr/local/bin/rocket version")
+	assert.DeepEqual(t, h.Requests(), []string{url}, "requests")
+
+	// Installed with another version: reinstall.
+	h.WriteFile("/usr/local/bin/rocket", "old rocket binary")
+	h.Runner.On("/usr/local/bin/rocket version", "rocket version v1.2.2 (abcdef)\n", nil)
+	err = h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+	h.AssertFile("/usr/local/bin/rocket", "rocket binary")
+}
+
+func TestGhreleaseInstallZipWithChecksums(t *testing.T) {
+	h := flowertest.New(t)
+	asset := flowertest.MakeZip(t, map[string]string{"bin/rocket.exe": "rocket binary"})
+	url := releases + "rocket-2.0/rocket.zip"
+	hash := h.Serve(url, asset)
+	h.Serve(releases+"rocket-2.0/SHA256SUMS", []byte(hash+"  rocket.zip\n"))
+
+	fl := &ghrelease.Flower{Inst: ghrelease.Inst{
+		Owner:     "acme",
+		Repo:      "rocket",
+		Version:   "2.0",
+		Tag:       "rocket-{{.Version}}",
+		Asset:     "rocket.zip",
+		Checksums: "SHA256SUMS",
+		Files:     map[string]string{"bin/rocket.exe": "rocket"},
+		Dir:       "/opt/rocket/bin",
+	}}
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertFile("/opt/rocket/bin/rocket", "rocket binary")
+}
+
+func TestGhreleaseInstallTarXz(t *testing.T) {
+	h := flowertest.New(t)
+	var asset bytes.Buffer
+	xzw, err := xz.NewWriter(&asset)
+	assert.NoError(t, err, "xz.NewWriter")
+	_, err = xzw.Write(flowertest.MakeTar(t, map[string]string{"rocket-1.2.3/rocket": "rocket binary"}))
+	assert.NoError(t, err, "xzw.Write")
+	assert.NoError(t, xzw.Close(), "xzw.Close")
+	hash := h.Serve(releases+"v1.2.3/rocket.tar.xz", asset.Bytes())
+
+	fl := &ghrelease.Flower{Inst: ghrelease.Inst{
+		Owner:   "acme",
+		Repo:    "rocket",
+		Version: "1.2.3",
+		Asset:   "rocket.tar.xz",
+		Hash:    hash,
+		Files:   map[string]string{"rocket-{{.Version}}/rocket": "rocket"},
+	}}
+	err = h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertFile("/usr/local/bin/rocket", "rocket binary")
+}
+
+func TestGhreleaseInstallBinary(t *testing.T) {
+	h := flowertest.New(t)
+	url := releases + "v1.2.3/rocket-" + runtime.GOOS
+	hash := h.Serve(url, []byte("rocket binary"))
+
+	fl := &ghrelease.Flower{Inst: ghrelease.Inst{
+		Owner:   "acme",
+		Repo:    "rocket",
+		Version: "1.2.3",
+		Asset:   "rocket-{{.Os}}",
+		Hash:    hash,
+	}}
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertFile("/usr/local/bin/rocket", "rocket binary")
+}
+
+func TestGhreleaseInstallPerArchHashes(t *testing.T) {
+	h := flowertest.New(t)
+	prev := platform.SetArch(platform.ARM64)
+	t.Cleanup(func() { platform.SetArch(prev) })
+	url := releases + "v1.2.3/rocket-" + runtime.GOOS + "-aarch64"
+	hash := h.Serve(url, []byte("rocket binary"))
+
+	fl := &ghrelease.Flower{Inst: ghrelease.Inst{
+		Owner:   "acme",
+		Repo:    "rocket",
+		Version: "1.2.3",
+		Asset:   "rocket-{{.Os}}-{{.Arch}}",
+		ArchMap: map[string]string{"amd64": "x86_64", "arm64": "aarch64"},
+		Hashes: map[string]string{
+			"amd64": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			"arm64": hash,
+		},
+	}}
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+	h.AssertFile("/usr/local/bin/rocket", "rocket binary")
+
+	delete(fl.Hashes, "arm64")
+	err = h.Install(fl)
+	assert.ErrorContains(t, err, "no hash for architecture arm64", "h.Install")
+}
+
+func TestGhreleaseInstallHashMismatch(t *testing.T) {
+	h := flowertest.New(t)
+	h.Serve(releases+"v1.2.3/rocket", []byte("rocket binary"))
+
+	fl := &ghrelease.Flower{Inst: ghrelease.Inst{
+		Owner:   "acme",
+		Repo:    "rocket",
+		Version: "1.2.3",
+		Asset:   "rocket",
+		Hash:    "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	}}
+	err := h.Install(fl)
+
+	assert.ErrorContains(t, err, "ghrelease.rocket.install: ", "h.Install")
+	assert.ErrorContains(t, err, "hash mismatch", "h.Install")
+	h.AssertNoFile("/usr/local/bin/rocket")
+}
+
+func TestGhreleaseInitFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		inst    ghrelease.Inst
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		fl := &ghrelease.Flower{Inst: tc.inst}
+
+		err := fl.Init()
+
+		assert.ErrorContains(t, err, tc.wantErr, "fl.Init")
+	}
+
+	valid := func(edit func(inst *ghrelease.Inst)) ghrelease.Inst {
+		inst := ghrelease.Inst{
+			Owner:   "acme",
+			Repo:    "rocket",
+			Version: "1.2.3",
+			Asset:   "rocket.tar.gz",
+			Hash:    "0123",
+		}
+		edit(&inst)
+		return inst
+	}
+
+	testCases := []testCase{
+		{
+			name:    "missing Owner",
+			inst:    valid(func(inst *ghrelease.Inst) { inst.Owner = "" }),
+			wantErr: "ghrelease.rocket.init: missing Owner",
+		},
+		{
+			name:    "missing Asset",
+			inst:    valid(func(inst *ghrelease.Inst) { inst.Asset = "" }),
+			wantErr: "ghrelease.rocket.init: missing Asset",
+		},
+		{
+			name:    "Hash and Checksums",
+			inst:    valid(func(inst *ghrelease.Inst) { inst.Checksums = "checksums.txt" }),
+			wantErr: "ghrelease.rocket.init: need exactly one of Hash (or Hashes) and Checksums",
+		},
+		{
+			name:    "Files escaping Dir",
+			inst:    valid(func(inst *ghrelease.Inst) { inst.Files = map[string]string{"a": "../a"} }),
+			wantErr: `ghrelease.rocket.init: Files: invalid name "../a"`,
+		},
+		{
+			name:    "blank VersionCmd",
+			inst:    valid(func(inst *ghrelease.Inst) { inst.VersionCmd = " \t" }),
+			wantErr: "ghrelease.rocket.init: VersionCmd: blank command",
+		},
+		{
+			name:    "invalid VersionRegexp",
+			inst:    valid(func(inst *ghrelease.Inst) { inst.VersionRegexp = "(" }),
+			wantErr: "ghrelease.rocket.init: VersionRegexp: ",
+		},
+		{
+			name:    "invalid Asset template",
+			inst:    valid(func(inst *ghrelease.Inst) { inst.Asset = "rocket_{{.Banana}}" }),
+			wantErr: "ghrelease.rocket.init: Asset: ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
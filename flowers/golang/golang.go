@@ -5,19 +5,18 @@ import (
 	"bytes"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"net/url"
-	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/creasty/defaults"
 
 	"github.com/marco-m/florist/pkg/envvar"
 	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
+	"github.com/marco-m/florist/pkg/signature"
 )
 
 const (
@@ -26,7 +25,10 @@ const (
 
 const Name = "golang"
 
-var _ florist.Flower = (*Flower)(nil)
+var (
+	_ florist.Flower     = (*Flower)(nil)
+	_ florist.Artifacter = (*Flower)(nil)
+)
 
 type Flower struct {
 	Inst
@@ -35,7 +37,15 @@ type Flower struct {
 
 type Inst struct {
 	Version string
-	Hash    string
+	// SHA-256 of the Go tarball. Can be empty if PGPKey is set.
+	Hash string
+	// SHA-256 of the Go tarball per architecture ("amd64", "arm64"). If set, it
+	// replaces Hash.
+	Hashes map[string]string
+	// ASCII-armored OpenPGP public key that signs the Go releases (the .asc files
+	// next to the tarballs). If set, the download is verified with the signature
+	// instead of with Hash.
+	PGPKey string
 }
 
 type Conf struct{}
@@ -59,12 +69,35 @@ func (fl *Flower) Init() error {
 	if fl.Version == "" {
 		return fmt.Errorf("%s.new: missing version", Name)
 	}
-	if fl.Hash == "" {
-		return fmt.Errorf("%s.new: missing hash", Name)
+	if fl.Hash == "" && len(fl.Hashes) == 0 && fl.PGPKey == "" {
+		return fmt.Errorf("%s.new: missing hash or PGP key", Name)
 	}
 	return nil
 }
 
+// Artifacts returns the Go tarball for the machine architecture.
+func (fl *Flower) Artifacts() ([]florist.Artifact, error) {
+	uri, err := url.JoinPath("https://golang.org/dl",
+		"go"+fl.Version+".linux-"+platform.MachineArch().String()+".tar.gz")
+	if err != nil {
+		return nil, err
+	}
+	if fl.PGPKey == "" {
+		hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+		if err != nil {
+			return nil, err
+		}
+		return []florist.Artifact{{URL: uri, Hash: hash}}, nil
+	}
+	verifier, err := signature.NewOpenPGP(fl.PGPKey)
+	if err != nil {
+		return nil, err
+	}
+	return []florist.Artifact{
+		{URL: uri, SignatureURL: uri + ".asc", Verifier: verifier},
+	}, nil
+}
+
 func (fl *Flower) Install() error {
 	log := slog.With("flower", Name+".install")
 
@@ -75,41 +108,38 @@ func (fl *Flower) Install() error {
 	}
 
 	log.Info("Download Go package", "version", fl.Version)
-	uri, err := url.JoinPath("https://golang.org/dl",
-		"go"+fl.Version+".linux-amd64.tar.gz")
+	artifacts, err := fl.Artifacts()
 	if err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
-	client := &http.Client{Timeout: 30 * time.Second}
-	tgzPath, err := florist.NetFetch(client, uri, florist.SHA256, fl.Hash,
-		florist.WorkDir)
+	tgzPath, err := artifacts[0].Fetch(florist.NewNetClient(), florist.WorkDir)
 	if err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 
 	log.Debug("extracting Go")
-	if err := os.RemoveAll(path.Join(florist.WorkDir, "go")); err != nil {
+	if err := florist.RemoveAll(path.Join(florist.WorkDir, "go")); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
-	cmd := exec.Command("tar", "xzf", tgzPath)
-	cmd.Dir = florist.WorkDir
+	cmd := exec.Command("tar", "xzf", florist.Path(tgzPath))
+	cmd.Dir = florist.Path(florist.WorkDir)
 	if err := florist.CmdRun(log, cmd); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 
 	log.Debug("removing old Go (if any)")
-	if err := os.RemoveAll(GOROOT); err != nil {
+	if err := florist.RemoveAll(GOROOT); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 
 	log.Debug("Moving Go into place")
-	if err := os.Rename(path.Join(florist.WorkDir, "go"), GOROOT); err != nil {
+	if err := florist.Rename(path.Join(florist.WorkDir, "go"), GOROOT); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 
 	log.Debug("Creating symbolic links")
 	goBinDir := path.Join(GOROOT, "bin")
-	goBinaries, err := os.ReadDir(goBinDir)
+	goBinaries, err := florist.ReadDir(goBinDir)
 	if err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
@@ -117,16 +147,16 @@ func (fl *Flower) Install() error {
 		oldname := path.Join(goBinDir, de.Name())
 		newname := path.Join("/usr/local/bin", de.Name())
 		// Remove old Go symlink (if any). If no previous Go installation, the symlink
-		// will not exist and os.Remove will return an error, so we don't check for it.
-		os.Remove(newname)
-		if err := os.Symlink(oldname, newname); err != nil {
+		// will not exist and florist.Remove will return an error, so we don't check for it.
+		florist.Remove(newname)
+		if err := florist.Symlink(oldname, newname); err != nil {
 			return fmt.Errorf("%s: %s", Name, err)
 		}
 	}
 
 	// Smoke test for the installation.
 	goExe := filepath.Join(goBinDir, "go")
-	output, err := exec.Command(goExe, "version").Output()
+	output, err := florist.CmdOutput(log, exec.Command(florist.Path(goExe), "version"))
 	if err != nil {
 		return fmt.Errorf("%s: doing Go install smoke test: %s", Name, err)
 	}
@@ -145,13 +175,12 @@ func (fl *Flower) Configure() error {
 // string if not found.
 func installedGoVersion(log *slog.Logger, goexe string) string {
 	log = log.With("path", goexe)
-	goexe, err := exec.LookPath(goexe)
-	if err != nil {
+	if _, err := exec.LookPath(florist.Path(goexe)); err != nil {
 		log.Debug("Go executable not found")
 		return ""
 	}
-	cmd := exec.Command(goexe, "version")
-	out, err := cmd.Output()
+	cmd := exec.Command(florist.Path(goexe), "version")
+	out, err := florist.CmdOutput(log, cmd)
 	if err != nil {
 		log.Debug("unexpected", "err", err)
 		return ""
@@ -4,20 +4,21 @@ package gopass
 import (
 	"fmt"
 	"log/slog"
-	"net/http"
 	url2 "net/url"
-	"os"
-	"time"
 
 	"github.com/creasty/defaults"
 
 	"github.com/marco-m/florist/pkg/apt"
 	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
 )
 
 const Name = "gopass"
 
-var _ florist.Flower = (*Flower)(nil)
+var (
+	_ florist.Flower     = (*Flower)(nil)
+	_ florist.Artifacter = (*Flower)(nil)
+)
 
 type Flower struct {
 	Inst
@@ -27,6 +28,8 @@ type Flower struct {
 type Inst struct {
 	Version string
 	Hash    string
+	// Hash per architecture ("amd64", "arm64"). If set, it replaces Hash.
+	Hashes map[string]string
 }
 
 type Conf struct{}
@@ -50,13 +53,28 @@ func (fl *Flower) Init() error {
 	if fl.Version == "" {
 		return fmt.Errorf("%s.init: %s", Name, "missing version")
 	}
-	if fl.Hash == "" {
+	if fl.Hash == "" && len(fl.Hashes) == 0 {
 		return fmt.Errorf("%s.init: %s", Name, "missing hash")
 	}
 
 	return nil
 }
 
+// Artifacts returns the gopass package.
+func (fl *Flower) Artifacts() ([]florist.Artifact, error) {
+	uri, err := url2.JoinPath("https://github.com/gopasspw/gopass/releases/download",
+		"v"+fl.Version,
+		"gopass_"+fl.Version+"_linux_"+platform.MachineArch().String()+".deb")
+	if err != nil {
+		return nil, err
+	}
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return []florist.Artifact{{URL: uri, Hash: hash}}, nil
+}
+
 func (fl *Flower) Install() error {
 	log := slog.With("flower", Name+".install")
 
@@ -69,15 +87,11 @@ func (fl *Flower) Install() error {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
 	log.Info("Download gopass package")
-	uri, err := url2.JoinPath("https://github.com/gopasspw/gopass/releases/download",
-		"v"+fl.Version,
-		"gopass_"+fl.Version+"_linux_amd64.deb")
+	artifacts, err := fl.Artifacts()
 	if err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
-	client := &http.Client{Timeout: 30 * time.Second}
-	pkgPath, err := florist.NetFetch(client, uri, florist.SHA256, fl.Hash,
-		florist.WorkDir)
+	pkgPath, err := artifacts[0].Fetch(florist.NewNetClient(), florist.WorkDir)
 	if err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
@@ -85,7 +99,7 @@ func (fl *Flower) Install() error {
 	if err := apt.DpkgInstall(pkgPath); err != nil {
 		return fmt.Errorf("%s: %s", Name, err)
 	}
-	os.Remove(pkgPath)
+	florist.Remove(pkgPath)
 
 	return nil
 }
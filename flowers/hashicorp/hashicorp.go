@@ -0,0 +1,274 @@
+// Package hashicorp contains a flower to install any HashiCorp product (consul,
+// nomad, vault, terraform, packer, consul-template, ...) from
+// https://releases.hashicorp.com, and the functions to download and install the
+// executable of a product, used also by the consul and consultemplate flowers.
+//
+// Example, a Nomad agent:
+//
+//	&hashicorp.Flower{
+//	    Inst: hashicorp.Inst{
+//	        Product:  "nomad",
+//	        Version:  "1.9.3",
+//	        PGPKey:   hashicorpKey,
+//	        Username: "nomad",
+//	        Dirs:     []string{"/opt/nomad/config", "/opt/nomad/data"},
+//	        Unit:     hashicorp.AgentUnit,
+//	    },
+//	}
+package hashicorp
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+
+	"github.com/creasty/defaults"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
+	"github.com/marco-m/florist/pkg/signature"
+	"github.com/marco-m/florist/pkg/systemd"
+)
+
+const Name = "hashicorp"
+
+// AgentUnit is a template of a systemd unit running "PRODUCT agent", suitable for
+// Consul and Nomad. It expects the configuration in directory HomeDir/config.
+const AgentUnit = `[Unit]
+Description={{.Product}} agent
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+{{- if .Username}}
+User={{.Username}}
+Group={{.Username}}
+{{- end}}
+ExecStart={{.BinDir}}/{{.Product}} agent -config-dir={{.HomeDir}}/config
+ExecReload=/bin/kill -HUP $MAINPID
+KillSignal=SIGINT
+Restart=on-failure
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`
+
+var (
+	_ florist.Flower     = (*Flower)(nil)
+	_ florist.Artifacter = (*Flower)(nil)
+)
+
+type Flower struct {
+	Inst
+	Conf
+}
+
+type Inst struct {
+	// Name of the product on releases.hashicorp.com, for example "nomad".
+	Product string
+	Version string
+	// SHA-256 of the zip. Can be empty if PGPKey is set.
+	Hash string
+	// SHA-256 of the zip per architecture ("amd64", "arm64"), to use the same
+	// provisioner on different machines. If set, it replaces Hash.
+	Hashes map[string]string
+	// ASCII-armored OpenPGP public key of HashiCorp (see
+	// https://www.hashicorp.com/security). If set, the download is verified
+	// with the signed SHA256SUMS of the release instead of with Hash.
+	PGPKey string
+	// Directory of the executable.
+	BinDir string `default:"/usr/local/bin"`
+	// Optional system user to create, with home directory HomeDir.
+	Username string
+	// Default: /opt/PRODUCT.
+	HomeDir string
+	// Optional directories to create, with mode 0755 and owned by Username (or
+	// root if Username is empty).
+	Dirs []string
+	// Optional template of a systemd unit, rendered with the Flower as data (see
+	// [AgentUnit]). The unit is installed as UnitName and enabled.
+	Unit string
+	// Default: PRODUCT.service.
+	UnitName string
+}
+
+type Conf struct{}
+
+func (fl *Flower) String() string {
+	return Name + "." + fl.Product
+}
+
+func (fl *Flower) Description() string {
+	return "install HashiCorp " + fl.Product
+}
+
+func (fl *Flower) Embedded() []string {
+	return nil
+}
+
+func (fl *Flower) Init() error {
+	if err := defaults.Set(fl); err != nil {
+		return fmt.Errorf("%s.init: %s", fl, err)
+	}
+	if fl.Product == "" {
+		return fmt.Errorf("%s.init: missing product", Name)
+	}
+	if fl.Version == "" {
+		return fmt.Errorf("%s.init: missing version", fl)
+	}
+	if fl.Hash == "" && len(fl.Hashes) == 0 && fl.PGPKey == "" {
+		return fmt.Errorf("%s.init: missing hash or PGP key", fl)
+	}
+	fl.HomeDir = cmp.Or(fl.HomeDir, path.Join("/opt", fl.Product))
+	fl.UnitName = cmp.Or(fl.UnitName, fl.Product+".service")
+	return nil
+}
+
+// Artifacts returns the zip of the product.
+func (fl *Flower) Artifacts() ([]florist.Artifact, error) {
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return nil, err
+	}
+	artifact, err := Artifact(fl.Product, fl.Version, hash, fl.PGPKey)
+	if err != nil {
+		return nil, err
+	}
+	return []florist.Artifact{artifact}, nil
+}
+
+func (fl *Flower) Install() error {
+	log := slog.With("flower", fl.String()+".install")
+
+	owner := "root"
+	if fl.Username != "" {
+		owner = fl.Username
+		log.Info("Add system user", "user", fl.Username)
+		if err := florist.UserAdd(fl.Username, &florist.UserAddArgs{
+			System:  true,
+			HomeDir: fl.HomeDir,
+		}); err != nil {
+			return fmt.Errorf("%s.install: %s", fl, err)
+		}
+	}
+
+	for _, dir := range fl.Dirs {
+		log.Info("Create dir", "dir", dir)
+		if err := florist.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("%s.install: %s", fl, err)
+		}
+		if err := florist.Mkdir(dir, 0o755, owner, owner); err != nil {
+			return fmt.Errorf("%s.install: %s", fl, err)
+		}
+	}
+
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return fmt.Errorf("%s.install: %s", fl, err)
+	}
+	if err := InstallExe(log, fl.Product, fl.Version, hash, fl.PGPKey,
+		fl.BinDir); err != nil {
+		return fmt.Errorf("%s.install: %s", fl, err)
+	}
+
+	if fl.Unit == "" {
+		return nil
+	}
+	rendered, err := florist.TemplateFromText(fl.Unit, fl, "Unit")
+	if err != nil {
+		return fmt.Errorf("%s.install: %s", fl, err)
+	}
+	dst := path.Join(systemd.UnitDir, fl.UnitName)
+	log.Info("Install systemd unit file", "dst", dst)
+	if err := florist.MkdirAll(systemd.UnitDir, 0o755); err != nil {
+		return fmt.Errorf("%s.install: %s", fl, err)
+	}
+	if err := florist.WriteFile(dst, rendered, 0o644, "root", "root"); err != nil {
+		return fmt.Errorf("%s.install: %s", fl, err)
+	}
+	if err := systemd.DaemonReload(); err != nil {
+		return fmt.Errorf("%s.install: %s", fl, err)
+	}
+	log.Info("Enable service to start at boot", "unit", fl.UnitName)
+	if err := systemd.Enable(fl.UnitName); err != nil {
+		return fmt.Errorf("%s.install: %s", fl, err)
+	}
+
+	// We do not start the service at Packer time: the configuration is not yet
+	// in place.
+
+	return nil
+}
+
+func (fl *Flower) Configure() error {
+	log := slog.With("flower", fl.String()+".configure")
+	log.Debug("nothing to do")
+	return nil
+}
+
+// Artifact returns the zip of version of product, for the machine architecture (see
+// [platform.MachineArch]). If pgpKey (the ASCII-armored OpenPGP public key of
+// HashiCorp) is not empty, the download is verified with the signed SHA256SUMS of
+// the release, otherwise with hash.
+func Artifact(product string, version string, hash string, pgpKey string) (florist.Artifact, error) {
+	// https://releases.hashicorp.com/consul/1.20.1/consul_1.20.1_linux_amd64.zip
+	baseURL, err := url.JoinPath("https://releases.hashicorp.com", product, version)
+	if err != nil {
+		return florist.Artifact{}, err
+	}
+	uri := fmt.Sprintf("%s/%s_%s_linux_%s.zip", baseURL, product, version,
+		platform.MachineArch())
+	if pgpKey == "" {
+		return florist.Artifact{URL: uri, Hash: hash}, nil
+	}
+	verifier, err := signature.NewOpenPGP(pgpKey)
+	if err != nil {
+		return florist.Artifact{}, err
+	}
+	sums := fmt.Sprintf("%s/%s_%s_SHA256SUMS", baseURL, product, version)
+	return florist.Artifact{
+		URL: uri,
+		ChecksumFile: &florist.ChecksumFile{
+			URL:          sums,
+			SignatureURL: sums + ".sig",
+			Verifier:     verifier,
+		},
+	}, nil
+}
+
+// InstallExe downloads the zip of version of product (see [Artifact] for hash and
+// pgpKey) and installs the executable to binDir, with owner root.
+func InstallExe(
+	log *slog.Logger,
+	product string,
+	version string,
+	hash string,
+	pgpKey string,
+	binDir string,
+) error {
+	log.Info("Download package", "product", product, "version", version)
+	artifact, err := Artifact(product, version, hash, pgpKey)
+	if err != nil {
+		return err
+	}
+	zipPath, err := artifact.Fetch(florist.NewNetClient(), florist.WorkDir)
+	if err != nil {
+		return err
+	}
+
+	extracted := path.Join(florist.WorkDir, product)
+	log.Info("Unzipping package", "dst", extracted)
+	if err := florist.UnzipOne(zipPath, product, extracted); err != nil {
+		return err
+	}
+
+	exe := path.Join(binDir, product)
+	log.Info("Install executable", "dst", exe)
+	if err := florist.CopyFile(extracted, exe, 0o755, "root"); err != nil {
+		return err
+	}
+	return nil
+}
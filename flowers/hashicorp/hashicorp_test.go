@@ -0,0 +1,141 @@
+package hashicorp_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/flowers/hashicorp"
+	"github.com/marco-m/florist/pkg/flowertest"
+	"github.com/marco-m/florist/pkg/platform"
+)
+
+const nomadURL = "https://releases.hashicorp.com/nomad/1.9.3/"
+
+func TestHashicorpInstallWithHash(t *testing.T) {
+	h := flowertest.New(t)
+	setArch(t, platform.AMD64)
+	hash := h.Serve(nomadURL+"nomad_1.9.3_linux_amd64.zip",
+		flowertest.MakeZip(t, map[string]string{"nomad": "nomad binary"}))
+
+	fl := &hashicorp.Flower{Inst: hashicorp.Inst{
+		Product: "nomad",
+		Version: "1.9.3",
+		Hash:    hash,
+		Dirs:    []string{"/opt/nomad/config", "/opt/nomad/data"},
+		Unit:    hashicorp.AgentUnit,
+	}}
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertFile("/usr/local/bin/nomad", "nomad binary")
+	h.AssertMode("/usr/local/bin/nomad", 0o755)
+	h.AssertOwner("/opt/nomad/data", "root", "root")
+	h.AssertFileContains("/etc/systemd/system/nomad.service",
+		"ExecStart=/usr/local/bin/nomad agent -config-dir=/opt/nomad/config\n")
+	h.AssertCommands(
+		"systemctl daemon-reload",
+		"systemctl enable nomad.service",
+	)
+}
+
+func TestHashicorpInstallWithSignedChecksums(t *testing.T) {
+	h := flowertest.New(t)
+	setArch(t, platform.AMD64)
+	signer, pgpKey := flowertest.NewOpenPGPKey(t)
+	zipHash := h.Serve(nomadURL+"nomad_1.9.3_linux_amd64.zip",
+		flowertest.MakeZip(t, map[string]string{"nomad": "nomad binary"}))
+	sums := zipHash + "  nomad_1.9.3_linux_amd64.zip\n"
+	h.Serve(nomadURL+"nomad_1.9.3_SHA256SUMS", []byte(sums))
+	var sig bytes.Buffer
+	err := openpgp.DetachSign(&sig, signer, bytes.NewReader([]byte(sums)), nil)
+	assert.NoError(t, err, "openpgp.DetachSign")
+	h.Serve(nomadURL+"nomad_1.9.3_SHA256SUMS.sig", sig.Bytes())
+
+	fl := &hashicorp.Flower{Inst: hashicorp.Inst{
+		Product: "nomad",
+		Version: "1.9.3",
+		PGPKey:  pgpKey,
+	}}
+	err = h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertFile("/usr/local/bin/nomad", "nomad binary")
+	h.AssertNoFile("/etc/systemd/system/nomad.service")
+
+	// Signed by another key.
+	_, otherKey := flowertest.NewOpenPGPKey(t)
+	fl = &hashicorp.Flower{Inst: hashicorp.Inst{
+		Product: "nomad",
+		Version: "1.9.3",
+		PGPKey:  otherKey,
+	}}
+	err = h.Install(fl)
+	assert.ErrorContains(t, err, "signature made by unknown entity", "h.Install")
+}
+
+func TestHashicorpInstallPerArchHashes(t *testing.T) {
+	h := flowertest.New(t)
+	setArch(t, platform.ARM64)
+	hash := h.Serve(nomadURL+"nomad_1.9.3_linux_arm64.zip",
+		flowertest.MakeZip(t, map[string]string{"nomad": "nomad arm64 binary"}))
+
+	fl := &hashicorp.Flower{Inst: hashicorp.Inst{
+		Product: "nomad",
+		Version: "1.9.3",
+		Hashes: map[string]string{
+			"amd64": "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			"arm64": hash,
+		},
+	}}
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertFile("/usr/local/bin/nomad", "nomad arm64 binary")
+}
+
+func TestHashicorpInitFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		inst    hashicorp.Inst
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		fl := &hashicorp.Flower{Inst: tc.inst}
+
+		err := fl.Init()
+
+		assert.ErrorContains(t, err, tc.wantErr, "fl.Init")
+	}
+
+	testCases := []testCase{
+		{
+			name:    "missing product",
+			inst:    hashicorp.Inst{Version: "1.9.3", Hash: "0123"},
+			wantErr: "hashicorp.init: missing product",
+		},
+		{
+			name:    "missing version",
+			inst:    hashicorp.Inst{Product: "vault", Hash: "0123"},
+			wantErr: "hashicorp.vault.init: missing version",
+		},
+		{
+			name:    "missing hash and PGP key",
+			inst:    hashicorp.Inst{Product: "vault", Version: "1.18.2"},
+			wantErr: "hashicorp.vault.init: missing hash or PGP key",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+// setArch makes platform.MachineArch return a, restoring it at the end of the test.
+func setArch(t *testing.T, a platform.Arch) {
+	prev := platform.SetArch(a)
+	t.Cleanup(func() { platform.SetArch(prev) })
+}
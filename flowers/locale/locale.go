@@ -4,7 +4,6 @@ package locale
 import (
 	"fmt"
 	"log/slog"
-	"os"
 	"os/exec"
 	"strings"
 
@@ -65,7 +64,7 @@ func (fl *Flower) Install() error {
 
 	log.Info("Setup locale", "lang", fl.Lang)
 	// Since running locale-gen takes seconds, avoid if possible.
-	localesArchive, err := exec.Command("localedef", "--list-archive").Output()
+	localesArchive, err := florist.CmdOutput(log, exec.Command("localedef", "--list-archive"))
 	if err != nil {
 		return err
 	}
@@ -78,7 +77,7 @@ func (fl *Flower) Install() error {
 	}
 
 	locale := fmt.Sprintf("%s UTF-8\n", fl.Lang)
-	if err := os.WriteFile("/etc/locale.gen", []byte(locale), 0o644); err != nil {
+	if err := florist.WriteFile("/etc/locale.gen", locale, 0o644, "root", "root"); err != nil {
 		return err
 	}
 	if err := florist.CmdRun(log, exec.Command("locale-gen")); err != nil {
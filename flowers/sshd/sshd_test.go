@@ -9,6 +9,7 @@ import (
 
 	"github.com/marco-m/florist/flowers/sshd"
 	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/flowertest"
 	"github.com/marco-m/florist/pkg/provisioner"
 )
 
@@ -69,3 +70,24 @@ func TestSshdConfigureSuccess(t *testing.T) {
 	assert.FileEqualsString(t, sshd.SshHostEd25519KeyCertPubDst,
 		SshHostEd25519KeyCertPub)
 }
+
+func TestSshdConfigureHermetic(t *testing.T) {
+	h := flowertest.New(t)
+	h.MkdirAll("/etc/ssh")
+
+	fl := &sshd.Flower{
+		Conf: sshd.Conf{
+			Port:                 1234,
+			SshHostEd25519Key:    "private",
+			SshHostEd25519KeyPub: "public",
+		},
+	}
+	err := h.Configure(fl)
+	assert.NoError(t, err, "h.Configure")
+
+	h.AssertFileContains(sshd.SshdConfigDst, "Port 1234\n")
+	h.AssertFile(sshd.SshHostEd25519KeyDst, "private\n")
+	h.AssertMode(sshd.SshHostEd25519KeyDst, 0o600)
+	h.AssertOwner(sshd.SshHostEd25519KeyDst, "root", "root")
+	h.AssertCommands("/usr/sbin/sshd -t", "systemctl reload ssh")
+}
@@ -6,15 +6,13 @@ import (
 	"fmt"
 	"io/fs"
 	"log/slog"
-	"net/http"
-	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
-	"time"
 
 	"github.com/creasty/defaults"
 	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
 	"github.com/marco-m/florist/pkg/systemd"
 )
 
@@ -41,7 +39,10 @@ const (
 
 const Name = "tailscale"
 
-var _ florist.Flower = (*Flower)(nil)
+var (
+	_ florist.Flower     = (*Flower)(nil)
+	_ florist.Artifacter = (*Flower)(nil)
+)
 
 type Flower struct {
 	Inst
@@ -51,7 +52,9 @@ type Flower struct {
 type Inst struct {
 	Version string
 	Hash    string
-	Fsys    fs.FS
+	// Hash per architecture ("amd64", "arm64"). If set, it replaces Hash.
+	Hashes map[string]string
+	Fsys   fs.FS
 }
 
 type Conf struct {
@@ -84,17 +87,30 @@ func (fl *Flower) Init() error {
 	if fl.Version == "" {
 		return errorf("version cannot be empty")
 	}
-	if fl.Hash == "" {
+	if fl.Hash == "" && len(fl.Hashes) == 0 {
 		return errorf("hash cannot be empty")
 	}
 	return nil
 }
 
+// Artifacts returns the tailscale tarball.
+func (fl *Flower) Artifacts() ([]florist.Artifact, error) {
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return []florist.Artifact{newArtifact(fl.Version, hash)}, nil
+}
+
 func (fl *Flower) Install() error {
 	errorf := makeErrorf(Name + ".install")
 	log := slog.With("flower", Name+".install")
 
-	if err := installExes(log, fl.Version, fl.Hash, "root"); err != nil {
+	hash, err := platform.HashFor(fl.Hashes, fl.Hash)
+	if err != nil {
+		return errorf("%s", err)
+	}
+	if err := installExes(log, fl.Version, hash, "root"); err != nil {
 		return errorf("%s", err)
 	}
 
@@ -121,13 +137,13 @@ func (fl *Flower) Configure() error {
 	errorf := makeErrorf(Name + ".configure")
 	log := slog.With("flower", Name+".configure")
 
-	tmpDir, err := os.MkdirTemp("", "florist-tailscale")
+	tmpDir, err := florist.MkdirTemp("", "florist-tailscale")
 	if err != nil {
 		return errorf("creating temporary dir for tailscale auth key: %s", err)
 	}
 	keyFile := filepath.Join(tmpDir, "authkey")
 	defer func() {
-		if err := os.Remove(keyFile); err != nil {
+		if err := florist.Remove(keyFile); err != nil {
 			log.Error("remove-authkey-file", "path", keyFile, "err", err)
 		} else {
 			log.Debug("remove-authkey-file", "path", keyFile)
@@ -178,17 +194,15 @@ func installExes(
 	owner string,
 ) error {
 	log.Info("Download tailscale package")
-	nameVersArch := fmt.Sprintf("tailscale_%s_amd64", version)
-	url := fmt.Sprintf("https://pkgs.tailscale.com/stable/%s.tgz", nameVersArch)
-	client := &http.Client{Timeout: 30 * time.Second}
-	tarPath, err := florist.NetFetch(client, url, florist.SHA256, hash,
+	nameVersArch := fmt.Sprintf("tailscale_%s_%s", version, platform.MachineArch())
+	tarPath, err := newArtifact(version, hash).Fetch(florist.NewNetClient(),
 		florist.WorkDir)
 	if err != nil {
 		return err
 	}
 
 	workdir := path.Join(florist.WorkDir, Name)
-	if err := os.MkdirAll(workdir, 0o755); err != nil {
+	if err := florist.MkdirAll(workdir, 0o755); err != nil {
 		return err
 	}
 
@@ -236,3 +250,10 @@ func makeErrorf(prefix string) func(format string, a ...any) error {
 		return fmt.Errorf(prefix+": "+format, a...)
 	}
 }
+
+// newArtifact returns the tailscale tarball for the machine architecture.
+func newArtifact(version string, hash string) florist.Artifact {
+	url := fmt.Sprintf("https://pkgs.tailscale.com/stable/tailscale_%s_%s.tgz",
+		version, platform.MachineArch())
+	return florist.Artifact{URL: url, Hash: hash}
+}
@@ -4,7 +4,6 @@ package timezone
 import (
 	"fmt"
 	"log/slog"
-	"os"
 	"path"
 
 	"github.com/creasty/defaults"
@@ -84,12 +83,12 @@ func (fl *Flower) Install() error {
 
 	// Remove the current linkname to allow the symlink. This might fail for
 	// multiple reasons. We hope for the best.
-	err = os.Remove(linkname)
+	err = florist.Remove(linkname)
 	if err != nil {
 		log.Debug("remove-linkname", "linkname", linkname, "err", err)
 	}
 
-	if err := os.Symlink(target, linkname); err != nil {
+	if err := florist.Symlink(target, linkname); err != nil {
 		return fmt.Errorf("%s.install: symlink: %s", Name, err)
 	}
 	log.Info("installed", "timezone-localtime", fl.Timezone)
@@ -0,0 +1,30 @@
+package timezone_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/florist/flowers/timezone"
+	"github.com/marco-m/florist/pkg/flowertest"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestTimezoneInstallSuccess(t *testing.T) {
+	h := flowertest.New(t)
+	h.WriteFile("/usr/share/zoneinfo/Europe/Zurich", "TZif")
+
+	fl := &timezone.Flower{Inst: timezone.Inst{Timezone: "Europe/Zurich"}}
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	h.AssertSymlink("/etc/localtime", "/usr/share/zoneinfo/Europe/Zurich")
+}
+
+func TestTimezoneInstallFailure(t *testing.T) {
+	h := flowertest.New(t)
+
+	fl := &timezone.Flower{Inst: timezone.Inst{Timezone: "Europe/Atlantis"}}
+	err := h.Install(fl)
+	assert.ErrorContains(t, err,
+		`timezone.install: timezone "/usr/share/zoneinfo/Europe/Atlantis" does not exist`,
+		"h.Install")
+}
@@ -3,14 +3,24 @@ module github.com/marco-m/florist
 go 1.26
 
 require (
+	github.com/ProtonMail/go-crypto v1.3.0
 	github.com/cakturk/go-netstat v0.0.0-20200220111822-e5b49efee7a5
 	github.com/creasty/defaults v1.8.0
 	github.com/google/go-cmp v0.7.0
+	github.com/klauspost/compress v1.18.0
 	github.com/marco-m/clim v0.1.4
 	github.com/marco-m/rosina v0.3.0
+	github.com/santhosh-tekuri/jsonschema/v6 v6.0.2
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.54.0
 )
 
-require github.com/alecthomas/repr v0.5.4 // indirect
+require (
+	github.com/alecthomas/repr v0.5.4 // indirect
+	github.com/cloudflare/circl v1.6.1 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+)
 
 retract (
 	v0.4.3
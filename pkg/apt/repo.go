@@ -3,12 +3,9 @@ package apt
 import (
 	"fmt"
 	"log/slog"
-	"net/http"
-	"os"
 	"path"
 	"path/filepath"
 	"runtime"
-	"time"
 
 	"github.com/marco-m/florist/internal"
 	"github.com/marco-m/florist/pkg/florist"
@@ -35,7 +32,7 @@ func AddRepo(name string, keyURL string, keyHash string, repoURL string) error {
 	errorf, log := internal.MakeErrorfAndLog("apt.AddRepo", slog.Default())
 
 	log.Info("Download PGP key", "url", keyURL)
-	client := &http.Client{Timeout: 15 * time.Second}
+	client := florist.NewNetClient()
 	keyPath, err := florist.NetFetch(client, keyURL, florist.SHA256, keyHash, florist.WorkDir)
 	if err != nil {
 		return errorf("%s", err)
@@ -60,7 +57,7 @@ func AddRepo(name string, keyURL string, keyHash string, repoURL string) error {
 
 	repoListDir := "/etc/apt/sources.list.d/"
 	repoListPath := path.Join(repoListDir, name+".list")
-	if err := os.MkdirAll(repoListDir, 0o755); err != nil {
+	if err := florist.MkdirAll(repoListDir, 0o755); err != nil {
 		return errorf("%s", err)
 	}
 
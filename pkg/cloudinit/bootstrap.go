@@ -0,0 +1,228 @@
+package cloudinit
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+// Default paths of [Bootstrap]. DefaultSettingsPath is also the default of flag
+// --settings of the configure subcommand.
+var (
+	DefaultProvisionerPath = path.Join(florist.HomeDir, "provisioner")
+	DefaultSettingsPath    = path.Join(florist.HomeDir, "config.json")
+	// BootstrapScriptPath is the script, run by cloud-init, that runs the provisioner.
+	BootstrapScriptPath = path.Join(florist.HomeDir, "bootstrap.sh")
+	// BootstrapStatusPath contains the outcome of the bootstrap script: "success" or
+	// "failure: " followed by the failed command.
+	BootstrapStatusPath = path.Join(florist.HomeDir, "bootstrap-status")
+)
+
+// UserDataLimits are the maximum sizes, in bytes, of the user-data accepted by some
+// cloud providers, before any base64 encoding done by the API clients. See
+// [CheckSize].
+var UserDataLimits = map[string]int{
+	// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/user-data.html
+	"aws": 16 * 1024,
+	// https://docs.digitalocean.com/products/droplets/how-to/provide-user-data/
+	"digitalocean": 64 * 1024,
+	// https://cloud.google.com/compute/docs/metadata/overview#custom
+	"gcp": 256 * 1024,
+	// https://docs.hetzner.cloud/#servers-create-a-server
+	"hetzner": 32 * 1024,
+}
+
+// Bootstrap describes a machine that provisions itself at first boot with a florist
+// provisioner: cloud-init writes the provisioner and its settings, then runs the
+// install and configure subcommands. Call [Bootstrap.CloudConfig] or
+// [Bootstrap.Render].
+//
+// The provisioner is either embedded in the user-data (Provisioner) or downloaded
+// (ProvisionerURL). Since a provisioner is in the order of megabytes even when
+// compressed, embedding it exceeds the user-data limits of most cloud providers (see
+// [UserDataLimits]); it is meant mostly for local VMs.
+type Bootstrap struct {
+	// Contents of the provisioner executable, to embed in the user-data.
+	Provisioner []byte
+	// URL of the provisioner executable, to download at boot instead of embedding
+	// it. Requires ProvisionerSHA256.
+	ProvisionerURL string
+	// Hex-encoded SHA-256 of the file at ProvisionerURL.
+	ProvisionerSHA256 string
+	// Contents of the settings file (JSON). Optional.
+	Settings []byte
+	// Where to write the provisioner. Default: DefaultProvisionerPath.
+	ProvisionerPath string
+	// Where to write the settings. Default: DefaultSettingsPath.
+	SettingsPath string
+	// Additional arguments for the provisioner, before the subcommand (for example
+	// "--log-level=debug").
+	Args []string
+}
+
+// CloudConfig returns the cloud-config that bootstraps the provisioner. The caller can
+// modify it before rendering it.
+func (bs Bootstrap) CloudConfig() (CloudConfig, error) {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("cloudinit.Bootstrap: "+format, a...)
+	}
+	provPath := cmp.Or(bs.ProvisionerPath, DefaultProvisionerPath)
+	settingsPath := cmp.Or(bs.SettingsPath, DefaultSettingsPath)
+
+	var cfg CloudConfig
+	var script bytes.Buffer
+	fmt.Fprintf(&script, bootstrapScriptHeader, shellQuote(BootstrapStatusPath))
+
+	switch {
+	case len(bs.Provisioner) > 0 && bs.ProvisionerURL != "":
+		return CloudConfig{}, errorf("Provisioner and ProvisionerURL are mutually exclusive")
+	case len(bs.Provisioner) > 0:
+		content, err := gzipBase64(bs.Provisioner)
+		if err != nil {
+			return CloudConfig{}, errorf("%s", err)
+		}
+		cfg.WriteFiles = append(cfg.WriteFiles, WriteFile{
+			Path:        provPath,
+			Content:     content,
+			Permissions: "0755",
+			Encoding:    "gz+b64",
+		})
+	case bs.ProvisionerURL != "":
+		if len(bs.ProvisionerSHA256) != 64 {
+			return CloudConfig{}, errorf("ProvisionerURL requires ProvisionerSHA256")
+		}
+		fmt.Fprintf(&script, "run curl --fail --silent --show-error --location --retry 5 "+
+			"--create-dirs --output %s %s\n", shellQuote(provPath), shellQuote(bs.ProvisionerURL))
+		sumPath := shellQuote(provPath + ".sha256")
+		fmt.Fprintf(&script, "echo %s > %s\n", shellQuote(bs.ProvisionerSHA256+"  "+provPath),
+			sumPath)
+		fmt.Fprintf(&script, "run sha256sum --check --strict %s\n", sumPath)
+		fmt.Fprintf(&script, "run chmod 0755 %s\n", shellQuote(provPath))
+	default:
+		return CloudConfig{}, errorf("one of Provisioner or ProvisionerURL is required")
+	}
+
+	if len(bs.Settings) > 0 {
+		cfg.WriteFiles = append(cfg.WriteFiles, WriteFile{
+			Path:        settingsPath,
+			Content:     string(bs.Settings),
+			Permissions: "0600",
+		})
+	}
+
+	install := slices.Concat([]string{provPath}, bs.Args, []string{"install"})
+	configure := slices.Concat([]string{provPath}, bs.Args,
+		[]string{"configure", "--settings=" + settingsPath})
+	fmt.Fprintf(&script, "run %s\n", shellJoin(install))
+	fmt.Fprintf(&script, "run %s\n", shellJoin(configure))
+	script.WriteString(bootstrapScriptFooter)
+
+	cfg.WriteFiles = append(cfg.WriteFiles, WriteFile{
+		Path:        BootstrapScriptPath,
+		Content:     script.String(),
+		Permissions: "0755",
+	})
+	cfg.RunCmd = append(cfg.RunCmd, BootstrapScriptPath)
+	return cfg, nil
+}
+
+// Render returns the rendered and validated cloud-config that bootstraps the
+// provisioner (see [Bootstrap.CloudConfig]). If provider is not empty, it also
+// checks the size against the user-data limit of provider (see [CheckSize]).
+func (bs Bootstrap) Render(provider string) ([]byte, error) {
+	cfg, err := bs.CloudConfig()
+	if err != nil {
+		return nil, err
+	}
+	userData, err := cfg.Render()
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateUserData(userData); err != nil {
+		return nil, err
+	}
+	if provider == "" {
+		return userData, nil
+	}
+	if err := CheckSize(userData, provider); err != nil {
+		return nil, err
+	}
+	return userData, nil
+}
+
+// CheckSize returns an error if userData exceeds the user-data limit of provider, one
+// of the keys of [UserDataLimits].
+func CheckSize(userData []byte, provider string) error {
+	limit, found := UserDataLimits[provider]
+	if !found {
+		providers := make([]string, 0, len(UserDataLimits))
+		for k := range UserDataLimits {
+			providers = append(providers, k)
+		}
+		slices.Sort(providers)
+		return fmt.Errorf("cloudinit.CheckSize: unknown provider %q (want one of: %s)",
+			provider, strings.Join(providers, ", "))
+	}
+	if len(userData) > limit {
+		return fmt.Errorf("cloudinit.CheckSize: user-data too big for %s: %d bytes (limit: %d)",
+			provider, len(userData), limit)
+	}
+	return nil
+}
+
+const bootstrapScriptHeader = `#!/bin/sh
+# Generated by florist. Run by cloud-init at first boot.
+
+status=%s
+
+run() {
+    echo "florist-bootstrap: running: $*"
+    if ! "$@"; then
+        echo "failure: $*" > "$status"
+        echo "florist-bootstrap: failure: $*" >&2
+        exit 1
+    fi
+}
+
+`
+
+const bootstrapScriptFooter = `
+echo success > "$status"
+echo "florist-bootstrap: success"
+`
+
+func gzipBase64(data []byte) (string, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// shellJoin quotes each element of args for the shell and joins them.
+func shellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes s for the shell, using single quotes.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,159 @@
+package cloudinit_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/cloudinit"
+)
+
+func TestBootstrapEmbedded(t *testing.T) {
+	bs := cloudinit.Bootstrap{
+		Provisioner: []byte("#!/bin/true\n"),
+		Settings:    []byte(`{"color": "red"}`),
+		Args:        []string{"--log-level=debug"},
+	}
+
+	userData, err := bs.Render("aws")
+	assert.NoError(t, err, "bs.Render")
+
+	cfg := parse(t, userData)
+	assert.DeepEqual(t, cfg.RunCmd, []string{"/opt/florist/bootstrap.sh"}, "runcmd")
+	assert.Equal(t, len(cfg.WriteFiles), 3, "write_files")
+
+	prov := cfg.WriteFiles[0]
+	assert.Equal(t, prov.Path, "/opt/florist/provisioner", "path")
+	assert.Equal(t, prov.Encoding, "gz+b64", "encoding")
+	assert.Equal(t, prov.Permissions, "0755", "permissions")
+	assert.Equal(t, gunzipBase64(t, prov.Content), "#!/bin/true\n", "provisioner")
+
+	settings := cfg.WriteFiles[1]
+	assert.Equal(t, settings.Path, "/opt/florist/config.json", "path")
+	assert.Equal(t, settings.Content, `{"color": "red"}`, "settings")
+	assert.Equal(t, settings.Permissions, "0600", "permissions")
+
+	script := cfg.WriteFiles[2]
+	assert.Equal(t, script.Path, "/opt/florist/bootstrap.sh", "path")
+	wantCmds := `
+run '/opt/florist/provisioner' '--log-level=debug' 'install'
+run '/opt/florist/provisioner' '--log-level=debug' 'configure' '--settings=/opt/florist/config.json'
+`
+	assert.True(t, strings.Contains(script.Content, wantCmds), "script:\n"+script.Content)
+	assert.True(t, strings.Contains(script.Content, "status='/opt/florist/bootstrap-status'"),
+		"script:\n"+script.Content)
+	assert.True(t, !strings.Contains(script.Content, "curl"), "script:\n"+script.Content)
+}
+
+func TestBootstrapDownload(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	bs := cloudinit.Bootstrap{
+		ProvisionerURL:    "https://example.com/prov",
+		ProvisionerSHA256: sum,
+		ProvisionerPath:   "/usr/local/bin/prov",
+	}
+
+	cfg, err := bs.CloudConfig()
+	assert.NoError(t, err, "bs.CloudConfig")
+
+	assert.Equal(t, len(cfg.WriteFiles), 1, "write_files")
+	script := cfg.WriteFiles[0].Content
+	wantCmds := `
+run curl --fail --silent --show-error --location --retry 5 --create-dirs --output '/usr/local/bin/prov' 'https://example.com/prov'
+echo '` + sum + `  /usr/local/bin/prov' > '/usr/local/bin/prov.sha256'
+run sha256sum --check --strict '/usr/local/bin/prov.sha256'
+run chmod 0755 '/usr/local/bin/prov'
+run '/usr/local/bin/prov' 'install'
+run '/usr/local/bin/prov' 'configure' '--settings=/opt/florist/config.json'
+`
+	assert.True(t, strings.Contains(script, wantCmds), "script:\n"+script)
+}
+
+func TestBootstrapFailure(t *testing.T) {
+	type testCase struct {
+		name     string
+		bs       cloudinit.Bootstrap
+		provider string
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := tc.bs.Render(tc.provider)
+
+		assert.ErrorContains(t, err, tc.wantErr, "bs.Render")
+	}
+
+	testCases := []testCase{
+		{
+			name:    "no provisioner",
+			wantErr: "cloudinit.Bootstrap: one of Provisioner or ProvisionerURL is required",
+		},
+		{
+			name: "both provisioner and URL",
+			bs: cloudinit.Bootstrap{
+				Provisioner:    []byte("x"),
+				ProvisionerURL: "https://example.com/prov",
+			},
+			wantErr: "cloudinit.Bootstrap: Provisioner and ProvisionerURL are mutually exclusive",
+		},
+		{
+			name:    "URL without hash",
+			bs:      cloudinit.Bootstrap{ProvisionerURL: "https://example.com/prov"},
+			wantErr: "cloudinit.Bootstrap: ProvisionerURL requires ProvisionerSHA256",
+		},
+		{
+			name:     "too big",
+			bs:       cloudinit.Bootstrap{Provisioner: random(t, 20*1024)},
+			provider: "aws",
+			wantErr:  "cloudinit.CheckSize: user-data too big for aws: ",
+		},
+		{
+			name:     "unknown provider",
+			bs:       cloudinit.Bootstrap{Provisioner: []byte("x")},
+			provider: "nope",
+			wantErr: `cloudinit.CheckSize: unknown provider "nope" ` +
+				"(want one of: aws, digitalocean, gcp, hetzner)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+// parse parses the output of CloudConfig.Render.
+func parse(t *testing.T, userData []byte) cloudinit.CloudConfig {
+	t.Helper()
+	data, found := bytes.CutPrefix(userData, []byte("#cloud-config\n"))
+	assert.True(t, found, "#cloud-config header")
+	var cfg cloudinit.CloudConfig
+	assert.NoError(t, json.Unmarshal(data, &cfg), "json.Unmarshal")
+	return cfg
+}
+
+func gunzipBase64(t *testing.T, content string) string {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(content)
+	assert.NoError(t, err, "base64 decode")
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err, "gzip.NewReader")
+	buf, err := io.ReadAll(zr)
+	assert.NoError(t, err, "io.ReadAll")
+	return string(buf)
+}
+
+// random returns n random bytes, which do not compress.
+func random(t *testing.T, n int) []byte {
+	t.Helper()
+	buf := make([]byte, n)
+	_, err := rand.Read(buf)
+	assert.NoError(t, err, "rand.Read")
+	return buf
+}
@@ -4,6 +4,7 @@
 package cloudinit
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
@@ -25,6 +26,12 @@ import (
 //
 // [1]: https://cloudinit.readthedocs.io/en/latest/explanation/about-cloud-config.html
 type CloudConfig struct {
+	// Run arbitrary commands early in the boot process, at every boot (not only the
+	// first). Each item is either passed to sh (if it is a string) or executed as
+	// with execve(3). Output goes to the console.
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#bootcmd
+	BootCmd []string `json:"bootcmd,omitzero"`
+
 	// Run arbitrary commands at a rc.local-like time-frame with output to the
 	// console. The items will be executed as if passed to execve(3) (with the
 	// first argument as the command). The 'runcmd' module only writes the
@@ -42,23 +49,77 @@ type CloudConfig struct {
 	SshDeleteKeys bool `json:"ssh_deletekeys,omitzero"`
 	// The SSH key types to generate. Default: [rsa, ecdsa, ed25519].
 	SshGenKeyTypes []string `json:"ssh_genkeytypes,omitzero"`
+	// Pre-generated host keys to install, instead of generating them. See [SshKeys].
+	SshKeys *SshKeys `json:"ssh_keys,omitzero"`
 
 	// Write arbitrary files.
 	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#write-files
 	WriteFiles []WriteFile `json:"write_files,omitzero"`
+
+	//
+	// Users and groups
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#users-and-groups
+	//
+	// Groups to create.
+	Groups []Group `json:"groups,omitzero"`
+	// Users to create. If set, the default user of the distro is not created unless
+	// listed as User{Name: "default"}. Default: the default user of the distro.
+	Users []User `json:"users,omitzero"`
+
+	//
+	// Package Update Upgrade Install
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#package-update-upgrade-install
+	//
+	// Packages to install. Setting this also implies PackageUpdate.
+	Packages []string `json:"packages,omitzero"`
+	// Update the package database (apt-get update). Default: false.
+	PackageUpdate bool `json:"package_update,omitzero"`
+	// Upgrade the installed packages. Default: false.
+	PackageUpgrade bool `json:"package_upgrade,omitzero"`
+
+	// Entries to add to /etc/fstab, also mounted.
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#mounts
+	Mounts []Mount `json:"mounts,omitzero"`
+
+	//
+	// Set Hostname
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#set-hostname
+	//
+	// The hostname. Default: from the datasource (usually, the instance name).
+	Hostname string `json:"hostname,omitzero"`
+	// The fully qualified domain name. Takes precedence over Hostname.
+	Fqdn string `json:"fqdn,omitzero"`
+
+	// The timezone, as a path relative to /usr/share/zoneinfo (for example
+	// "Europe/Zurich").
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#timezone
+	Timezone string `json:"timezone,omitzero"`
+
+	// The system locale (for example "en_US.UTF-8"). Default: en_US.UTF-8.
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#locale
+	Locale string `json:"locale,omitzero"`
+
+	// Power off or reboot at the end of cloud-init.
+	// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#power-state-change
+	PowerState *PowerState `json:"power_state,omitzero"`
 }
 
 // Render returns the cloud-config object as JSON (which is valid YAML).
 //
 // NOTE The output of Render can still be an invalid cloud-config file, exactly
 // as you could write by hand a syntactically valid YAML file that is an invalid
-// cloud-config file.
+// cloud-config file. Use [CloudConfig.Validate] to catch most mistakes.
 func (cfg CloudConfig) Render() ([]byte, error) {
-	data, err := json.MarshalIndent(cfg, "", "  ")
-	if err != nil {
+	var buf bytes.Buffer
+	buf.WriteString("#cloud-config\n")
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	// Keep shell redirections such as ">" readable.
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(cfg); err != nil {
 		return nil, fmt.Errorf("cloud-config: encoding to JSON: %s", err)
 	}
-	return append([]byte("#cloud-config\n"), data...), nil
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 // Write a file.
@@ -80,3 +141,114 @@ type WriteFile struct {
 	// b64, base64.
 	Encoding string `json:"encoding,omitzero"`
 }
+
+// Host keys for sshd, in OpenSSH format.
+// https://cloudinit.readthedocs.io/en/latest/reference/modules.html#ssh
+//
+// The Ed25519 fields correspond to the settings SshHostEd25519Key,
+// SshHostEd25519KeyPub and SshHostEd25519KeyCertPub of the sshd flower, so the same
+// keys can be installed at first boot by cloud-init and later by the flower.
+type SshKeys struct {
+	Ed25519Private     string `json:"ed25519_private,omitzero"`
+	Ed25519Public      string `json:"ed25519_public,omitzero"`
+	Ed25519Certificate string `json:"ed25519_certificate,omitzero"`
+	EcdsaPrivate       string `json:"ecdsa_private,omitzero"`
+	EcdsaPublic        string `json:"ecdsa_public,omitzero"`
+	EcdsaCertificate   string `json:"ecdsa_certificate,omitzero"`
+	RsaPrivate         string `json:"rsa_private,omitzero"`
+	RsaPublic          string `json:"rsa_public,omitzero"`
+	RsaCertificate     string `json:"rsa_certificate,omitzero"`
+}
+
+// Group to create, with optional members.
+type Group struct {
+	Name    string
+	Members []string
+}
+
+// MarshalJSON renders the group as "name" if it has no members, else as
+// {"name": [members]}.
+func (g Group) MarshalJSON() ([]byte, error) {
+	if len(g.Members) == 0 {
+		return json.Marshal(g.Name)
+	}
+	return json.Marshal(map[string][]string{g.Name: g.Members})
+}
+
+// User to create.
+type User struct {
+	// The user name. The special name "default" denotes the default user of the
+	// distro, and all the other fields are ignored.
+	Name string `json:"name"`
+	// The user's real name.
+	Gecos string `json:"gecos,omitzero"`
+	// Home directory. Default: /home/<name>.
+	HomeDir string `json:"homedir,omitzero"`
+	// Login shell. Default: the default of useradd.
+	Shell string `json:"shell,omitzero"`
+	// Primary group. Default: a new group named as the user.
+	PrimaryGroup string `json:"primary_group,omitzero"`
+	// Supplementary groups, comma-separated.
+	Groups string `json:"groups,omitzero"`
+	// Sudo rules, for example "ALL=(ALL) NOPASSWD:ALL". Default: no sudo.
+	Sudo []string `json:"sudo,omitzero"`
+	// Public keys to add to ~/.ssh/authorized_keys.
+	SshAuthorizedKeys []string `json:"ssh_authorized_keys,omitzero"`
+	// Lock the password, disabling password login. Default: true.
+	LockPasswd *bool `json:"lock_passwd,omitzero"`
+	// Create a system user, without home directory. Default: false.
+	System bool `json:"system,omitzero"`
+	// Do not create the home directory. Default: false.
+	NoCreateHome bool `json:"no_create_home,omitzero"`
+}
+
+// MarshalJSON renders the default user as "default".
+func (u User) MarshalJSON() ([]byte, error) {
+	if u.Name == "default" {
+		return json.Marshal(u.Name)
+	}
+	type plain User // Avoid infinite recursion.
+	return json.Marshal(plain(u))
+}
+
+// Mount is an entry of /etc/fstab. Only Spec and File are required; cloud-init uses
+// default values for the other fields.
+type Mount struct {
+	// The device or filesystem to mount (for example "/dev/sdb" or "LABEL=data").
+	Spec string
+	// The mount point.
+	File string
+	// The filesystem type (for example "ext4"). Default: auto.
+	Type string
+	// Mount options. Default: "defaults,nofail,x-systemd.after=cloud-init.service".
+	Options string
+	// Dump frequency. Default: "0".
+	Freq string
+	// fsck pass number. Default: "2".
+	PassNo string
+}
+
+// MarshalJSON renders the mount as a list of fields, as in /etc/fstab, omitting the
+// trailing empty fields.
+func (m Mount) MarshalJSON() ([]byte, error) {
+	fields := []string{m.Spec, m.File, m.Type, m.Options, m.Freq, m.PassNo}
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return json.Marshal(fields)
+}
+
+// PowerState changes the power state at the end of cloud-init.
+type PowerState struct {
+	// One of: poweroff, reboot, halt.
+	Mode string `json:"mode"`
+	// Delay, as accepted by shutdown(8): "now" or "+N" minutes. Default: "now".
+	Delay string `json:"delay,omitzero"`
+	// Message to log and to broadcast.
+	Message string `json:"message,omitzero"`
+	// Time in seconds to wait for cloud-init to finish before changing the power
+	// state. Default: 30.
+	Timeout int `json:"timeout,omitzero"`
+	// Command that must succeed to change the power state. Default: always.
+	Condition string `json:"condition,omitzero"`
+}
@@ -0,0 +1,262 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// This file contains a minimal ISO9660 writer, with the Joliet extension, able to
+// write the few files of a NoCloud seed in the root directory. We cannot use the
+// existing Go libraries, since they mangle the file names to the ISO9660 8.3
+// uppercase format, while cloud-init wants "user-data" and "meta-data". The Joliet
+// extension preserves the names (Linux uses it when mounting), as done by
+// "genisoimage -joliet".
+//
+// References: ECMA-119 (ISO9660) and the Joliet specification.
+
+const (
+	isoSectorSize = 2048
+	// The first 16 sectors are the system area, unused.
+	isoSystemSectors = 16
+)
+
+// isoFile is a file in the root directory of the image.
+type isoFile struct {
+	name string
+	data []byte
+}
+
+// writeISO9660 writes to w an ISO9660 image with volume identifier volID and files
+// in the root directory, sorted by name.
+//
+// Layout, in sectors:
+//
+//	0-15  system area
+//	16    primary volume descriptor
+//	17    supplementary volume descriptor (Joliet)
+//	18    volume descriptor set terminator
+//	19-22 path tables: primary L and M, Joliet L and M
+//	23    primary root directory
+//	24    Joliet root directory
+//	25-   file data
+func writeISO9660(w io.Writer, volID string, files []isoFile, now time.Time) error {
+	const (
+		pvdSector       = isoSystemSectors
+		svdSector       = pvdSector + 1
+		termSector      = svdSector + 1
+		pathTableSector = termSector + 1
+		rootSector      = pathTableSector + 4
+		jolietSector    = rootSector + 1
+		dataSector      = jolietSector + 1
+	)
+
+	// ECMA-119 and Joliet require the directory records sorted by identifier.
+	files = slices.SortedFunc(slices.Values(files), func(a, b isoFile) int {
+		return strings.Compare(a.name, b.name)
+	})
+	extents := make([]uint32, len(files))
+	next := uint32(dataSector)
+	for i, file := range files {
+		if len(file.name) > 64 {
+			return fmt.Errorf("ISO9660: file name too long: %s", file.name)
+		}
+		extents[i] = next
+		next += sectors(len(file.data))
+	}
+	totalSectors := next
+
+	primaryName := func(name string) []byte {
+		// Level 2 identifier: d-characters, a dot and the version.
+		name = strings.ToUpper(name)
+		name = strings.Map(func(r rune) rune {
+			if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+				return r
+			}
+			return '_'
+		}, name)
+		return []byte(name + ".;1")
+	}
+	jolietName := func(name string) []byte {
+		return ucs2(name)
+	}
+
+	root := func(sector uint32, fileName func(string) []byte) ([]byte, error) {
+		var dir bytes.Buffer
+		dir.Write(dirRecord([]byte{0}, sector, isoSectorSize, true, now))
+		dir.Write(dirRecord([]byte{1}, sector, isoSectorSize, true, now))
+		for i, file := range files {
+			dir.Write(dirRecord(fileName(file.name), extents[i], uint32(len(file.data)),
+				false, now))
+		}
+		if dir.Len() > isoSectorSize {
+			return nil, fmt.Errorf("ISO9660: too many files")
+		}
+		return dir.Bytes(), nil
+	}
+	primaryRoot, err := root(rootSector, primaryName)
+	if err != nil {
+		return err
+	}
+	jolietRoot, err := root(jolietSector, jolietName)
+	if err != nil {
+		return err
+	}
+
+	img := make([]byte, 0, int(totalSectors)*isoSectorSize)
+	img = append(img, make([]byte, isoSystemSectors*isoSectorSize)...)
+	img = appendSector(img, volumeDescriptor(1, volID, totalSectors,
+		pathTableSector, rootSector, now))
+	img = appendSector(img, volumeDescriptor(2, volID, totalSectors,
+		pathTableSector+2, jolietSector, now))
+	img = appendSector(img, []byte{255, 'C', 'D', '0', '0', '1', 1})
+	img = appendSector(img, pathTable(binary.LittleEndian, rootSector))
+	img = appendSector(img, pathTable(binary.BigEndian, rootSector))
+	img = appendSector(img, pathTable(binary.LittleEndian, jolietSector))
+	img = appendSector(img, pathTable(binary.BigEndian, jolietSector))
+	img = appendSector(img, primaryRoot)
+	img = appendSector(img, jolietRoot)
+	for _, file := range files {
+		img = appendSector(img, file.data)
+	}
+
+	_, err = w.Write(img)
+	return err
+}
+
+// volumeDescriptor returns a primary (kind 1) or Joliet supplementary (kind 2)
+// volume descriptor.
+func volumeDescriptor(kind byte, volID string, totalSectors, pathTableSector,
+	rootSector uint32, now time.Time,
+) []byte {
+	vd := make([]byte, isoSectorSize)
+	vd[0] = kind
+	copy(vd[1:6], "CD001")
+	vd[6] = 1
+	text := func(field []byte, s string) {
+		if kind == 1 {
+			copy(field, padRight([]byte(s), len(field), ' '))
+		} else {
+			copy(field, padRight(ucs2(s), len(field), 0, ' '))
+		}
+	}
+	text(vd[8:40], "")     // system identifier
+	text(vd[40:72], volID) // volume identifier
+	putBoth32(vd[80:88], totalSectors)
+	if kind == 2 {
+		// Escape sequence for UCS-2 level 3.
+		copy(vd[88:91], "%/E")
+	}
+	putBoth16(vd[120:124], 1) // volume set size
+	putBoth16(vd[124:128], 1) // volume sequence number
+	putBoth16(vd[128:132], isoSectorSize)
+	putBoth32(vd[132:140], pathTableSize)
+	binary.LittleEndian.PutUint32(vd[140:144], pathTableSector)
+	binary.BigEndian.PutUint32(vd[148:152], pathTableSector+1)
+	copy(vd[156:190], dirRecord([]byte{0}, rootSector, isoSectorSize, true, now))
+	for _, field := range [][2]int{
+		{190, 318}, // volume set
+		{318, 446}, // publisher
+		{446, 574}, // data preparer
+		{574, 702}, // application
+		{702, 739}, // copyright file
+		{739, 776}, // abstract file
+		{776, 813}, // bibliographic file
+	} {
+		text(vd[field[0]:field[1]], "")
+	}
+	copy(vd[813:830], decDateTime(now)) // creation
+	copy(vd[830:847], decDateTime(now)) // modification
+	copy(vd[847:864], decDateTime(time.Time{}))
+	copy(vd[864:881], decDateTime(now)) // effective
+	vd[881] = 1                         // file structure version
+	return vd
+}
+
+// pathTableSize is the size of a path table with only the root directory.
+const pathTableSize = 10
+
+func pathTable(order binary.ByteOrder, rootSector uint32) []byte {
+	pt := make([]byte, pathTableSize)
+	pt[0] = 1 // length of the directory identifier
+	order.PutUint32(pt[2:6], rootSector)
+	order.PutUint16(pt[6:8], 1) // parent directory number
+	return pt
+}
+
+// dirRecord returns a directory record.
+func dirRecord(id []byte, extent, size uint32, isDir bool, now time.Time) []byte {
+	length := 33 + len(id)
+	if length%2 == 1 {
+		length++
+	}
+	rec := make([]byte, length)
+	rec[0] = byte(length)
+	putBoth32(rec[2:10], extent)
+	putBoth32(rec[10:18], size)
+	now = now.UTC()
+	copy(rec[18:25], []byte{
+		byte(now.Year() - 1900), byte(now.Month()), byte(now.Day()),
+		byte(now.Hour()), byte(now.Minute()), byte(now.Second()), 0,
+	})
+	if isDir {
+		rec[25] = 2
+	}
+	putBoth16(rec[28:32], 1) // volume sequence number
+	rec[32] = byte(len(id))
+	copy(rec[33:], id)
+	return rec
+}
+
+// decDateTime returns the date and time in the 17 bytes format of the volume
+// descriptors. The zero time means "not specified".
+func decDateTime(t time.Time) []byte {
+	if t.IsZero() {
+		return append([]byte(strings.Repeat("0", 16)), 0)
+	}
+	return append([]byte(t.UTC().Format("20060102150405")+"00"), 0)
+}
+
+func ucs2(s string) []byte {
+	var out []byte
+	for _, r := range utf16.Encode([]rune(s)) {
+		out = binary.BigEndian.AppendUint16(out, r)
+	}
+	return out
+}
+
+// padRight pads buf to size with the repeated pad sequence.
+func padRight(buf []byte, size int, pad ...byte) []byte {
+	for len(buf) < size {
+		buf = append(buf, pad...)
+	}
+	return buf[:size]
+}
+
+// putBoth16 writes v in both-byte order (little endian, then big endian).
+func putBoth16(buf []byte, v uint16) {
+	binary.LittleEndian.PutUint16(buf[0:2], v)
+	binary.BigEndian.PutUint16(buf[2:4], v)
+}
+
+// putBoth32 writes v in both-byte order (little endian, then big endian).
+func putBoth32(buf []byte, v uint32) {
+	binary.LittleEndian.PutUint32(buf[0:4], v)
+	binary.BigEndian.PutUint32(buf[4:8], v)
+}
+
+// appendSector appends data to img, padded to a multiple of the sector size.
+func appendSector(img []byte, data []byte) []byte {
+	img = append(img, data...)
+	return append(img, make([]byte, int(sectors(len(data)))*isoSectorSize-len(data))...)
+}
+
+// sectors returns the number of sectors needed for size bytes.
+func sectors(size int) uint32 {
+	return uint32((size + isoSectorSize - 1) / isoSectorSize)
+}
@@ -0,0 +1,160 @@
+package cloudinit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// MIME types of the parts of a multi-part user-data understood by cloud-init.
+// https://cloudinit.readthedocs.io/en/latest/explanation/format.html
+const (
+	ContentTypeCloudConfig = "text/cloud-config"
+	ContentTypeShellScript = "text/x-shellscript"
+	ContentTypeBoothook    = "text/cloud-boothook"
+	ContentTypeJinja       = "text/jinja2"
+	ContentTypeIncludeURL  = "text/x-include-url"
+	ContentTypePartHandler = "text/part-handler"
+)
+
+const jinjaHeader = "## template: jinja\n"
+
+// Part is a part of a multi-part user-data. See [MultiPart].
+type Part struct {
+	// One of the ContentType constants.
+	ContentType string
+	// Name of the part, shown in the cloud-init logs. For shell scripts, it is also
+	// the name of the script in /var/lib/cloud/instance/scripts.
+	Filename string
+	Content  []byte
+}
+
+// Part returns the rendered cloud-config as a part of a multi-part user-data.
+func (cfg CloudConfig) Part() (Part, error) {
+	data, err := cfg.Render()
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{
+		ContentType: ContentTypeCloudConfig,
+		Filename:    "cloud-config.yaml",
+		Content:     data,
+	}, nil
+}
+
+// ShellScriptPart returns a shell script to run once, at first boot, in the same
+// stage as runcmd.
+func ShellScriptPart(filename string, script string) Part {
+	return Part{
+		ContentType: ContentTypeShellScript,
+		Filename:    filename,
+		Content:     []byte(script),
+	}
+}
+
+// JinjaPart returns a Jinja template, rendered by cloud-init with the instance
+// data (for example {{ v1.local_hostname }}). After rendering, the content is
+// handled according to its first line, so it must start with "#cloud-config" or
+// "#!". The "## template: jinja" header is added if missing.
+func JinjaPart(filename string, template string) Part {
+	if !strings.HasPrefix(template, jinjaHeader) {
+		template = jinjaHeader + template
+	}
+	return Part{
+		ContentType: ContentTypeJinja,
+		Filename:    filename,
+		Content:     []byte(template),
+	}
+}
+
+// MultiPart returns a MIME multi-part user-data made of parts, processed by
+// cloud-init in order. The output is deterministic: the same parts give the same
+// output.
+func MultiPart(parts ...Part) ([]byte, error) {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("cloudinit.MultiPart: "+format, a...)
+	}
+	if len(parts) == 0 {
+		return nil, errorf("no parts")
+	}
+
+	// A boundary derived from the contents is deterministic and cannot appear in
+	// the contents (barring a hash collision).
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part.ContentType))
+		hash.Write([]byte(part.Filename))
+		hash.Write(part.Content)
+	}
+	boundary := "florist-" + hex.EncodeToString(hash.Sum(nil))[:32]
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return nil, errorf("%s", err)
+	}
+	for i, part := range parts {
+		if part.ContentType == "" {
+			return nil, errorf("part %d: missing ContentType", i)
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.ContentType+`; charset="utf-8"`)
+		header.Set("MIME-Version", "1.0")
+		if part.Filename != "" {
+			header.Set("Content-Disposition",
+				fmt.Sprintf("attachment; filename=%q", part.Filename))
+		}
+		content := part.Content
+		if isPrintableASCII(content) {
+			header.Set("Content-Transfer-Encoding", "7bit")
+		} else {
+			header.Set("Content-Transfer-Encoding", "base64")
+			content = wrapBase64(content)
+		}
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, errorf("%s", err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, errorf("%s", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, errorf("%s", err)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "Content-Type: multipart/mixed; boundary=%q\r\n", boundary)
+	out.WriteString("MIME-Version: 1.0\r\n\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// isPrintableASCII returns true if data can be sent with the 7bit encoding.
+func isPrintableASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= 0x80 || (b < 0x20 && b != '\n' && b != '\r' && b != '\t') {
+			return false
+		}
+	}
+	return true
+}
+
+// wrapBase64 returns data base64-encoded, in lines of 76 characters as required by
+// RFC 2045.
+func wrapBase64(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var out bytes.Buffer
+	for len(encoded) > 76 {
+		out.WriteString(encoded[:76])
+		out.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	out.WriteString(encoded)
+	return out.Bytes()
+}
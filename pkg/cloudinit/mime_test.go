@@ -0,0 +1,104 @@
+package cloudinit_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/cloudinit"
+)
+
+func TestMultiPart(t *testing.T) {
+	cfgPart, err := cloudinit.CloudConfig{RunCmd: []string{"echo hello"}}.Part()
+	assert.NoError(t, err, "cfg.Part")
+	blob := []byte{0x1f, 0x8b, 0x00, 0xff}
+	parts := []cloudinit.Part{
+		cfgPart,
+		cloudinit.ShellScriptPart("setup.sh", "#!/bin/sh\necho setup\n"),
+		cloudinit.JinjaPart("motd.sh", "#!/bin/sh\necho {{ v1.local_hostname }}\n"),
+		{ContentType: cloudinit.ContentTypeBoothook, Filename: "bin", Content: blob},
+	}
+
+	userData, err := cloudinit.MultiPart(parts...)
+	assert.NoError(t, err, "cloudinit.MultiPart")
+	again, err := cloudinit.MultiPart(parts...)
+	assert.NoError(t, err, "cloudinit.MultiPart")
+	assert.True(t, bytes.Equal(userData, again), "deterministic output")
+
+	msg, err := mail.ReadMessage(bytes.NewReader(userData))
+	assert.NoError(t, err, "mail.ReadMessage")
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.NoError(t, err, "mime.ParseMediaType")
+	assert.Equal(t, mediaType, "multipart/mixed", "media type")
+
+	type gotPart struct {
+		contentType string
+		filename    string
+		content     string
+	}
+	var got []gotPart
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err, "mr.NextPart")
+		content, err := io.ReadAll(part)
+		assert.NoError(t, err, "io.ReadAll")
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			content = decodeBase64(t, string(content))
+		}
+		got = append(got, gotPart{
+			contentType: part.Header.Get("Content-Type"),
+			filename:    part.FileName(),
+			content:     string(content),
+		})
+	}
+	want := []gotPart{
+		{
+			contentType: `text/cloud-config; charset="utf-8"`,
+			filename:    "cloud-config.yaml",
+			content:     string(cfgPart.Content),
+		},
+		{
+			contentType: `text/x-shellscript; charset="utf-8"`,
+			filename:    "setup.sh",
+			content:     "#!/bin/sh\necho setup\n",
+		},
+		{
+			contentType: `text/jinja2; charset="utf-8"`,
+			filename:    "motd.sh",
+			content:     "## template: jinja\n#!/bin/sh\necho {{ v1.local_hostname }}\n",
+		},
+		{
+			contentType: `text/cloud-boothook; charset="utf-8"`,
+			filename:    "bin",
+			content:     string(blob),
+		},
+	}
+	assert.DeepEqual(t, got, want, "parts")
+}
+
+func TestMultiPartFailure(t *testing.T) {
+	_, err := cloudinit.MultiPart()
+	assert.ErrorContains(t, err, "cloudinit.MultiPart: no parts", "MultiPart")
+
+	_, err = cloudinit.MultiPart(cloudinit.Part{Content: []byte("x")})
+	assert.ErrorContains(t, err, "cloudinit.MultiPart: part 0: missing ContentType",
+		"MultiPart")
+}
+
+func decodeBase64(t *testing.T, s string) []byte {
+	t.Helper()
+	// The decoder ignores the newlines.
+	buf, err := base64.StdEncoding.DecodeString(s)
+	assert.NoError(t, err, "base64 decode")
+	return buf
+}
@@ -0,0 +1,264 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// NetworkConfig is the network configuration, version 2 (the netplan format). Fill
+// the fields that you need, then call [NetworkConfig.Validate] and
+// [NetworkConfig.Render]. Pass the rendered output as the network-config of a
+// [Seed] or of a cloud provider that supports it.
+//
+// Only a subset of the fields is available, as for [CloudConfig].
+//
+// https://cloudinit.readthedocs.io/en/latest/reference/network-config-format-v2.html
+type NetworkConfig struct {
+	// Physical interfaces, by configuration ID. If the device has no Match, the ID
+	// is the interface name (for example "eth0").
+	Ethernets map[string]Ethernet `json:"ethernets,omitzero"`
+	// Bonds, by interface name.
+	Bonds map[string]Bond `json:"bonds,omitzero"`
+	// VLANs, by interface name.
+	Vlans map[string]Vlan `json:"vlans,omitzero"`
+}
+
+// Device contains the properties common to all the devices.
+type Device struct {
+	// Enable DHCP for IPv4. Default: false.
+	Dhcp4 bool `json:"dhcp4,omitzero"`
+	// Enable DHCP for IPv6. Default: false.
+	Dhcp6 bool `json:"dhcp6,omitzero"`
+	// Static addresses, in CIDR notation (for example "10.0.0.5/24").
+	Addresses []string `json:"addresses,omitzero"`
+	// Static routes.
+	Routes []Route `json:"routes,omitzero"`
+	// DNS servers and search domains.
+	Nameservers *Nameservers `json:"nameservers,omitzero"`
+	// Maximum Transmission Unit. Default: the default of the kernel.
+	Mtu int `json:"mtu,omitzero"`
+	// Do not wait for the device to come up at boot. Default: false.
+	Optional bool `json:"optional,omitzero"`
+}
+
+// Ethernet is a physical interface.
+type Ethernet struct {
+	// Select the interface by properties instead of by name.
+	Match *Match `json:"match,omitzero"`
+	// Rename the matched interface. Requires Match.
+	SetName string `json:"set-name,omitzero"`
+	Device
+}
+
+// Match selects physical interfaces. All the filled fields must match.
+type Match struct {
+	// Interface name; shell wildcards are supported.
+	Name string `json:"name,omitzero"`
+	// MAC address, for example "52:54:00:12:34:56".
+	MacAddress string `json:"macaddress,omitzero"`
+	// Kernel driver name; shell wildcards are supported.
+	Driver string `json:"driver,omitzero"`
+}
+
+// Bond aggregates interfaces.
+type Bond struct {
+	// Configuration IDs of the Ethernets in the bond.
+	Interfaces []string        `json:"interfaces"`
+	Parameters *BondParameters `json:"parameters,omitzero"`
+	Device
+}
+
+// BondModes are the valid values of [BondParameters].Mode.
+var BondModes = []string{
+	"balance-rr", "active-backup", "balance-xor", "broadcast", "802.3ad",
+	"balance-tlb", "balance-alb",
+}
+
+// BondParameters are the parameters of a [Bond].
+type BondParameters struct {
+	// One of [BondModes]. Default: balance-rr.
+	Mode string `json:"mode,omitzero"`
+	// Interval in milliseconds for the MII link monitoring. Default: 0 (disabled).
+	MiiMonitorInterval int `json:"mii-monitor-interval,omitzero"`
+	// The preferred interface, for active-backup.
+	Primary string `json:"primary,omitzero"`
+	// LACP rate, for 802.3ad: slow or fast. Default: slow.
+	LacpRate string `json:"lacp-rate,omitzero"`
+	// Hash policy for the balancing modes, for example layer3+4.
+	TransmitHashPolicy string `json:"transmit-hash-policy,omitzero"`
+}
+
+// Vlan is a VLAN on top of another interface.
+type Vlan struct {
+	// VLAN ID, from 0 to 4094.
+	ID int `json:"id"`
+	// Configuration ID of the underlying Ethernet or Bond.
+	Link string `json:"link"`
+	Device
+}
+
+// Route is a static route.
+type Route struct {
+	// Destination, in CIDR notation, or "default".
+	To string `json:"to"`
+	// Gateway address.
+	Via string `json:"via,omitzero"`
+	// Route metric. Default: the default of the kernel.
+	Metric int `json:"metric,omitzero"`
+	// The gateway is directly connected to the interface, even if not in the
+	// subnet of its addresses (as in Hetzner Cloud private networks).
+	OnLink bool `json:"on-link,omitzero"`
+}
+
+// Nameservers configures DNS.
+type Nameservers struct {
+	// IP addresses of the DNS servers.
+	Addresses []string `json:"addresses,omitzero"`
+	// Search domains.
+	Search []string `json:"search,omitzero"`
+}
+
+// Render returns the network configuration as JSON (which is valid YAML), with the
+// version key.
+func (nc NetworkConfig) Render() ([]byte, error) {
+	doc := struct {
+		Version int `json:"version"`
+		NetworkConfig
+	}{2, nc}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("network-config: encoding to JSON: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Validate checks the network configuration, returning all the problems found:
+// addresses and routes, references among devices, VLAN IDs and bond modes.
+func (nc NetworkConfig) Validate() error {
+	var problems []string
+	problemf := func(format string, a ...any) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if len(nc.Ethernets)+len(nc.Bonds)+len(nc.Vlans) == 0 {
+		problemf("no devices")
+	}
+	ids := make(map[string]string) // configuration ID -> kind
+	for _, id := range slices.Sorted(maps.Keys(nc.Ethernets)) {
+		ids[id] = "ethernets"
+	}
+	for _, kind := range []struct {
+		name string
+		ids  []string
+	}{
+		{"bonds", slices.Sorted(maps.Keys(nc.Bonds))},
+		{"vlans", slices.Sorted(maps.Keys(nc.Vlans))},
+	} {
+		for _, id := range kind.ids {
+			if other, found := ids[id]; found {
+				problemf("%s.%s: ID already used in %s", kind.name, id, other)
+			}
+			ids[id] = kind.name
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(nc.Ethernets)) {
+		eth := nc.Ethernets[id]
+		where := "ethernets." + id
+		if eth.Match != nil && eth.Match.MacAddress != "" {
+			if _, err := net.ParseMAC(eth.Match.MacAddress); err != nil {
+				problemf("%s.match.macaddress: %s", where, err)
+			}
+		}
+		if eth.SetName != "" && eth.Match == nil {
+			problemf("%s.set-name: requires match", where)
+		}
+		eth.Device.validate(where, problemf)
+	}
+
+	bonded := make(map[string]string) // ethernet ID -> bond ID
+	for _, id := range slices.Sorted(maps.Keys(nc.Bonds)) {
+		bond := nc.Bonds[id]
+		where := "bonds." + id
+		if len(bond.Interfaces) == 0 {
+			problemf("%s.interfaces: empty", where)
+		}
+		for _, iface := range bond.Interfaces {
+			if _, found := nc.Ethernets[iface]; !found {
+				problemf("%s.interfaces: %s: not in ethernets", where, iface)
+			}
+			if other, found := bonded[iface]; found {
+				problemf("%s.interfaces: %s: already in bond %s", where, iface, other)
+			}
+			bonded[iface] = id
+		}
+		if params := bond.Parameters; params != nil {
+			if params.Mode != "" && !slices.Contains(BondModes, params.Mode) {
+				problemf("%s.parameters.mode: %q: want one of: %s", where, params.Mode,
+					strings.Join(BondModes, ", "))
+			}
+			if params.Primary != "" && !slices.Contains(bond.Interfaces, params.Primary) {
+				problemf("%s.parameters.primary: %s: not in interfaces", where,
+					params.Primary)
+			}
+		}
+		bond.Device.validate(where, problemf)
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(nc.Vlans)) {
+		vlan := nc.Vlans[id]
+		where := "vlans." + id
+		if vlan.ID < 0 || vlan.ID > 4094 {
+			problemf("%s.id: %d: want 0-4094", where, vlan.ID)
+		}
+		if kind := ids[vlan.Link]; kind != "ethernets" && kind != "bonds" {
+			problemf("%s.link: %q: not in ethernets or bonds", where, vlan.Link)
+		}
+		vlan.Device.validate(where, problemf)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("cloudinit.NetworkConfig: invalid network-config:\n%s",
+			strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func (dev Device) validate(where string, problemf func(format string, a ...any)) {
+	for _, addr := range dev.Addresses {
+		if _, err := netip.ParsePrefix(addr); err != nil {
+			problemf("%s.addresses: %s", where, err)
+		}
+	}
+	for i, route := range dev.Routes {
+		if route.To != "default" {
+			if _, err := netip.ParsePrefix(route.To); err != nil {
+				problemf("%s.routes[%d].to: %s", where, i, err)
+			}
+		}
+		if route.Via != "" {
+			if _, err := netip.ParseAddr(route.Via); err != nil {
+				problemf("%s.routes[%d].via: %s", where, i, err)
+			}
+		}
+	}
+	if dev.Nameservers != nil {
+		for _, addr := range dev.Nameservers.Addresses {
+			if _, err := netip.ParseAddr(addr); err != nil {
+				problemf("%s.nameservers.addresses: %s", where, err)
+			}
+		}
+	}
+	if dev.Mtu < 0 {
+		problemf("%s.mtu: %d: must be positive", where, dev.Mtu)
+	}
+}
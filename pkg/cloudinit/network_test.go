@@ -0,0 +1,198 @@
+package cloudinit_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/cloudinit"
+)
+
+func TestNetworkConfigRender(t *testing.T) {
+	// A public interface with DHCP and a private network as in Hetzner Cloud, plus a
+	// bond with a VLAN on top.
+	nc := cloudinit.NetworkConfig{
+		Ethernets: map[string]cloudinit.Ethernet{
+			"eth0": {Device: cloudinit.Device{Dhcp4: true}},
+			"private": {
+				Match:   &cloudinit.Match{MacAddress: "86:00:00:12:34:56"},
+				SetName: "enp7s0",
+				Device: cloudinit.Device{
+					Addresses: []string{"10.0.0.5/32"},
+					Routes: []cloudinit.Route{
+						{To: "10.0.0.0/16", Via: "10.0.0.1", OnLink: true},
+					},
+				},
+			},
+			"eno1": {},
+			"eno2": {},
+		},
+		Bonds: map[string]cloudinit.Bond{
+			"bond0": {
+				Interfaces: []string{"eno1", "eno2"},
+				Parameters: &cloudinit.BondParameters{Mode: "802.3ad", MiiMonitorInterval: 100},
+			},
+		},
+		Vlans: map[string]cloudinit.Vlan{
+			"vlan42": {
+				ID:   42,
+				Link: "bond0",
+				Device: cloudinit.Device{
+					Addresses: []string{"192.168.42.10/24"},
+					Routes:    []cloudinit.Route{{To: "default", Via: "192.168.42.1"}},
+					Nameservers: &cloudinit.Nameservers{
+						Addresses: []string{"192.168.42.1"},
+						Search:    []string{"example.com"},
+					},
+				},
+			},
+		},
+	}
+	want := `{
+  "version": 2,
+  "ethernets": {
+    "eno1": {},
+    "eno2": {},
+    "eth0": {
+      "dhcp4": true
+    },
+    "private": {
+      "match": {
+        "macaddress": "86:00:00:12:34:56"
+      },
+      "set-name": "enp7s0",
+      "addresses": [
+        "10.0.0.5/32"
+      ],
+      "routes": [
+        {
+          "to": "10.0.0.0/16",
+          "via": "10.0.0.1",
+          "on-link": true
+        }
+      ]
+    }
+  },
+  "bonds": {
+    "bond0": {
+      "interfaces": [
+        "eno1",
+        "eno2"
+      ],
+      "parameters": {
+        "mode": "802.3ad",
+        "mii-monitor-interval": 100
+      }
+    }
+  },
+  "vlans": {
+    "vlan42": {
+      "id": 42,
+      "link": "bond0",
+      "addresses": [
+        "192.168.42.10/24"
+      ],
+      "routes": [
+        {
+          "to": "default",
+          "via": "192.168.42.1"
+        }
+      ],
+      "nameservers": {
+        "addresses": [
+          "192.168.42.1"
+        ],
+        "search": [
+          "example.com"
+        ]
+      }
+    }
+  }
+}
+`
+
+	assert.NoError(t, nc.Validate(), "nc.Validate")
+	rendered, err := nc.Render()
+	assert.NoError(t, err, "nc.Render")
+	assert.Equal(t, string(rendered), want, "rendered")
+}
+
+func TestNetworkConfigValidateFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		nc      cloudinit.NetworkConfig
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		err := tc.nc.Validate()
+
+		assert.ErrorContains(t, err, tc.wantErr, "nc.Validate")
+	}
+
+	testCases := []testCase{
+		{
+			name:    "no devices",
+			wantErr: "cloudinit.NetworkConfig: invalid network-config:\nno devices",
+		},
+		{
+			name: "addresses and routes",
+			nc: cloudinit.NetworkConfig{
+				Ethernets: map[string]cloudinit.Ethernet{"eth0": {Device: cloudinit.Device{
+					Addresses:   []string{"10.0.0.5"},
+					Routes:      []cloudinit.Route{{To: "nowhere", Via: "10.0.0.300"}},
+					Nameservers: &cloudinit.Nameservers{Addresses: []string{"dns"}},
+				}}},
+			},
+			wantErr: "cloudinit.NetworkConfig: invalid network-config:\n" +
+				`ethernets.eth0.addresses: netip.ParsePrefix("10.0.0.5"): no '/'` + "\n" +
+				`ethernets.eth0.routes[0].to: netip.ParsePrefix("nowhere"): no '/'` + "\n" +
+				`ethernets.eth0.routes[0].via: ParseAddr("10.0.0.300"): ` +
+				`IPv4 field has value >255` + "\n" +
+				`ethernets.eth0.nameservers.addresses: ParseAddr("dns"): ` +
+				`unable to parse IP`,
+		},
+		{
+			name: "match",
+			nc: cloudinit.NetworkConfig{
+				Ethernets: map[string]cloudinit.Ethernet{
+					"a": {Match: &cloudinit.Match{MacAddress: "nope"}},
+					"b": {SetName: "eth9"},
+				},
+			},
+			wantErr: "cloudinit.NetworkConfig: invalid network-config:\n" +
+				"ethernets.a.match.macaddress: address nope: invalid MAC address\n" +
+				"ethernets.b.set-name: requires match",
+		},
+		{
+			name: "references",
+			nc: cloudinit.NetworkConfig{
+				Ethernets: map[string]cloudinit.Ethernet{"eno1": {}},
+				Bonds: map[string]cloudinit.Bond{
+					"bond0": {
+						Interfaces: []string{"eno1", "eno2"},
+						Parameters: &cloudinit.BondParameters{Mode: "fast", Primary: "eth0"},
+					},
+					"bond1": {Interfaces: []string{"eno1"}},
+				},
+				Vlans: map[string]cloudinit.Vlan{
+					"eno1":   {ID: 1, Link: "bond0"},
+					"vlan42": {ID: 5000, Link: "vlan7"},
+				},
+			},
+			wantErr: "cloudinit.NetworkConfig: invalid network-config:\n" +
+				"vlans.eno1: ID already used in ethernets\n" +
+				"bonds.bond0.interfaces: eno2: not in ethernets\n" +
+				`bonds.bond0.parameters.mode: "fast": want one of: balance-rr, ` +
+				"active-backup, balance-xor, broadcast, 802.3ad, balance-tlb, balance-alb\n" +
+				"bonds.bond0.parameters.primary: eth0: not in interfaces\n" +
+				"bonds.bond1.interfaces: eno1: already in bond bond0\n" +
+				"vlans.vlan42.id: 5000: want 0-4094\n" +
+				`vlans.vlan42.link: "vlan7": not in ethernets or bonds`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
@@ -0,0 +1,110 @@
+package cloudinit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SeedVolumeID is the volume label that the NoCloud datasource of cloud-init looks
+// for.
+const SeedVolumeID = "cidata"
+
+// Seed is the configuration of the NoCloud datasource of cloud-init, to provision
+// local VMs (QEMU, libvirt, ...) without a cloud provider. Write it as a directory
+// with [Seed.WriteDir] or as a disk image with [Seed.WriteISO].
+// https://cloudinit.readthedocs.io/en/latest/reference/datasources/nocloud.html
+//
+// For example, with QEMU:
+//
+//	qemu-system-x86_64 ... -drive file=seed.iso,media=cdrom
+type Seed struct {
+	// The user-data, for example the output of [CloudConfig.Render] or of
+	// [MultiPart].
+	UserData []byte
+	MetaData MetaData
+	// Optional network configuration, for example the output of
+	// [NetworkConfig.Render].
+	NetworkConfig []byte
+	// Modification time of the files in the ISO image. Default: now.
+	ModTime time.Time
+}
+
+// MetaData is the meta-data of the NoCloud datasource.
+type MetaData struct {
+	// Identifier of the instance. Cloud-init runs the per-instance modules (most of
+	// them) only when the identifier changes, so change it to provision again.
+	InstanceID string `json:"instance-id"`
+	// The hostname, if not set by the user-data.
+	LocalHostname string `json:"local-hostname,omitzero"`
+}
+
+// files returns the files of the seed.
+func (seed Seed) files() ([]isoFile, error) {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("cloudinit.Seed: "+format, a...)
+	}
+	if len(seed.UserData) == 0 {
+		return nil, errorf("missing UserData")
+	}
+	if seed.MetaData.InstanceID == "" {
+		return nil, errorf("missing MetaData.InstanceID")
+	}
+	// JSON is valid YAML.
+	metaData, err := json.MarshalIndent(seed.MetaData, "", "  ")
+	if err != nil {
+		return nil, errorf("meta-data: %s", err)
+	}
+	files := []isoFile{
+		{name: "meta-data", data: append(metaData, '\n')},
+		{name: "user-data", data: seed.UserData},
+	}
+	if len(seed.NetworkConfig) > 0 {
+		files = append(files, isoFile{name: "network-config", data: seed.NetworkConfig})
+	}
+	return files, nil
+}
+
+// WriteDir writes the seed files (user-data, meta-data and optionally
+// network-config) to directory dir, creating it if needed. The directory can be
+// exported to the VM (for example with virtiofs) or served over HTTP, and passed to
+// the datasource with the kernel command line "ds=nocloud;s=file:///path/".
+func (seed Seed) WriteDir(dir string) error {
+	files, err := seed.files()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("cloudinit.Seed: %s", err)
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(dir, file.name), file.data, 0o600); err != nil {
+			return fmt.Errorf("cloudinit.Seed: %s", err)
+		}
+	}
+	return nil
+}
+
+// WriteISO writes to fpath an ISO9660 image, labeled "cidata", with the seed files.
+// Attach it to the VM as a CD-ROM or as a disk.
+func (seed Seed) WriteISO(fpath string) error {
+	files, err := seed.files()
+	if err != nil {
+		return err
+	}
+	modTime := seed.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+	var buf bytes.Buffer
+	if err := writeISO9660(&buf, SeedVolumeID, files, modTime); err != nil {
+		return fmt.Errorf("cloudinit.Seed: %s", err)
+	}
+	if err := os.WriteFile(fpath, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("cloudinit.Seed: %s", err)
+	}
+	return nil
+}
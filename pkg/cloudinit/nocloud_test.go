@@ -0,0 +1,103 @@
+package cloudinit_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/cloudinit"
+)
+
+func TestSeedWriteISO(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "seed.iso")
+	seed := cloudinit.Seed{
+		UserData:      []byte("#cloud-config\n{}"),
+		MetaData:      cloudinit.MetaData{InstanceID: "i-1", LocalHostname: "vm1"},
+		NetworkConfig: []byte("version: 2\n"),
+		ModTime:       time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	err := seed.WriteISO(fpath)
+	assert.NoError(t, err, "seed.WriteISO")
+
+	img, err := os.ReadFile(fpath)
+	assert.NoError(t, err, "os.ReadFile")
+	assert.Equal(t, len(img)%2048, 0, "image size multiple of the sector size")
+	pvd := img[16*2048:]
+	assert.Equal(t, string(pvd[1:6]), "CD001", "primary volume descriptor")
+	assert.Equal(t, strings.TrimSpace(string(pvd[40:72])), "cidata", "volume identifier")
+	files, names := readJoliet(t, img)
+	assert.DeepEqual(t, files, map[string]string{
+		"meta-data":      "{\n  \"instance-id\": \"i-1\",\n  \"local-hostname\": \"vm1\"\n}\n",
+		"user-data":      "#cloud-config\n{}",
+		"network-config": "version: 2\n",
+	}, "files")
+	assert.DeepEqual(t, names, []string{"meta-data", "network-config", "user-data"},
+		"directory records sorted by name")
+}
+
+func TestSeedWriteDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cidata")
+	seed := cloudinit.Seed{
+		UserData: []byte("#cloud-config\n{}"),
+		MetaData: cloudinit.MetaData{InstanceID: "i-1"},
+	}
+
+	err := seed.WriteDir(dir)
+	assert.NoError(t, err, "seed.WriteDir")
+
+	assert.FileEqualsString(t, filepath.Join(dir, "user-data"), "#cloud-config\n{}")
+	assert.FileEqualsString(t, filepath.Join(dir, "meta-data"),
+		"{\n  \"instance-id\": \"i-1\"\n}\n")
+	_, err = os.Stat(filepath.Join(dir, "network-config"))
+	assert.True(t, os.IsNotExist(err), "network-config should not exist")
+}
+
+func TestSeedFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	err := cloudinit.Seed{MetaData: cloudinit.MetaData{InstanceID: "i-1"}}.WriteDir(dir)
+	assert.ErrorContains(t, err, "cloudinit.Seed: missing UserData", "WriteDir")
+
+	err = cloudinit.Seed{UserData: []byte("#cloud-config\n")}.WriteISO(
+		filepath.Join(dir, "seed.iso"))
+	assert.ErrorContains(t, err, "cloudinit.Seed: missing MetaData.InstanceID", "WriteISO")
+}
+
+// readJoliet returns the files in the root directory of the Joliet tree of the
+// ISO9660 image img, and their names in the order of the directory records.
+func readJoliet(t *testing.T, img []byte) (map[string]string, []string) {
+	t.Helper()
+	svd := img[17*2048:]
+	assert.Equal(t, svd[0], byte(2), "supplementary volume descriptor")
+	assert.Equal(t, string(svd[88:91]), "%/E", "Joliet escape sequence")
+	rootExtent := binary.LittleEndian.Uint32(svd[156+2:])
+	rootSize := binary.LittleEndian.Uint32(svd[156+10:])
+
+	files := make(map[string]string)
+	var names []string
+	dir := img[rootExtent*2048 : rootExtent*2048+rootSize]
+	for len(dir) > 0 && dir[0] > 0 {
+		rec := dir[:dir[0]]
+		dir = dir[dir[0]:]
+		if rec[25]&2 != 0 { // "." and ".."
+			continue
+		}
+		id := rec[33 : 33+rec[32]]
+		var name []uint16
+		for i := 0; i < len(id); i += 2 {
+			name = append(name, binary.BigEndian.Uint16(id[i:]))
+		}
+		extent := binary.LittleEndian.Uint32(rec[2:])
+		size := binary.LittleEndian.Uint32(rec[10:])
+		files[string(utf16.Decode(name))] = string(img[extent*2048 : extent*2048+size])
+		names = append(names, string(utf16.Decode(name)))
+	}
+	return files, names
+}
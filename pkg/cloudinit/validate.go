@@ -0,0 +1,113 @@
+package cloudinit
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+//go:embed schema/cloud-config.json
+var cloudConfigSchema []byte
+
+var compileSchema = sync.OnceValues(func() (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(cloudConfigSchema))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("cloud-config.json", doc); err != nil {
+		return nil, err
+	}
+	return compiler.Compile("cloud-config.json")
+})
+
+// Validate checks the rendered cloud-config against the schema of cloud-init for
+// the supported modules. It returns all the problems found. Keys of modules not
+// supported by CloudConfig are not checked.
+func (cfg CloudConfig) Validate() error {
+	userData, err := cfg.Render()
+	if err != nil {
+		return err
+	}
+	return ValidateUserData(userData)
+}
+
+// ValidateUserData is like [CloudConfig.Validate], for a rendered cloud-config. Since
+// there is no YAML parser, userData must be in the JSON flavor of YAML, as rendered
+// by [CloudConfig.Render].
+func ValidateUserData(userData []byte) error {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("cloudinit.Validate: "+format, a...)
+	}
+
+	schema, err := compileSchema()
+	if err != nil {
+		return errorf("schema: %s", err)
+	}
+	data, found := bytes.CutPrefix(userData, []byte("#cloud-config\n"))
+	if !found {
+		return errorf("missing #cloud-config header")
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return errorf("parsing (only JSON is supported): %s", err)
+	}
+
+	err = schema.Validate(doc)
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+	var problems []string
+	collectProblems(verr, &problems)
+	slices.Sort(problems)
+	problems = slices.Compact(problems)
+	return errorf("invalid cloud-config:\n%s", strings.Join(problems, "\n"))
+}
+
+// collectProblems appends to problems the leaf errors of verr, as
+// "at '/instance/location': message".
+func collectProblems(verr *jsonschema.ValidationError, problems *[]string) {
+	if len(verr.Causes) == 0 {
+		*problems = append(*problems, verr.Error())
+		return
+	}
+	causes := verr.Causes
+	switch verr.ErrorKind.(type) {
+	case *kind.OneOf, *kind.AnyOf:
+		// Ignore the alternatives that do not apply to the type of the value, since
+		// the problem is in the others.
+		applicable := slices.DeleteFunc(slices.Clone(causes),
+			func(cause *jsonschema.ValidationError) bool {
+				return isTypeMismatch(cause, verr.InstanceLocation)
+			})
+		if len(applicable) > 0 {
+			causes = applicable
+		}
+	}
+	for _, cause := range causes {
+		collectProblems(cause, problems)
+	}
+}
+
+// isTypeMismatch returns true if all the leaf errors of verr are type mismatches at
+// instance location loc.
+func isTypeMismatch(verr *jsonschema.ValidationError, loc []string) bool {
+	if len(verr.Causes) == 0 {
+		_, isType := verr.ErrorKind.(*kind.Type)
+		return isType && slices.Equal(verr.InstanceLocation, loc)
+	}
+	for _, cause := range verr.Causes {
+		if !isTypeMismatch(cause, loc) {
+			return false
+		}
+	}
+	return true
+}
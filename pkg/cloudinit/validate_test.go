@@ -0,0 +1,113 @@
+package cloudinit_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/cloudinit"
+)
+
+func TestValidateSuccess(t *testing.T) {
+	no := false
+	cfg := cloudinit.CloudConfig{
+		BootCmd:        []string{"echo boot"},
+		RunCmd:         []string{"echo run"},
+		SshGenKeyTypes: []string{"ed25519"},
+		SshKeys:        &cloudinit.SshKeys{Ed25519Public: "ssh-ed25519 AAAA host"},
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: "/etc/foo", Content: "Zm9v", Permissions: "0640", Encoding: "b64"},
+		},
+		Groups: []cloudinit.Group{{Name: "admins", Members: []string{"alice"}}},
+		Users: []cloudinit.User{
+			{Name: "default"},
+			{Name: "alice", Sudo: []string{"ALL=(ALL) NOPASSWD:ALL"}, LockPasswd: &no},
+		},
+		Packages:      []string{"curl"},
+		PackageUpdate: true,
+		Mounts:        []cloudinit.Mount{{Spec: "/dev/sdb", File: "/data"}},
+		Hostname:      "web1",
+		Timezone:      "Europe/Zurich",
+		Locale:        "en_US.UTF-8",
+		PowerState:    &cloudinit.PowerState{Mode: "reboot", Delay: "+1"},
+	}
+
+	assert.NoError(t, cfg.Validate(), "cfg.Validate")
+}
+
+func TestValidateBootstrap(t *testing.T) {
+	cfg, err := cloudinit.Bootstrap{Provisioner: []byte("x"), Settings: []byte("{}")}.
+		CloudConfig()
+	assert.NoError(t, err, "bs.CloudConfig")
+
+	assert.NoError(t, cfg.Validate(), "cfg.Validate")
+}
+
+func TestValidateFailure(t *testing.T) {
+	cfg := cloudinit.CloudConfig{
+		SshGenKeyTypes: []string{"dsa"},
+		WriteFiles: []cloudinit.WriteFile{
+			{Path: "/etc/a", Permissions: "644"},
+			{Path: "/etc/b", Encoding: "zstd"},
+		},
+		Hostname:   "web_1",
+		PowerState: &cloudinit.PowerState{Mode: "suspend"},
+	}
+
+	err := cfg.Validate()
+
+	assert.ErrorContains(t, err, "cloudinit.Validate: invalid cloud-config:", "cfg.Validate")
+	for _, want := range []string{
+		"at '/hostname': ",
+		"at '/power_state/mode': value must be one of 'poweroff', 'reboot', 'halt'",
+		"at '/ssh_genkeytypes/0': value must be one of 'ecdsa', 'ed25519', 'rsa'",
+		"at '/write_files/0/permissions': '644' does not match pattern",
+		"at '/write_files/1/encoding': value must be one of",
+	} {
+		assert.ErrorContains(t, err, want, "cfg.Validate")
+	}
+}
+
+func TestValidateUserDataFailure(t *testing.T) {
+	type testCase struct {
+		name     string
+		userData string
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		err := cloudinit.ValidateUserData([]byte(tc.userData))
+
+		assert.ErrorContains(t, err, tc.wantErr, "ValidateUserData")
+	}
+
+	testCases := []testCase{
+		{
+			name:     "missing header",
+			userData: `{}`,
+			wantErr:  "cloudinit.Validate: missing #cloud-config header",
+		},
+		{
+			name:     "not JSON",
+			userData: "#cloud-config\nruncmd:\n  - ls\n",
+			wantErr:  "cloudinit.Validate: parsing (only JSON is supported): ",
+		},
+		{
+			name:     "wrong type",
+			userData: "#cloud-config\n" + `{"runcmd": "ls", "write_files": [{}]}`,
+			wantErr: "cloudinit.Validate: invalid cloud-config:\n" +
+				"at '/runcmd': got string, want array\n" +
+				"at '/write_files/0': missing property 'path'",
+		},
+		{
+			name:     "only the applicable alternative",
+			userData: "#cloud-config\n" + `{"users": [{"name": 1}]}`,
+			wantErr: "cloudinit.Validate: invalid cloud-config:\n" +
+				"at '/users/0/name': got number, want string",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
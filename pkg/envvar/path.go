@@ -8,6 +8,7 @@ import (
 	"os"
 
 	"github.com/marco-m/florist/internal"
+	"github.com/marco-m/florist/pkg/florist"
 )
 
 // Add persists environment variable k with value v for all users of the system,
@@ -25,7 +26,7 @@ func Add(k, v string) error {
 	const file = "/etc/environment"
 	// Used only if the file doesn't exist and we passed O_CREATE to the flags.
 	unused := os.FileMode(0o644)
-	fi, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, unused)
+	fi, err := florist.OpenFile(file, os.O_WRONLY|os.O_APPEND, unused)
 	if err != nil {
 		return errorf("%s", err)
 	}
@@ -52,7 +53,7 @@ func AddPaths(log *slog.Logger, name string, paths ...string) error {
 	//
 	posixDst := fmt.Sprintf("/etc/profile.d/%s.sh", name)
 	log.Debug("Add to PATH (POSIX shells)", "name", name, "paths", paths, "dst", posixDst)
-	fi, err := os.Create(posixDst)
+	fi, err := florist.OpenFile(posixDst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
 	if err != nil {
 		return errorf("%s", err)
 	}
@@ -69,13 +70,13 @@ func AddPaths(log *slog.Logger, name string, paths ...string) error {
 
 	// Create the directory if not present. This allows to configure the path also if
 	// the Fish shell has not been installed yet.
-	if err := os.MkdirAll("/etc/fish/conf.d", 0o755); err != nil {
+	if err := florist.MkdirAll("/etc/fish/conf.d", 0o755); err != nil {
 		return errorf("creating fish dir: %s", err)
 	}
 
 	fishDst := fmt.Sprintf("/etc/fish/conf.d/%s.fish", name)
 	log.Debug("Add to PATH (Fish shell)", "name", name, "paths", paths, "dst", fishDst)
-	fi, err = os.Create(fishDst)
+	fi, err = florist.OpenFile(fishDst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
 	if err != nil {
 		return errorf("%s", err)
 	}
@@ -3,12 +3,22 @@ package florist
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 
 	"github.com/marco-m/florist/pkg/sets"
 )
@@ -18,7 +28,7 @@ func UnzipOne(zipPath string, name string, dstPath string) error {
 	log := slog.With("zipPath", zipPath, "name", name, "dstPath", dstPath)
 	log.Debug("unzip-one")
 
-	rd, err := zip.OpenReader(zipPath)
+	rd, err := zip.OpenReader(Path(zipPath))
 	if err != nil {
 		return fmt.Errorf("UnzipOne: open zip: %s", err)
 	}
@@ -39,14 +49,15 @@ func UnzipOne(zipPath string, name string, dstPath string) error {
 	if err != nil {
 		return fmt.Errorf("UnzipOne: open element: %s", err)
 	}
+	defer fi.Close()
 
-	dst, err := os.Create(dstPath)
+	dst, err := os.Create(Path(dstPath))
 	if err != nil {
 		return fmt.Errorf("UnzipOne: create dst file: %s", err)
 	}
 
 	_, err = io.Copy(dst, fi)
-	if err != nil {
+	if err := JoinErrors(err, dst.Close()); err != nil {
 		return fmt.Errorf("UnzipOne: copy to dst: %s", err)
 	}
 	log.Debug("unzip-one", "status", "written")
@@ -54,8 +65,8 @@ func UnzipOne(zipPath string, name string, dstPath string) error {
 	return nil
 }
 
-// UntarOne extracts file 'name' from tar file 'tarPath', expected to be
-// compressed with gzip, and saves it to 'dstPath'.
+// UntarOne extracts file 'name' from tar file 'tarPath' and saves it to 'dstPath'.
+// The tar file can be compressed with gzip, xz, zstd or bzip2 (see [Extract]).
 //
 // Examples:
 //
@@ -65,19 +76,19 @@ func UntarOne(tarPath string, name string, dstPath string) error {
 	log := slog.With("tarPath", tarPath, "name", name, "dstPath", dstPath)
 	log.Debug("untar-one")
 
-	fi, err := os.Open(tarPath)
+	fi, err := os.Open(Path(tarPath))
 	if err != nil {
-		return fmt.Errorf("UntarOne: %s", err)
+		return fmt.Errorf("UntarOne: %s", unmapErr(err))
 	}
 	defer fi.Close()
 
-	gzRd, err := gzip.NewReader(fi)
+	rd, closeRd, err := decompress(fi)
 	if err != nil {
-		return fmt.Errorf("UntarOne: creating gzip reader for %s: %s", tarPath, err)
+		return fmt.Errorf("UntarOne: reading %s: %s", tarPath, err)
 	}
-	defer gzRd.Close()
+	defer closeRd()
 
-	tarRd := tar.NewReader(gzRd)
+	tarRd := tar.NewReader(rd)
 
 	var seen []string
 	nameFound := false
@@ -93,7 +104,8 @@ func UntarOne(tarPath string, name string, dstPath string) error {
 			return fmt.Errorf("UntarOne: reading %s: found insecure path %q",
 				tarPath, header.Name)
 		}
-		if header.Name == name {
+		// The same relative path "foo" can be encoded as "foo" or as "./foo".
+		if filepath.Clean(header.Name) == filepath.Clean(name) {
 			nameFound = true
 			break
 		}
@@ -107,13 +119,13 @@ func UntarOne(tarPath string, name string, dstPath string) error {
 	}
 	log.Debug("file-found-in-archive")
 
-	dst, err := os.Create(dstPath)
+	dst, err := os.Create(Path(dstPath))
 	if err != nil {
 		return fmt.Errorf("UntarOne: create dst file: %s", err)
 	}
 
 	_, err = io.Copy(dst, tarRd)
-	if err != nil {
+	if err := JoinErrors(err, dst.Close()); err != nil {
 		return fmt.Errorf("UntarOne: copy to dst: %s", err)
 	}
 	log.Debug("untar-one", "status", "written")
@@ -121,99 +133,444 @@ func UntarOne(tarPath string, name string, dstPath string) error {
 	return nil
 }
 
-// UntarSome extracts the files in tar file 'tarPath' that match the list in 'some'. File
-// 'tarPath' is expected to be compressed with gzip. UntarSome saves the matching files to
-// directory 'dstDir', which must exist beforehand, and applies to them 'perm', 'owner'
-// and 'group'. UntarSome disregards the file permissions and ownrship that are present in
-// the tarfile. If any file in 'some' is not found, UntarSome returns an error. In case
-// the archive is hierarchical, UntarSome flattens any directory. This behavior might
-// change. See also [UntarAll].
+// ExtractOne extracts file 'name' from archive 'archivePath', a ZIP or a tar file of
+// any of the formats supported by [Extract], and saves it to 'dstPath'.
+func ExtractOne(archivePath string, name string, dstPath string) error {
+	isZip, err := isZipFile(archivePath)
+	if err != nil {
+		return fmt.Errorf("ExtractOne: %s", err)
+	}
+	if isZip {
+		return UnzipOne(archivePath, name, dstPath)
+	}
+	return UntarOne(archivePath, name, dstPath)
+}
+
+// UntarSome extracts the files in tar file 'tarPath' that match the list in 'some',
+// preserving the directory hierarchy. File 'tarPath' can be compressed (see
+// [Extract]). UntarSome saves the matching files below directory 'dstDir', which
+// must exist beforehand, and applies to them 'perm', 'owner' and 'group'. UntarSome
+// disregards the file permissions and ownership that are present in the tarfile. If
+// any file in 'some' is not found, UntarSome returns an error. See also [UntarAll]
+// and, for more control, [Extract].
 func UntarSome(tarPath, dstDir string, some []string, perm os.FileMode, owner, group string) error {
 	fn := "UntarSome"
 	if some == nil {
 		fn = "UntarAll"
 	}
-	log := slog.With("fn", fn)
-	errorf := makeErrorf(fn)
+	return extract(fn, tarPath, dstDir, ExtractOptions{
+		Only:     some,
+		FileMode: perm,
+		Owner:    owner,
+		Group:    group,
+	})
+}
 
-	log.Debug(fn, "phase", "starting", "tarPath", tarPath, "dstDir", dstDir, "some", some)
+// UntarAll extracts all files from tar file 'tarPath', preserving the directory
+// hierarchy. File 'tarPath' can be compressed (see [Extract]). UntarAll saves the
+// files below directory 'dstDir', which must exist beforehand, and applies to them
+// 'perm', 'owner' and 'group'. UntarAll disregards the file permissions and ownership
+// that are present in the tarfile. See also [UntarSome] and, for more control,
+// [Extract].
+func UntarAll(tarPath, dstDir string, perm os.FileMode, owner, group string) error {
+	return UntarSome(tarPath, dstDir, nil, perm, owner, group)
+}
 
-	fi, err := os.Open(tarPath)
+// ExtractOptions configures [Extract].
+type ExtractOptions struct {
+	// Remove this number of leading elements from the paths in the archive, as
+	// "tar --strip-components" does. Entries with fewer elements are skipped.
+	StripComponents int
+	// If not empty, extract only these files (paths in the archive, after
+	// StripComponents). If any is not found, Extract returns an error.
+	Only []string
+	// Apply the permissions stored in the archive (without setuid, setgid and
+	// sticky bits) instead of FileMode and DirMode.
+	PreserveModes bool
+	// Permissions of the files and directories. Default: 0644 and 0755.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	// Create the symlinks stored in the archive. Default: skip them. A symlink
+	// pointing outside of the destination directory is an error.
+	Symlinks bool
+	// Owner and group of the files and directories. Default: the current user.
+	Owner string
+	Group string
+}
+
+// Extract extracts archive 'archivePath' below directory 'dstDir', which must exist
+// beforehand, preserving the directory hierarchy. The archive is a ZIP file or a
+// tar file, either uncompressed or compressed with gzip (.tar.gz, .tgz), xz
+// (.tar.xz), zstd (.tar.zst) or bzip2 (.tar.bz2); the format is detected from the
+// contents, not from the file name.
+//
+// Extract protects from malicious archives: an entry whose path is absolute or
+// contains ".." ("zip slip") is an error, as is a symlink pointing outside of
+// 'dstDir', also through other symlinks; all the files are written within
+// 'dstDir'. Hard links, devices and other special files are skipped.
+func Extract(archivePath string, dstDir string, opts ExtractOptions) error {
+	return extract("Extract", archivePath, dstDir, opts)
+}
+
+func extract(fn string, archivePath string, dstDir string, opts ExtractOptions) error {
+	errorf := makeErrorf(fn)
+	log := slog.With("fn", fn)
+	log.Debug(fn, "phase", "starting", "archivePath", archivePath, "dstDir", dstDir,
+		"opts", opts)
+
+	if opts.StripComponents < 0 {
+		return errorf("negative StripComponents: %d", opts.StripComponents)
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = 0o644
+	}
+	if opts.DirMode == 0 {
+		opts.DirMode = 0o755
+	}
+	root, err := os.OpenRoot(Path(dstDir))
 	if err != nil {
-		return errorf("%w", err)
+		return errorf("%s", unmapErr(err))
+	}
+	defer root.Close()
+	ex := &extractor{
+		log:    log,
+		root:   root,
+		dstDir: dstDir,
+		opts:   opts,
+		wanted: sets.From(opts.Only...),
+		found:  sets.New[string](len(opts.Only)),
 	}
-	defer fi.Close()
 
-	gzRd, err := gzip.NewReader(fi)
+	isZip, err := isZipFile(archivePath)
+	if err != nil {
+		return errorf("%s", err)
+	}
+	if isZip {
+		err = ex.unzip(archivePath)
+	} else {
+		err = ex.untar(archivePath)
+	}
 	if err != nil {
-		return errorf("creating gzip reader for %s: %s", tarPath, err)
+		return errorf("reading %s: %s", archivePath, err)
 	}
-	defer gzRd.Close()
 
-	tarRd := tar.NewReader(gzRd)
-	wanted := sets.From(some...)
-	found := sets.New[string](wanted.Size())
+	if notFound := ex.wanted.Difference(ex.found); notFound.Size() > 0 {
+		return errorf("some files not found: %s", notFound)
+	}
+	return nil
+}
+
+// extractor extracts the entries of an archive, see [Extract].
+type extractor struct {
+	log    *slog.Logger
+	root   *os.Root
+	dstDir string
+	opts   ExtractOptions
+	wanted *sets.Set[string]
+	found  *sets.Set[string]
+}
+
+func (ex *extractor) untar(tarPath string) error {
+	fi, err := os.Open(Path(tarPath))
+	if err != nil {
+		return unmapErr(err)
+	}
+	defer fi.Close()
+	rd, closeRd, err := decompress(fi)
+	if err != nil {
+		return err
+	}
+	defer closeRd()
 
+	tarRd := tar.NewReader(rd)
 	for {
 		header, err := tarRd.Next()
 		if err == io.EOF {
-			break // End of archive
+			return nil // End of archive
 		}
 		if err != nil {
-			return errorf("reading %s: %s", tarPath, err)
+			return err
 		}
-		if !filepath.IsLocal(header.Name) {
-			return errorf("reading %s: found insecure path %q", tarPath, header.Name)
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeDir, tar.TypeSymlink:
+			if err := ex.add(header.Name, header.FileInfo().Mode(), header.Linkname,
+				tarRd); err != nil {
+				return err
+			}
+		default:
+			ex.log.Debug("skip", "name", header.Name, "type", string(header.Typeflag))
 		}
-		if header.Typeflag != tar.TypeReg {
-			// Skip any non-regular file.
-			continue
+	}
+}
+
+func (ex *extractor) unzip(zipPath string) error {
+	rd, err := zip.OpenReader(Path(zipPath))
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	for _, zf := range rd.File {
+		if err := ex.unzipOne(zf); err != nil {
+			return err
 		}
-		if wanted.Size() > 0 {
-			// Depending on how the tarfile has been created, the same relative path "foo"
-			// could be encoded in two ways: "header.Name = foo" or "header.Name = ./foo".
-			// We need to normalize.
-			canonicalName := filepath.Clean(header.Name)
-			if !wanted.Contains(canonicalName) {
-				log.Debug(fn, "skip", header.Name, "canonical", canonicalName)
-				continue
-			} else {
-				found.Add(canonicalName)
-			}
+	}
+	return nil
+}
+
+func (ex *extractor) unzipOne(zf *zip.File) error {
+	body, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	mode := zf.Mode()
+	var linkname string
+	if mode&fs.ModeSymlink != 0 {
+		// ZIP stores the target of a symlink as its contents.
+		buf, err := io.ReadAll(io.LimitReader(body, 4096))
+		if err != nil {
+			return err
 		}
+		linkname = string(buf)
+	}
+	return ex.add(zf.Name, mode, linkname, body)
+}
+
+// add extracts the archive entry 'name'.
+func (ex *extractor) add(name string, mode fs.FileMode, linkname string, body io.Reader) error {
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("found insecure path %q", name)
+	}
+	// Depending on how the archive has been created, the same relative path "foo"
+	// could be encoded as "foo" or "./foo"; a directory as "foo/".
+	name = path.Clean(filepath.ToSlash(name))
+	if ex.opts.StripComponents > 0 {
+		elems := strings.Split(name, "/")
+		if len(elems) <= ex.opts.StripComponents {
+			ex.log.Debug("skip", "name", name, "reason", "strip-components")
+			return nil
+		}
+		name = path.Join(elems[ex.opts.StripComponents:]...)
+	}
+	if ex.wanted.Size() > 0 {
+		if mode.IsDir() || !ex.wanted.Contains(name) {
+			ex.log.Debug("skip", "name", name)
+			return nil
+		}
+		ex.found.Add(name)
+	}
+	fpath := path.Join(ex.dstDir, name)
 
-		dstPath := filepath.Join(dstDir, header.Name)
-		log.Debug(fn, "phase", "copying", "dst", dstPath)
-		dst, err := os.Create(dstPath)
+	switch {
+	case mode.IsDir():
+		perm := ex.opts.DirMode
+		if ex.opts.PreserveModes {
+			perm = mode.Perm()
+		}
+		if err := ex.root.MkdirAll(name, perm); err != nil {
+			return unmapErr(err)
+		}
+		if err := ex.root.Chmod(name, perm); err != nil {
+			return unmapErr(err)
+		}
+		return ex.chown(fpath)
+
+	case mode&fs.ModeSymlink != 0:
+		if !ex.opts.Symlinks {
+			ex.log.Debug("skip", "name", name, "reason", "symlink")
+			return nil
+		}
+		if err := ex.mkdirParent(name); err != nil {
+			return err
+		}
+		// Checking the path text of the link is not enough: the directory of the
+		// link could be itself a symlink, created by a previous entry. So we
+		// resolve the directory to its real location, and we create the link with
+		// the cleaned target, whose ".." elements, if any, are only at the
+		// beginning, where they refer to that real location.
+		dir, err := ex.resolveDir(path.Dir(name))
 		if err != nil {
-			return errorf("creating dst file: %s", err)
+			return err
+		}
+		target := path.Clean(linkname)
+		if path.IsAbs(target) || !filepath.IsLocal(path.Join(dir, target)) {
+			return fmt.Errorf("symlink %q points outside of the destination: %q",
+				name, linkname)
+		}
+		if err := ex.remove(name); err != nil {
+			return err
 		}
-		if err := ChOwnMod(dstPath, perm, owner, group); err != nil {
-			return errorf("changing owner/mode for file: %s", err)
+		if err := ex.root.Symlink(target, name); err != nil {
+			return unmapErr(err)
 		}
+		ex.log.Debug("symlink", "name", fpath, "target", target)
+		return nil
 
-		_, err = io.Copy(dst, tarRd)
+	case mode.IsRegular():
+		perm := ex.opts.FileMode
+		if ex.opts.PreserveModes {
+			perm = mode.Perm()
+		}
+		if err := ex.mkdirParent(name); err != nil {
+			return err
+		}
+		// Remove beforehand, to replace a symlink instead of writing to its target
+		// and to avoid TXTBSY (text file busy) if the file is a running executable.
+		if err := ex.remove(name); err != nil {
+			return err
+		}
+		dst, err := ex.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if err != nil {
+			return unmapErr(err)
+		}
+		_, err = io.Copy(dst, body)
+		if err := JoinErrors(err, dst.Close()); err != nil {
+			return fmt.Errorf("writing %s: %s", fpath, unmapErr(err))
+		}
+		// Set the mode explicitly, since OpenFile is subject to the umask.
+		if err := ex.root.Chmod(name, perm); err != nil {
+			return unmapErr(err)
+		}
+		ex.log.Info("extracted", "dst", fpath)
+		return ex.chown(fpath)
+
+	default:
+		ex.log.Debug("skip", "name", name, "mode", mode)
+		return nil
+	}
+}
+
+// resolveDir returns the real location of directory 'dir', with all the symlinks
+// resolved, relative to the destination directory. It returns an error if 'dir' is
+// outside of the destination directory. The elements of 'dir' that do not exist are
+// taken literally.
+func (ex *extractor) resolveDir(dir string) (string, error) {
+	const maxLinks = 40 // As Linux (see path_resolution(7)).
+	resolved := "."
+	elems := strings.Split(dir, "/")
+	for links := 0; len(elems) > 0; {
+		elem := elems[0]
+		elems = elems[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			// 'resolved' contains no symlinks, so ".." is its parent.
+			if resolved == "." {
+				return "", fmt.Errorf("directory %s is outside of the destination",
+					path.Join(ex.dstDir, dir))
+			}
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, elem)
+		fi, err := ex.root.Lstat(next)
+		if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("directory %s: too many levels of symlinks",
+				path.Join(ex.dstDir, dir))
+		}
+		target, err := ex.root.Readlink(next)
 		if err != nil {
-			return errorf("copy to dst: %s", err)
+			return "", unmapErr(err)
+		}
+		if path.IsAbs(target) {
+			return "", fmt.Errorf("directory %s is outside of the destination",
+				path.Join(ex.dstDir, dir))
 		}
-		log.Info(fn, "phase", "written", "dst", dstPath)
+		elems = append(strings.Split(target, "/"), elems...)
 	}
-	if wanted.Size() > 0 {
-		notFound := wanted.Difference(found)
-		if notFound.Size() > 0 {
-			return errorf("some files not found: %s", notFound)
+	return resolved, nil
+}
+
+// mkdirParent creates the parent directories of 'name', for the archives that do
+// not contain the directory entries.
+func (ex *extractor) mkdirParent(name string) error {
+	if dir := path.Dir(name); dir != "." {
+		if err := ex.root.MkdirAll(dir, ex.opts.DirMode); err != nil {
+			return unmapErr(err)
 		}
 	}
+	return nil
+}
+
+// remove removes 'name' if it exists and is not a directory.
+func (ex *extractor) remove(name string) error {
+	fi, err := ex.root.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return unmapErr(err)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("cannot replace directory %s", path.Join(ex.dstDir, name))
+	}
+	return unmapErr(ex.root.Remove(name))
+}
 
+func (ex *extractor) chown(fpath string) error {
+	if ex.opts.Owner == "" && ex.opts.Group == "" {
+		return nil
+	}
+	if err := chown(fpath, ex.opts.Owner, ex.opts.Group); err != nil {
+		return fmt.Errorf("changing owner of %s: %s", fpath, err)
+	}
 	return nil
 }
 
-// UntarAll extracts all files from tar file 'tarPath'. File 'tarPath' is expected to be
-// compressed with gzip. UntarSome saves the matching files to directory 'dstDir', which
-// must exist beforehand, and applies to them 'perm', 'owner' and 'group'. UntarAll
-// disregards the file permissions and ownrship that are present in the tarfile. In case
-// the archive is hierarchical, UntarAll flattens any directory. This behavior might
-// change. See also [UntarSome].
-func UntarAll(tarPath, dstDir string, perm os.FileMode, owner, group string) error {
-	return UntarSome(tarPath, dstDir, nil, perm, owner, group)
+// isZipFile reports whether file 'fpath' is a ZIP file, looking at its contents.
+func isZipFile(fpath string) (bool, error) {
+	fi, err := os.Open(Path(fpath))
+	if err != nil {
+		return false, unmapErr(err)
+	}
+	defer fi.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(fi, magic); err != nil {
+		// Too short to be a ZIP file; let the tar reader report the error.
+		return false, nil
+	}
+	// Local file header or, for an empty archive, end of central directory.
+	return bytes.Equal(magic, []byte("PK\x03\x04")) ||
+		bytes.Equal(magic, []byte("PK\x05\x06")), nil
+}
+
+// decompress returns a reader decompressing 'rd' according to its magic number
+// (gzip, xz, zstd or bzip2), or reading it as is if not compressed. Call the
+// returned function to release the resources.
+func decompress(rd io.Reader) (io.Reader, func(), error) {
+	nop := func() {}
+	br := bufio.NewReader(rd)
+	// A short read is not an error here: the file can be an empty tar.
+	magic, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzRd, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nop, fmt.Errorf("creating gzip reader: %s", err)
+		}
+		return gzRd, func() { gzRd.Close() }, nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		xzRd, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nop, fmt.Errorf("creating xz reader: %s", err)
+		}
+		return xzRd, nop, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zstdRd, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nop, fmt.Errorf("creating zstd reader: %s", err)
+		}
+		return zstdRd, zstdRd.Close, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nop, nil
+	default:
+		return br, nop, nil
+	}
 }
@@ -1,7 +1,12 @@
 package florist_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
 	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -88,3 +93,218 @@ func TestUntarAll(t *testing.T) {
 		assert.FileEqualsFile(t, have, want)
 	}
 }
+
+func TestExtractFormats(t *testing.T) {
+	provisioner.LowLevelInit(io.Discard, "Info")
+
+	test := func(t *testing.T, archive string) {
+		dstDir := t.TempDir()
+
+		err := florist.Extract(filepath.Join("testdata/archive", archive), dstDir,
+			florist.ExtractOptions{
+				StripComponents: 1,
+				PreserveModes:   true,
+				Symlinks:        true,
+			})
+
+		assert.NoError(t, err, "florist.Extract")
+		assert.FileEqualsString(t, filepath.Join(dstDir, "bin/hello"),
+			"#!/bin/sh\necho hello\n")
+		assert.FileEqualsString(t, filepath.Join(dstDir, "etc/hello.conf"),
+			"greeting = hello\n")
+		assertMode(t, filepath.Join(dstDir, "bin/hello"), 0o755)
+		assertMode(t, filepath.Join(dstDir, "etc/hello.conf"), 0o640)
+		assertMode(t, filepath.Join(dstDir, "lib/libhello.so.1"), 0o644)
+		target, err := os.Readlink(filepath.Join(dstDir, "lib/libhello.so"))
+		assert.NoError(t, err, "os.Readlink")
+		assert.Equal(t, target, "libhello.so.1", "symlink target")
+		assert.FileEqualsString(t, filepath.Join(dstDir, "lib/libhello.so"),
+			"not really ELF\n")
+	}
+
+	archives := []string{
+		"hello-1.0.tar",
+		"hello-1.0.tar.gz",
+		"hello-1.0.tar.xz",
+		"hello-1.0.tar.zst",
+		"hello-1.0.tar.bz2",
+		"hello-1.0.zip",
+	}
+
+	for _, archive := range archives {
+		t.Run(archive, func(t *testing.T) { test(t, archive) })
+	}
+}
+
+func TestExtractDefaultOptions(t *testing.T) {
+	provisioner.LowLevelInit(io.Discard, "Info")
+	dstDir := t.TempDir()
+
+	err := florist.Extract("testdata/archive/hello-1.0.tar.gz", dstDir,
+		florist.ExtractOptions{})
+
+	assert.NoError(t, err, "florist.Extract")
+	assertMode(t, filepath.Join(dstDir, "hello-1.0/bin/hello"), 0o644)
+	assertMode(t, filepath.Join(dstDir, "hello-1.0/etc/hello.conf"), 0o644)
+	assertMode(t, filepath.Join(dstDir, "hello-1.0/bin"), fs.ModeDir|0o755)
+	_, err = os.Lstat(filepath.Join(dstDir, "hello-1.0/lib/libhello.so"))
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "symlink skipped")
+}
+
+func TestExtractOnly(t *testing.T) {
+	provisioner.LowLevelInit(io.Discard, "Info")
+	dstDir := t.TempDir()
+
+	err := florist.Extract("testdata/archive/hello-1.0.tar.zst", dstDir,
+		florist.ExtractOptions{StripComponents: 1, Only: []string{"bin/hello"}})
+
+	assert.NoError(t, err, "florist.Extract")
+	assert.FileEqualsString(t, filepath.Join(dstDir, "bin/hello"),
+		"#!/bin/sh\necho hello\n")
+	_, err = os.Stat(filepath.Join(dstDir, "etc"))
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "etc not extracted")
+
+	err = florist.Extract("testdata/archive/hello-1.0.zip", dstDir,
+		florist.ExtractOptions{Only: []string{"bin/hello", "bin/goodbye"}})
+
+	assert.ErrorContains(t, err, "Extract: some files not found: ", "florist.Extract")
+}
+
+func TestExtractMalicious(t *testing.T) {
+	provisioner.LowLevelInit(io.Discard, "Info")
+
+	type testCase struct {
+		name    string
+		entries []entry
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		tmpDir := t.TempDir()
+		dstDir := filepath.Join(tmpDir, "dst")
+		assert.NoError(t, os.Mkdir(dstDir, 0o755), "os.Mkdir")
+		opts := florist.ExtractOptions{Symlinks: true}
+
+		for _, archive := range []string{
+			writeTar(t, tmpDir, tc.entries),
+			writeZip(t, tmpDir, tc.entries),
+		} {
+			err := florist.Extract(archive, dstDir, opts)
+
+			assert.ErrorContains(t, err, tc.wantErr, "florist.Extract "+archive)
+			_, err = os.Lstat(filepath.Join(tmpDir, "evil"))
+			assert.True(t, errors.Is(err, fs.ErrNotExist), "nothing outside of dstDir")
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name:    "zip slip",
+			entries: []entry{{name: "../evil", body: "gotcha"}},
+			wantErr: `found insecure path "../evil"`,
+		},
+		{
+			name:    "absolute path",
+			entries: []entry{{name: "/evil", body: "gotcha"}},
+			wantErr: `found insecure path "/evil"`,
+		},
+		{
+			name:    "symlink escaping",
+			entries: []entry{{name: "a/link", link: "../../evil"}},
+			wantErr: `symlink "a/link" points outside of the destination: "../../evil"`,
+		},
+		{
+			name: "symlink chain escaping",
+			entries: []entry{
+				{name: "a", link: "."},
+				{name: "a/b", link: ".."},
+			},
+			wantErr: `symlink "a/b" points outside of the destination: ".."`,
+		},
+		{
+			name:    "absolute symlink",
+			entries: []entry{{name: "link", link: "/etc/passwd"}},
+			wantErr: `symlink "link" points outside of the destination: "/etc/passwd"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestExtractOne(t *testing.T) {
+	provisioner.LowLevelInit(io.Discard, "Info")
+	dstDir := t.TempDir()
+
+	for _, archive := range []string{"hello-1.0.tar.xz", "hello-1.0.zip"} {
+		dstPath := filepath.Join(dstDir, archive)
+
+		err := florist.ExtractOne(filepath.Join("testdata/archive", archive),
+			"hello-1.0/etc/hello.conf", dstPath)
+
+		assert.NoError(t, err, "florist.ExtractOne "+archive)
+		assert.FileEqualsString(t, dstPath, "greeting = hello\n")
+	}
+}
+
+// entry is an entry of the archives built by writeTar and writeZip: a regular file
+// with contents body or, if link is not empty, a symlink to link.
+type entry struct {
+	name string
+	body string
+	link string
+}
+
+func writeTar(t *testing.T, dir string, entries []entry) string {
+	t.Helper()
+	fpath := filepath.Join(dir, "malicious.tar")
+	fi, err := os.Create(fpath)
+	assert.NoError(t, err, "os.Create")
+	defer fi.Close()
+	tw := tar.NewWriter(fi)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)),
+			Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0o777, Linkname: e.link,
+				Typeflag: tar.TypeSymlink}
+		}
+		assert.NoError(t, tw.WriteHeader(hdr), "tw.WriteHeader")
+		_, err := tw.Write([]byte(e.body))
+		assert.NoError(t, err, "tw.Write")
+	}
+	assert.NoError(t, tw.Close(), "tw.Close")
+	return fpath
+}
+
+func writeZip(t *testing.T, dir string, entries []entry) string {
+	t.Helper()
+	fpath := filepath.Join(dir, "malicious.zip")
+	fi, err := os.Create(fpath)
+	assert.NoError(t, err, "os.Create")
+	defer fi.Close()
+	zw := zip.NewWriter(fi)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		hdr.SetMode(0o644)
+		if e.link != "" {
+			hdr.SetMode(fs.ModeSymlink | 0o777)
+			body = e.link
+		}
+		w, err := zw.CreateHeader(hdr)
+		assert.NoError(t, err, "zw.CreateHeader")
+		_, err = w.Write([]byte(body))
+		assert.NoError(t, err, "w.Write")
+	}
+	assert.NoError(t, zw.Close(), "zw.Close")
+	return fpath
+}
+
+func assertMode(t *testing.T, fpath string, want fs.FileMode) {
+	t.Helper()
+	fi, err := os.Lstat(fpath)
+	assert.NoError(t, err, "os.Lstat")
+	assert.Equal(t, fi.Mode(), want, "mode of "+fpath)
+}
@@ -0,0 +1,139 @@
+package florist
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Artifact is a file downloaded by a flower during Install, with the information to
+// verify it: Hash, ChecksumFile or SignatureURL and Verifier. See [Artifacter].
+type Artifact struct {
+	URL string
+	// Algorithm of Hash. Default: SHA256.
+	HashType Hash
+	Hash     string
+	// Take the hash from a checksum file. See [NetFetchChecksumFile].
+	ChecksumFile *ChecksumFile
+	// Verify with a detached signature. See [NetFetchSigned].
+	SignatureURL string
+	Verifier     Verifier
+}
+
+// Artifacter is implemented by the flowers that download files during Install, so
+// that the files can be fetched in advance to an artifact cache (see
+// [ArtifactSource] and the fetch-artifacts subcommand of the provisioner).
+type Artifacter interface {
+	// Artifacts returns the files that Install downloads. Called after Init.
+	Artifacts() ([]Artifact, error)
+}
+
+// Fetch downloads the artifact to dstDir, returning the path of the downloaded file.
+// It calls [NetFetch], [NetFetchChecksumFile] or [NetFetchSigned] depending on the
+// fields of art.
+func (art Artifact) Fetch(client *http.Client, dstDir string) (string, error) {
+	switch {
+	case art.ChecksumFile != nil:
+		return NetFetchChecksumFile(client, art.URL, *art.ChecksumFile, dstDir)
+	case art.Verifier != nil:
+		return NetFetchSigned(client, art.URL, art.SignatureURL, art.Verifier, dstDir)
+	default:
+		hashType := art.HashType
+		if hashType == 0 {
+			hashType = SHA256
+		}
+		return NetFetch(client, art.URL, hashType, art.Hash, dstDir)
+	}
+}
+
+// ArtifactSource configures where [NetFetch] takes the files from, to build in a
+// restricted network. See [SetArtifactSource].
+type ArtifactSource struct {
+	// Local cache directory. If a file is in the cache (and its hash matches), it is
+	// taken from there instead of downloading it; a downloaded file is added to the
+	// cache. The cache has the layout of the URLs: file
+	// https://releases.hashicorp.com/consul/1.20.1/consul_1.20.1_linux_amd64.zip is
+	// DIR/releases.hashicorp.com/consul/1.20.1/consul_1.20.1_linux_amd64.zip, so
+	// that the directory can also be served as a mirror.
+	CacheDir string
+	// Never download: fail if a file is not in the cache.
+	Offline bool
+	// URL prefix rewrites, for example "https://releases.hashicorp.com/" to
+	// "https://mirror.example.com/hashicorp/". The longest matching prefix wins.
+	// The cache always uses the original URL.
+	Mirrors map[string]string
+}
+
+var artifactSource ArtifactSource
+
+// SetArtifactSource makes [NetFetch] use src, returning the previous one. The zero
+// value means to always download from the original URL.
+func SetArtifactSource(src ArtifactSource) ArtifactSource {
+	netTransportMu.Lock()
+	defer netTransportMu.Unlock()
+	prev := artifactSource
+	artifactSource = src
+	return prev
+}
+
+// rewrite returns rawURL, rewritten with the longest matching prefix of Mirrors.
+func (src ArtifactSource) rewrite(rawURL string) string {
+	var longest string
+	for prefix := range src.Mirrors {
+		if strings.HasPrefix(rawURL, prefix) && len(prefix) > len(longest) {
+			longest = prefix
+		}
+	}
+	if longest == "" {
+		return rawURL
+	}
+	return src.Mirrors[longest] + strings.TrimPrefix(rawURL, longest)
+}
+
+// cachePath returns the path of rawURL in the cache, or the empty string if there
+// is no cache.
+func (src ArtifactSource) cachePath(rawURL string) (string, error) {
+	if src.CacheDir == "" {
+		return "", nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	// Clean the path as if it were absolute, to stay below CacheDir. The host must
+	// be a plain name: "https://../x" would escape CacheDir.
+	rel := filepath.Join(u.Host, filepath.Clean("/"+u.Path))
+	if u.Host == "" || u.Host == "." || u.Host == ".." || rel == u.Host ||
+		!filepath.IsLocal(rel) {
+		return "", fmt.Errorf("cannot cache URL %s", rawURL)
+	}
+	return filepath.Join(src.CacheDir, rel), nil
+}
+
+// copyPlain copies file src to dst, creating the parent directory of dst. Contrary to
+// [CopyFile], it does not change owner and group and it writes dst atomically.
+func copyPlain(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, errCopy := io.Copy(out, in)
+	if err := JoinErrors(errCopy, out.Close()); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
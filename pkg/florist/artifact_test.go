@@ -0,0 +1,99 @@
+package florist_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+// setArtifactSource makes NetFetch use src, restoring the default at the end of the
+// test.
+func setArtifactSource(t *testing.T, src florist.ArtifactSource) {
+	prev := florist.SetArtifactSource(src)
+	t.Cleanup(func() { florist.SetArtifactSource(prev) })
+}
+
+func TestArtifactSourceCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			fmt.Fprint(w, "banana")
+		},
+	))
+	defer ts.Close()
+	art := florist.Artifact{URL: ts.URL + "/fruits/banana", Hash: bananaSHA256}
+
+	// Online: the download is added to the cache.
+	setArtifactSource(t, florist.ArtifactSource{CacheDir: cacheDir})
+	fpath, err := art.Fetch(nil, t.TempDir())
+	assert.NoError(t, err, "art.Fetch online")
+	assert.FileEqualsString(t, fpath, "banana")
+	cached := filepath.Join(cacheDir, ts.Listener.Addr().String(), "fruits/banana")
+	assert.FileEqualsString(t, cached, "banana")
+
+	// Offline: the file is taken from the cache.
+	ts.Close()
+	setArtifactSource(t, florist.ArtifactSource{CacheDir: cacheDir, Offline: true})
+	fpath, err = art.Fetch(nil, t.TempDir())
+	assert.NoError(t, err, "art.Fetch offline")
+	assert.FileEqualsString(t, fpath, "banana")
+	assert.DeepEqual(t, requests, []string{"/fruits/banana"}, "requests")
+
+	// Offline, the file in the cache does not match.
+	err = os.WriteFile(cached, []byte("cherry"), 0o644)
+	assert.NoError(t, err, "os.WriteFile")
+	_, err = art.Fetch(nil, t.TempDir())
+	assert.ErrorContains(t, err, "NetFetch: offline: "+art.URL+
+		": not in the artifact cache ("+cacheDir+")", "art.Fetch offline")
+}
+
+func TestArtifactSourceCacheInvalidURL(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	setArtifactSource(t, florist.ArtifactSource{CacheDir: cacheDir, Offline: true})
+
+	for _, url := range []string{"https://../x", "https://./x", "https://host/"} {
+		art := florist.Artifact{URL: url, Hash: bananaSHA256}
+
+		_, err := art.Fetch(nil, t.TempDir())
+
+		assert.ErrorContains(t, err, "cannot cache URL "+url, "art.Fetch "+url)
+	}
+}
+
+func TestArtifactSourceMirror(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			fmt.Fprint(w, "banana")
+		},
+	))
+	defer ts.Close()
+	setArtifactSource(t, florist.ArtifactSource{
+		Mirrors: map[string]string{
+			"https://releases.example.com/":       ts.URL + "/releases/",
+			"https://releases.example.com/fruit/": ts.URL + "/fruit-mirror/",
+		},
+	})
+
+	fpath, err := florist.NetFetch(nil, "https://releases.example.com/fruit/1.0/banana",
+		florist.SHA256, bananaSHA256, t.TempDir())
+	assert.NoError(t, err, "florist.NetFetch")
+	assert.FileEqualsString(t, fpath, "banana")
+
+	_, err = florist.NetFetch(nil, "https://releases.example.com/veggies/banana",
+		florist.SHA256, bananaSHA256, t.TempDir())
+	assert.NoError(t, err, "florist.NetFetch")
+
+	assert.DeepEqual(t, requests,
+		[]string{"/fruit-mirror/1.0/banana", "/releases/veggies/banana"}, "requests")
+}
@@ -0,0 +1,291 @@
+package florist
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Hash is a hash algorithm, to verify the files downloaded by [NetFetch].
+type Hash int
+
+const (
+	SHA256 Hash = iota + 1
+	SHA512
+	// BLAKE2b is BLAKE2b-512, as computed by b2sum.
+	BLAKE2b
+)
+
+var hashNames = map[Hash]string{
+	SHA256:  "SHA256",
+	SHA512:  "SHA512",
+	BLAKE2b: "BLAKE2b",
+}
+
+func (h Hash) String() string {
+	if name, ok := hashNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("Hash(%d)", int(h))
+}
+
+// Available reports whether h is a known hash algorithm.
+func (h Hash) Available() bool {
+	_, ok := hashNames[h]
+	return ok
+}
+
+// New returns a new hash.Hash computing h. It panics if h is not available.
+func (h Hash) New() hash.Hash {
+	switch h {
+	case SHA256:
+		return sha256.New()
+	case SHA512:
+		return sha512.New()
+	case BLAKE2b:
+		hasher, _ := blake2b.New512(nil) // Cannot fail without a key.
+		return hasher
+	default:
+		panic("florist: unknown hash " + h.String())
+	}
+}
+
+// Size returns the length, in bytes, of a digest of h.
+func (h Hash) Size() int {
+	return h.New().Size()
+}
+
+// hashFile returns the hex-encoded hash of file fpath.
+func hashFile(fpath string, hashType Hash) (string, error) {
+	fi, err := os.Open(fpath)
+	if err != nil {
+		return "", err
+	}
+	defer fi.Close()
+	hasher := hashType.New()
+	if _, err := io.Copy(hasher, fi); err != nil {
+		return "", fmt.Errorf("reading %s: %w", fpath, err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// ChecksumFile is an upstream file listing the hashes of the artifacts of a release,
+// such as SHA256SUMS, the HashiCorp consul_1.20.1_SHA256SUMS or the GitHub
+// checksums.txt made by GoReleaser. It allows to verify a download without pasting
+// its hash in the configuration. See [NetFetchChecksumFile] and [ParseChecksums].
+type ChecksumFile struct {
+	// URL of the checksum file.
+	URL string
+	// Algorithm of the hashes in the file. Default: SHA256.
+	HashType Hash
+	// Optional SHA-256 of the checksum file itself. Since the checksum file is
+	// downloaded from the same place as the artifacts, on its own it protects only
+	// from corruption, not from tampering; pinning it gives the same guarantees as
+	// pasting the hash of the artifact, with one hash for all the artifacts of a
+	// release.
+	Pin string
+	// Optional URL of a detached signature of the checksum file, verified with
+	// Verifier. This is how HashiCorp publishes its releases
+	// (consul_1.20.1_SHA256SUMS.sig).
+	SignatureURL string
+	Verifier     Verifier
+}
+
+// Verifier verifies a detached signature of data. Package signature provides
+// verifiers for OpenPGP, minisign and ed25519.
+type Verifier interface {
+	Verify(data io.Reader, sig []byte) error
+}
+
+// Lookup downloads the checksum file to dstDir and returns the hash of the artifact
+// named name (the last element of its URL).
+func (cf ChecksumFile) Lookup(client *http.Client, name string, dstDir string) (string, error) {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("ChecksumFile.Lookup: "+format, a...)
+	}
+	hashType := cmp.Or(cf.HashType, SHA256)
+	if !hashType.Available() {
+		return "", errorf("unknown hash type %d", hashType)
+	}
+	if (cf.SignatureURL == "") != (cf.Verifier == nil) {
+		return "", errorf("SignatureURL and Verifier must be set together")
+	}
+
+	var fpath string
+	var err error
+	if cf.Pin != "" {
+		fpath, err = netFetch(client, cf.URL, SHA256, cf.Pin, dstDir)
+	} else {
+		fpath, err = netFetch(client, cf.URL, 0, "", dstDir)
+	}
+	if err != nil {
+		return "", errorf("%w", err)
+	}
+	data, err := os.ReadFile(Path(fpath))
+	if err != nil {
+		return "", errorf("%s", err)
+	}
+	if cf.Verifier != nil {
+		sig, err := fetchSignature(client, cf.SignatureURL, dstDir)
+		if err != nil {
+			return "", errorf("%w", err)
+		}
+		if err := cf.Verifier.Verify(bytes.NewReader(data), sig); err != nil {
+			return "", errorf("%s: %s", cf.URL, err)
+		}
+	}
+	sums, err := ParseChecksums(data, hashType)
+	if err != nil {
+		return "", errorf("%s: %s", cf.URL, err)
+	}
+	sum, found := sums[name]
+	if !found {
+		return "", errorf("%s: no %s checksum for %s", cf.URL, hashType, name)
+	}
+	return sum, nil
+}
+
+// NetFetchChecksumFile is like [NetFetch], taking the expected hash of url from the
+// checksum file cf.
+func NetFetchChecksumFile(client *http.Client, url string, cf ChecksumFile, dstDir string) (string, error) {
+	if client == nil {
+		client = NewNetClient()
+	}
+	hash, err := cf.Lookup(client, path.Base(url), dstDir)
+	if err != nil {
+		return "", fmt.Errorf("NetFetchChecksumFile: %w", err)
+	}
+	return NetFetch(client, url, cmp.Or(cf.HashType, SHA256), hash, dstDir)
+}
+
+// NetFetchSigned is like [NetFetch], verifying the download with the detached
+// signature at sigURL instead of with a hash. Use it for projects that sign each
+// artifact, as Go does (go1.23.4.linux-amd64.tar.gz.asc).
+// If the file in dstDir exists and the signature matches, it will not be
+// redownloaded. If the signature doesn't match, the downloaded file is removed.
+func NetFetchSigned(client *http.Client, url string, sigURL string, verifier Verifier, dstDir string) (string, error) {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("NetFetchSigned: "+format, a...)
+	}
+	if verifier == nil {
+		return "", errorf("missing verifier")
+	}
+	if client == nil {
+		client = NewNetClient()
+	}
+	sig, err := fetchSignature(client, sigURL, dstDir)
+	if err != nil {
+		return "", errorf("%w", err)
+	}
+	verify := func(fpath string) error {
+		fi, err := os.Open(Path(fpath))
+		if err != nil {
+			return err
+		}
+		defer fi.Close()
+		return verifier.Verify(fi, sig)
+	}
+
+	dstPath := path.Join(dstDir, path.Base(url))
+	if err := verify(dstPath); err == nil {
+		slog.Debug("file exist locally, signature matches, skipping download",
+			"file", dstPath)
+		return dstPath, nil
+	}
+	if _, err := netFetch(client, url, 0, "", dstDir); err != nil {
+		return "", errorf("%w", err)
+	}
+	if err := verify(dstPath); err != nil {
+		os.Remove(Path(dstPath))
+		return "", errorf("%s: %s", url, err)
+	}
+	return dstPath, nil
+}
+
+// fetchSignature downloads the signature at url to dstDir and returns it.
+func fetchSignature(client *http.Client, url string, dstDir string) ([]byte, error) {
+	fpath, err := netFetch(client, url, 0, "", dstDir)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(Path(fpath))
+}
+
+// ParseChecksums parses a checksum file, returning the hex-encoded hashes by file
+// name. It understands the format of sha256sum and friends, used also by HashiCorp
+// and GoReleaser:
+//
+//	HASH  NAME
+//	HASH *NAME
+//
+// and the BSD format (sha256sum --tag), where it skips the lines of other
+// algorithms:
+//
+//	SHA256 (NAME) = HASH
+//
+// Only the last element of each name is kept, so that "./dist/foo.zip" becomes
+// "foo.zip". Empty lines and lines starting with # are ignored.
+func ParseChecksums(data []byte, hashType Hash) (map[string]string, error) {
+	if !hashType.Available() {
+		return nil, fmt.Errorf("unknown hash type %d", hashType)
+	}
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineN := 1; scanner.Scan(); lineN++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var name, sum string
+		if algo, rest, found := strings.Cut(line, " ("); found &&
+			!strings.Contains(algo, " ") {
+			// BSD format.
+			name, sum, found = strings.Cut(rest, ") = ")
+			if !found {
+				return nil, fmt.Errorf("line %d: invalid format", lineN)
+			}
+			// b2sum writes BLAKE2b, shasum and openssl write SHA2-256 or SHA256.
+			algo = strings.ReplaceAll(strings.ToUpper(algo), "SHA2-", "SHA")
+			if algo != strings.ToUpper(hashType.String()) {
+				continue
+			}
+		} else {
+			var found bool
+			sum, name, found = strings.Cut(line, " ")
+			if !found {
+				return nil, fmt.Errorf("line %d: invalid format", lineN)
+			}
+			// Two spaces for text mode, space and star for binary mode.
+			name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		}
+		sum = strings.ToLower(sum)
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != 2*hashType.Size() {
+			return nil, fmt.Errorf("line %d: not a %s hash: %s", lineN, hashType, sum)
+		}
+		name = path.Base(name)
+		if name == "." || name == "/" {
+			return nil, fmt.Errorf("line %d: missing file name", lineN)
+		}
+		if prev, found := sums[name]; found && prev != sum {
+			return nil, fmt.Errorf("line %d: conflicting checksums for %s", lineN, name)
+		}
+		sums[name] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
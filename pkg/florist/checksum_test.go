@@ -0,0 +1,353 @@
+package florist_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/signature"
+)
+
+const (
+	bananaSHA256 = "b493d48364afe44d11c0165cf470a4164d1e2609911ef998be868d46ade3de4e"
+	bananaSHA512 = "f8e3183d38e6c51889582cb260ab825252f395b4ac8fb0e6b13e9a71f7c10a80" +
+		"d5301e4a949f2783cb0c20205f1d850f87045f4420ad2271c8fd5f0cd8944be3"
+	bananaBLAKE2b = "d4afa3130126ddcc01bb49e1388b0fbc94c185d1a07a67046a5b66923c38e178" +
+		"f490bc9b91a7e41c2d670be3c8435e5914b5cb5ee0d0ff52d9a783f601b18794"
+)
+
+func TestNetFetchHashTypes(t *testing.T) {
+	type testCase struct {
+		hashType florist.Hash
+		hash     string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		dir := t.TempDir()
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "banana")
+			},
+		))
+		defer ts.Close()
+
+		fpath, err := florist.NetFetch(nil, ts.URL+"/banana", tc.hashType, tc.hash, dir)
+
+		assert.NoError(t, err, "florist.NetFetch")
+		assert.FileEqualsString(t, fpath, "banana")
+	}
+
+	testCases := []testCase{
+		{florist.SHA256, bananaSHA256},
+		{florist.SHA512, bananaSHA512},
+		{florist.BLAKE2b, bananaBLAKE2b},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.hashType.String(), func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestParseChecksumsSuccess(t *testing.T) {
+	type testCase struct {
+		name     string
+		data     string
+		hashType florist.Hash
+		want     map[string]string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		sums, err := florist.ParseChecksums([]byte(tc.data), tc.hashType)
+
+		assert.NoError(t, err, "florist.ParseChecksums")
+		assert.DeepEqual(t, sums, tc.want, "checksums")
+	}
+
+	testCases := []testCase{
+		{
+			name: "sha256sum, text and binary mode",
+			data: bananaSHA256 + "  banana\n" +
+				strings.Repeat("a", 64) + " *apple.zip\n",
+			hashType: florist.SHA256,
+			want: map[string]string{
+				"banana":    bananaSHA256,
+				"apple.zip": strings.Repeat("a", 64),
+			},
+		},
+		{
+			name: "GoReleaser with directories, comments and uppercase",
+			data: "# checksums\n\n" +
+				strings.ToUpper(bananaSHA256) + "  ./dist/banana_linux_amd64.tar.gz\r\n",
+			hashType: florist.SHA256,
+			want:     map[string]string{"banana_linux_amd64.tar.gz": bananaSHA256},
+		},
+		{
+			name: "BSD format, mixed algorithms",
+			data: "SHA256 (banana) = " + bananaSHA256 + "\n" +
+				"SHA512 (banana) = " + bananaSHA512 + "\n" +
+				"BLAKE2b (banana) = " + bananaBLAKE2b + "\n",
+			hashType: florist.SHA512,
+			want:     map[string]string{"banana": bananaSHA512},
+		},
+		{
+			name:     "BSD format, shasum style",
+			data:     "SHA2-256 (banana (1).txt) = " + bananaSHA256 + "\n",
+			hashType: florist.SHA256,
+			want:     map[string]string{"banana (1).txt": bananaSHA256},
+		},
+		{
+			name:     "b2sum",
+			data:     bananaBLAKE2b + "  banana\n",
+			hashType: florist.BLAKE2b,
+			want:     map[string]string{"banana": bananaBLAKE2b},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestParseChecksumsFailure(t *testing.T) {
+	type testCase struct {
+		name     string
+		data     string
+		hashType florist.Hash
+		wantErr  string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		_, err := florist.ParseChecksums([]byte(tc.data), tc.hashType)
+
+		assert.ErrorContains(t, err, tc.wantErr, "florist.ParseChecksums")
+	}
+
+	testCases := []testCase{
+		{
+			name:     "wrong algorithm",
+			data:     "\n" + bananaSHA256 + "  banana\n",
+			hashType: florist.SHA512,
+			wantErr:  "line 2: not a SHA512 hash: " + bananaSHA256,
+		},
+		{
+			name:     "no name",
+			data:     bananaSHA256 + "\n",
+			hashType: florist.SHA256,
+			wantErr:  "line 1: invalid format",
+		},
+		{
+			name: "conflicting",
+			data: bananaSHA256 + "  a/banana\n" +
+				strings.Repeat("0", 64) + "  b/banana\n",
+			hashType: florist.SHA256,
+			wantErr:  "line 2: conflicting checksums for banana",
+		},
+		{
+			name:     "unknown hash type",
+			hashType: 42,
+			wantErr:  "unknown hash type 42",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestNetFetchChecksumFile(t *testing.T) {
+	sums := "SHA512 (banana) = " + bananaSHA512 + "\n" +
+		"SHA512 (cherry) = " + strings.Repeat("0", 128) + "\n"
+	sumsHash := sha256.Sum256([]byte(sums))
+
+	type testCase struct {
+		name    string
+		url     string
+		pin     string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		dir := t.TempDir()
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/SHA512SUMS":
+					fmt.Fprint(w, sums)
+				default:
+					fmt.Fprint(w, "banana")
+				}
+			},
+		))
+		defer ts.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+		cf := florist.ChecksumFile{
+			URL:      ts.URL + "/SHA512SUMS",
+			HashType: florist.SHA512,
+			Pin:      tc.pin,
+		}
+
+		fpath, err := florist.NetFetchChecksumFile(client, ts.URL+tc.url, cf, dir)
+
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr, "florist.NetFetchChecksumFile")
+			return
+		}
+		assert.NoError(t, err, "florist.NetFetchChecksumFile")
+		assert.FileEqualsString(t, fpath, "banana")
+	}
+
+	testCases := []testCase{
+		{
+			name: "not pinned",
+			url:  "/banana",
+		},
+		{
+			name: "pinned",
+			url:  "/banana",
+			pin:  hex.EncodeToString(sumsHash[:]),
+		},
+		{
+			name: "pin mismatch",
+			url:  "/banana",
+			pin:  bananaSHA256,
+			wantErr: "NetFetchChecksumFile: ChecksumFile.Lookup: NetFetch: hash mismatch: " +
+				"have: " + hex.EncodeToString(sumsHash[:]),
+		},
+		{
+			name:    "hash mismatch",
+			url:     "/cherry",
+			wantErr: "NetFetch: hash mismatch: have: " + bananaSHA512,
+		},
+		{
+			name:    "missing from checksum file",
+			url:     "/apple",
+			wantErr: "/SHA512SUMS: no SHA512 checksum for apple",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestNetFetchSigned(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "ed25519.GenerateKey")
+	verifier, err := signature.NewEd25519(base64.StdEncoding.EncodeToString(pub))
+	assert.NoError(t, err, "signature.NewEd25519")
+	sign := func(data string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(data)))
+	}
+	sums := bananaSHA256 + "  banana\n"
+
+	type testCase struct {
+		name    string
+		files   map[string]string
+		fetch   func(client *http.Client, baseURL string, dir string) (string, error)
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		dir := t.TempDir()
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				contents, found := tc.files[r.URL.Path]
+				if !found {
+					http.NotFound(w, r)
+					return
+				}
+				fmt.Fprint(w, contents)
+			},
+		))
+		defer ts.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		fpath, err := tc.fetch(client, ts.URL, dir)
+
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr, "fetch")
+			_, err := os.Stat(filepath.Join(dir, "banana"))
+			assert.True(t, os.IsNotExist(err), "banana should not exist")
+			return
+		}
+		assert.NoError(t, err, "fetch")
+		assert.FileEqualsString(t, fpath, "banana")
+	}
+
+	checksumFile := func(client *http.Client, baseURL string, dir string) (string, error) {
+		return florist.NetFetchChecksumFile(client, baseURL+"/banana", florist.ChecksumFile{
+			URL:          baseURL + "/SHA256SUMS",
+			SignatureURL: baseURL + "/SHA256SUMS.sig",
+			Verifier:     verifier,
+		}, dir)
+	}
+	signed := func(client *http.Client, baseURL string, dir string) (string, error) {
+		return florist.NetFetchSigned(client, baseURL+"/banana", baseURL+"/banana.sig",
+			verifier, dir)
+	}
+
+	testCases := []testCase{
+		{
+			name: "signed checksum file",
+			files: map[string]string{
+				"/banana":         "banana",
+				"/SHA256SUMS":     sums,
+				"/SHA256SUMS.sig": sign(sums),
+			},
+			fetch: checksumFile,
+		},
+		{
+			name: "signed checksum file, bad signature",
+			files: map[string]string{
+				"/banana":         "banana",
+				"/SHA256SUMS":     sums,
+				"/SHA256SUMS.sig": sign("cherry"),
+			},
+			fetch:   checksumFile,
+			wantErr: "/SHA256SUMS: ed25519: invalid signature",
+		},
+		{
+			name: "signed checksum file, missing signature",
+			files: map[string]string{
+				"/banana":     "banana",
+				"/SHA256SUMS": sums,
+			},
+			fetch:   checksumFile,
+			wantErr: "NetFetch: received 404 Not Found",
+		},
+		{
+			name: "signed artifact",
+			files: map[string]string{
+				"/banana":     "banana",
+				"/banana.sig": sign("banana"),
+			},
+			fetch: signed,
+		},
+		{
+			name: "signed artifact, bad signature",
+			files: map[string]string{
+				"/banana":     "banana",
+				"/banana.sig": sign("cherry"),
+			},
+			fetch:   signed,
+			wantErr: "/banana: ed25519: invalid signature",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
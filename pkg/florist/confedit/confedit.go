@@ -0,0 +1,288 @@
+// Package confedit parses and edits in place common configuration file formats,
+// preserving comments, blank lines and the order of the existing entries. This allows
+// a flower to set only the options it cares about, instead of shipping a whole file.
+//
+// Supported formats:
+//
+//   - [Sshd]: "key value", as used by sshd_config(5), including Match blocks.
+//   - [Env]: "key=value", as used by /etc/default/* and /etc/environment.
+//   - [Ini]: "[section]" and "key=value", as used by systemd units and sysctl.conf.
+//
+// The editors do not know anything about the semantics of the options: they do not
+// validate keys nor values. Use the program owning the file to validate it (for
+// example: "sshd -t").
+package confedit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+// Document is implemented by all the editors of this package.
+type Document interface {
+	// String returns the document, ready to be written to a file.
+	String() string
+}
+
+// EditFile reads file 'fname', parses it with 'parse', calls 'edit' on the parsed
+// document and, if the document changed, writes it back with 'mode', 'owner' and
+// 'group'. It returns true if the file changed.
+//
+// Example:
+//
+//	changed, err := confedit.EditFile("/etc/ssh/sshd_config", confedit.ParseSshd,
+//		func(doc *confedit.Sshd) error {
+//			doc.Set("PasswordAuthentication", "no")
+//			return nil
+//		}, 0o644, "root", "root")
+func EditFile[T Document](
+	fname string,
+	parse func(text string) (T, error),
+	edit func(doc T) error,
+	mode os.FileMode, owner string, group string,
+) (bool, error) {
+	errorf := makeErrorf("confedit.EditFile")
+
+	buf, err := os.ReadFile(florist.Path(fname))
+	if err != nil {
+		return false, errorf("%s", err)
+	}
+	before := string(buf)
+	doc, err := parse(before)
+	if err != nil {
+		return false, errorf("%s: %s", fname, err)
+	}
+	if err := edit(doc); err != nil {
+		return false, errorf("%s: %s", fname, err)
+	}
+	after := doc.String()
+	if after == before {
+		return false, nil
+	}
+	if err := florist.WriteFile(fname, after, mode, owner, group); err != nil {
+		return false, errorf("%s", err)
+	}
+	return true, nil
+}
+
+// syntax describes how a given format represents a key/value entry.
+type syntax struct {
+	// parse splits a non-comment, non-blank line into key and value.
+	// It returns false if the line is not a key/value entry.
+	parse func(line string) (key, value string, ok bool)
+	// format returns the line for key and value.
+	format func(key, value string) string
+	// foldCase is true if keys are case-insensitive.
+	foldCase bool
+	// firstWins is true if, for duplicated keys, the first occurrence is the
+	// effective one (sshd). Otherwise, the last occurrence wins.
+	firstWins bool
+	// comments are the characters that start a comment line.
+	comments string
+}
+
+func (syn *syntax) isComment(trimmed string) bool {
+	return trimmed != "" && strings.ContainsRune(syn.comments, rune(trimmed[0]))
+}
+
+// entry is one line of a configuration file.
+type entry struct {
+	raw string
+	// key is empty for blank lines, comments and any line not understood.
+	key   string
+	value string
+}
+
+// section is a sequence of lines sharing the same scope: the whole file, an INI
+// section, or a sshd Match block.
+type section struct {
+	syn     *syntax
+	entries []*entry
+	// indent is prepended to the lines added to the section.
+	indent string
+}
+
+func (sec *section) add(line string) {
+	sec.entries = append(sec.entries, sec.parseLine(line))
+}
+
+func (sec *section) parseLine(line string) *entry {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || sec.syn.isComment(trimmed) {
+		return &entry{raw: line}
+	}
+	key, value, ok := sec.syn.parse(trimmed)
+	if !ok {
+		return &entry{raw: line}
+	}
+	return &entry{raw: line, key: key, value: value}
+}
+
+func (sec *section) sameKey(a, b string) bool {
+	if sec.syn.foldCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// find returns the indexes of the entries with 'key', in file order.
+func (sec *section) find(key string) []int {
+	var idxs []int
+	for i, e := range sec.entries {
+		if e.key != "" && sec.sameKey(e.key, key) {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
+
+// effective returns the index of the entry that the program reading the file will
+// use for 'key', or -1 if not found.
+func (sec *section) effective(key string) int {
+	idxs := sec.find(key)
+	if len(idxs) == 0 {
+		return -1
+	}
+	if sec.syn.firstWins {
+		return idxs[0]
+	}
+	return idxs[len(idxs)-1]
+}
+
+func (sec *section) get(key string) (string, bool) {
+	i := sec.effective(key)
+	if i < 0 {
+		return "", false
+	}
+	return sec.entries[i].value, true
+}
+
+func (sec *section) values(key string) []string {
+	var values []string
+	for _, i := range sec.find(key) {
+		values = append(values, sec.entries[i].value)
+	}
+	return values
+}
+
+// set sets 'key' to 'value', removing any other occurrence of 'key'. If 'key' is not
+// present, set adds it after its commented-out occurrence (for example "#Port 22"), if
+// any, otherwise at the end of the section.
+func (sec *section) set(key, value string) {
+	line := sec.indent + sec.syn.format(key, value)
+	idxs := sec.find(key)
+	if len(idxs) == 0 {
+		sec.insert(sec.insertionPoint(key), line)
+		return
+	}
+
+	keep := sec.effective(key)
+	e := sec.entries[keep]
+	if e.value != value {
+		// Preserve the original indentation.
+		indent := e.raw[:len(e.raw)-len(strings.TrimLeft(e.raw, " \t"))]
+		sec.entries[keep] = sec.parseLine(indent + sec.syn.format(key, value))
+	}
+	sec.remove(idxs, keep)
+}
+
+// appendValue adds another occurrence of 'key' with 'value', after the last
+// occurrence of 'key', if any.
+func (sec *section) appendValue(key, value string) {
+	line := sec.indent + sec.syn.format(key, value)
+	idxs := sec.find(key)
+	if len(idxs) == 0 {
+		sec.insert(sec.insertionPoint(key), line)
+		return
+	}
+	sec.insert(idxs[len(idxs)-1]+1, line)
+}
+
+// del removes all the occurrences of 'key'. It returns true if any was found.
+func (sec *section) del(key string) bool {
+	idxs := sec.find(key)
+	sec.remove(idxs, -1)
+	return len(idxs) > 0
+}
+
+// remove removes the entries at 'idxs', except 'keep'.
+func (sec *section) remove(idxs []int, keep int) {
+	drop := make(map[int]bool, len(idxs))
+	for _, i := range idxs {
+		if i != keep {
+			drop[i] = true
+		}
+	}
+	if len(drop) == 0 {
+		return
+	}
+	entries := sec.entries[:0]
+	for i, e := range sec.entries {
+		if !drop[i] {
+			entries = append(entries, e)
+		}
+	}
+	sec.entries = entries
+}
+
+func (sec *section) insert(i int, line string) {
+	sec.entries = append(sec.entries, nil)
+	copy(sec.entries[i+1:], sec.entries[i:])
+	sec.entries[i] = sec.parseLine(line)
+}
+
+// insertionPoint returns where to add a new 'key': after the last commented-out
+// occurrence of 'key' or, if none, after the last entry of the section or, if none,
+// after the last non-blank line of the section.
+func (sec *section) insertionPoint(key string) int {
+	for i := len(sec.entries) - 1; i >= 0; i-- {
+		raw := strings.TrimSpace(sec.entries[i].raw)
+		if !sec.syn.isComment(raw) {
+			continue
+		}
+		// A commented-out option has no space after the comment character, to
+		// distinguish it from prose ("#Port 22" vs "# Port forwarding").
+		commented := raw[1:]
+		if commented == "" || commented[0] == ' ' || commented[0] == '\t' {
+			continue
+		}
+		if k, _, ok := sec.syn.parse(commented); ok && sec.sameKey(k, key) {
+			return i + 1
+		}
+	}
+	for i := len(sec.entries) - 1; i >= 0; i-- {
+		if sec.entries[i].key != "" {
+			return i + 1
+		}
+	}
+	for i := len(sec.entries) - 1; i >= 0; i-- {
+		if strings.TrimSpace(sec.entries[i].raw) != "" {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (sec *section) write(bld *strings.Builder) {
+	for _, e := range sec.entries {
+		bld.WriteString(e.raw)
+		bld.WriteByte('\n')
+	}
+}
+
+// splitLines splits 'text' in lines. A final newline does not produce an empty line.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func makeErrorf(prefix string) func(format string, a ...any) error {
+	return func(format string, a ...any) error {
+		return fmt.Errorf(prefix+": "+format, a...)
+	}
+}
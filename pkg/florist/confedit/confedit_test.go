@@ -0,0 +1,33 @@
+package confedit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/florist/confedit"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestEditFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "tailscaled")
+	err := os.WriteFile(fname, []byte("PORT=41641\n"), 0o600)
+	assert.NoError(t, err, "os.WriteFile")
+	owner, group, err := florist.WhoAmI()
+	assert.NoError(t, err, "florist.WhoAmI")
+
+	setPort := func(doc *confedit.Env) error {
+		doc.Set("PORT", "0")
+		return nil
+	}
+
+	changed, err := confedit.EditFile(fname, confedit.ParseEnv, setPort, 0o644, owner, group)
+	assert.NoError(t, err, "EditFile 1")
+	assert.True(t, changed, "changed 1")
+	assert.FileEqualsString(t, fname, "PORT=0\n")
+
+	changed, err = confedit.EditFile(fname, confedit.ParseEnv, setPort, 0o644, owner, group)
+	assert.NoError(t, err, "EditFile 2")
+	assert.False(t, changed, "changed 2")
+}
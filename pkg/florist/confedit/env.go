@@ -0,0 +1,123 @@
+package confedit
+
+import (
+	"strings"
+)
+
+// Env is a configuration file made of "KEY=value" lines, such as /etc/environment
+// (read by pam_env) and the files below /etc/default (sourced by shell scripts and
+// systemd units). Keys are case-sensitive and, for each key, the last value wins. An
+// optional "export " prefix is preserved.
+//
+// Create it with [ParseEnv].
+type Env struct {
+	body *section
+}
+
+var envSyntax = &syntax{
+	parse: func(line string) (string, string, bool) {
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return "", "", false
+		}
+		key = strings.TrimSpace(key)
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return "", "", false
+		}
+		return key, unquote(value), true
+	},
+	format: func(key, value string) string {
+		return key + "=" + quote(value)
+	},
+	comments: "#",
+}
+
+// ParseEnv parses 'text' as a "KEY=value" file. Parsing is lenient and never fails;
+// the lines not understood are preserved as they are.
+func ParseEnv(text string) (*Env, error) {
+	doc := &Env{body: &section{syn: envSyntax}}
+	for _, line := range splitLines(text) {
+		doc.body.add(line)
+	}
+	return doc, nil
+}
+
+// Get returns the unquoted value of 'key', and true if 'key' is present.
+func (doc *Env) Get(key string) (string, bool) {
+	return doc.body.get(key)
+}
+
+// Set sets 'key' to 'value', quoting it if needed, and removes any other occurrence
+// of 'key'.
+func (doc *Env) Set(key, value string) {
+	idxs := doc.body.find(key)
+	export := len(idxs) > 0 &&
+		strings.HasPrefix(strings.TrimSpace(doc.body.entries[idxs[len(idxs)-1]].raw), "export ")
+	doc.body.set(key, value)
+	if export {
+		i := doc.body.effective(key)
+		e := doc.body.entries[i]
+		if !strings.HasPrefix(strings.TrimSpace(e.raw), "export ") {
+			e.raw = "export " + e.raw
+		}
+	}
+}
+
+// Delete removes all the occurrences of 'key'. It returns true if 'key' was present.
+func (doc *Env) Delete(key string) bool {
+	return doc.body.del(key)
+}
+
+// String returns the file contents.
+func (doc *Env) String() string {
+	var bld strings.Builder
+	doc.body.write(&bld)
+	return bld.String()
+}
+
+// quote returns 'value' within double quotes if it contains characters that would
+// otherwise be interpreted by a shell or by pam_env.
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\"'$`\\#;&|<>(){}*?~") {
+		return value
+	}
+	if value == "" {
+		return `""`
+	}
+	var bld strings.Builder
+	bld.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"', '\\', '$', '`':
+			bld.WriteByte('\\')
+		}
+		bld.WriteRune(r)
+	}
+	bld.WriteByte('"')
+	return bld.String()
+}
+
+// unquote removes the quotes added by [quote], or single quotes.
+func unquote(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return value
+	}
+	first, last := value[0], value[len(value)-1]
+	if first == '\'' && last == '\'' {
+		return value[1 : len(value)-1]
+	}
+	if first != '"' || last != '"' {
+		return value
+	}
+	var bld strings.Builder
+	inner := value[1 : len(value)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' && i+1 < len(inner) && strings.IndexByte("\"\\$`", inner[i+1]) >= 0 {
+			i++
+		}
+		bld.WriteByte(inner[i])
+	}
+	return bld.String()
+}
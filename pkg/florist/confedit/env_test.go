@@ -0,0 +1,49 @@
+package confedit_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/florist/pkg/florist/confedit"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestEnvGetSet(t *testing.T) {
+	text := `# Defaults for tailscaled initscript
+PORT="41641"
+export FLAGS=
+`
+	doc, err := confedit.ParseEnv(text)
+	assert.NoError(t, err, "ParseEnv")
+
+	value, found := doc.Get("PORT")
+	assert.True(t, found, "PORT found")
+	assert.Equal(t, value, "41641", "PORT unquoted")
+
+	doc.Set("PORT", "0")
+	doc.Set("FLAGS", "--tun=userspace-networking --verbose=1")
+	doc.Set("PATH", `/usr/local/bin:$HOME/bin`)
+
+	want := `# Defaults for tailscaled initscript
+PORT=0
+export FLAGS="--tun=userspace-networking --verbose=1"
+PATH="/usr/local/bin:\$HOME/bin"
+`
+	assert.Equal(t, doc.String(), want, "edited")
+
+	reparsed, err := confedit.ParseEnv(doc.String())
+	assert.NoError(t, err, "ParseEnv edited")
+	value, _ = reparsed.Get("PATH")
+	assert.Equal(t, value, `/usr/local/bin:$HOME/bin`, "PATH round trip")
+}
+
+func TestEnvDelete(t *testing.T) {
+	doc, err := confedit.ParseEnv("A=1\nB=2\nA=3\n")
+	assert.NoError(t, err, "ParseEnv")
+
+	value, _ := doc.Get("A")
+	assert.Equal(t, value, "3", "last value wins")
+
+	assert.True(t, doc.Delete("A"), "Delete A")
+	assert.False(t, doc.Delete("C"), "Delete C")
+	assert.Equal(t, doc.String(), "B=2\n", "edited")
+}
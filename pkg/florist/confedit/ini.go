@@ -0,0 +1,175 @@
+package confedit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ini is a configuration file made of "[section]" headers followed by "key=value"
+// lines, such as systemd units and drop-ins. The lines before the first section
+// header belong to the unnamed section "", which is also how files without sections,
+// such as sysctl.conf, are represented. Keys are case-sensitive and, for each key,
+// the last value wins. Comments start with '#' or ';'.
+//
+// Create it with [ParseIni].
+type Ini struct {
+	syn      *syntax
+	sections []*iniSection
+}
+
+type iniSection struct {
+	name   string
+	header string
+	body   *section
+}
+
+// ParseIni parses 'text' as an INI file. New entries use the same separator as the
+// first existing entry ("key=value" or "key = value"), defaulting to "key=value".
+// ParseIni returns an error on a malformed section header.
+func ParseIni(text string) (*Ini, error) {
+	errorf := makeErrorf("confedit.ParseIni")
+	lines := splitLines(text)
+
+	separator := "="
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "[") ||
+			strings.ContainsRune("#;", rune(trimmed[0])) {
+			continue
+		}
+		if key, _, found := strings.Cut(trimmed, "="); found {
+			if strings.HasSuffix(key, " ") {
+				separator = " = "
+			}
+			break
+		}
+	}
+
+	doc := &Ini{syn: &syntax{
+		parse: func(line string) (string, string, bool) {
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				return "", "", false
+			}
+			return strings.TrimSpace(key), strings.TrimSpace(value), true
+		},
+		format: func(key, value string) string {
+			return key + separator + value
+		},
+		comments: "#;",
+	}}
+
+	current := doc.section("")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if !strings.HasSuffix(trimmed, "]") || len(trimmed) < 3 {
+				return nil, errorf("line %d: malformed section header: %q", i+1, line)
+			}
+			current = &iniSection{
+				name:   trimmed[1 : len(trimmed)-1],
+				header: line,
+				body:   &section{syn: doc.syn},
+			}
+			doc.sections = append(doc.sections, current)
+			continue
+		}
+		current.body.add(line)
+	}
+	return doc, nil
+}
+
+// Sections returns the names of the sections, in file order. The unnamed section ""
+// is not included.
+func (doc *Ini) Sections() []string {
+	var names []string
+	for _, sec := range doc.sections[1:] {
+		names = append(names, sec.name)
+	}
+	return names
+}
+
+// Get returns the effective value of 'key' in section 'sect', and true if present.
+func (doc *Ini) Get(sect, key string) (string, bool) {
+	sec := doc.lookup(sect)
+	if sec == nil {
+		return "", false
+	}
+	return sec.body.get(key)
+}
+
+// Values returns all the values of 'key' in section 'sect', in file order. This is
+// useful for keys that can be repeated, such as Environment= in systemd units.
+func (doc *Ini) Values(sect, key string) []string {
+	sec := doc.lookup(sect)
+	if sec == nil {
+		return nil
+	}
+	return sec.body.values(key)
+}
+
+// Set sets 'key' to 'value' in section 'sect', removing any other occurrence of 'key'
+// in that section. If the section is not present, Set appends it to the end of the
+// file.
+func (doc *Ini) Set(sect, key, value string) {
+	doc.section(sect).body.set(key, value)
+}
+
+// Add adds another occurrence of 'key' to section 'sect', after the last existing one.
+// If the section is not present, Add appends it to the end of the file.
+func (doc *Ini) Add(sect, key, value string) {
+	doc.section(sect).body.appendValue(key, value)
+}
+
+// Delete removes all the occurrences of 'key' in section 'sect'. It returns true if
+// 'key' was present.
+func (doc *Ini) Delete(sect, key string) bool {
+	sec := doc.lookup(sect)
+	if sec == nil {
+		return false
+	}
+	return sec.body.del(key)
+}
+
+// String returns the file contents.
+func (doc *Ini) String() string {
+	var bld strings.Builder
+	for _, sec := range doc.sections {
+		if sec.name != "" {
+			bld.WriteString(sec.header)
+			bld.WriteByte('\n')
+		}
+		sec.body.write(&bld)
+	}
+	return bld.String()
+}
+
+func (doc *Ini) lookup(name string) *iniSection {
+	for _, sec := range doc.sections {
+		if sec.name == name {
+			return sec
+		}
+	}
+	return nil
+}
+
+// section returns the section called 'name', appending it if not present.
+func (doc *Ini) section(name string) *iniSection {
+	if sec := doc.lookup(name); sec != nil {
+		return sec
+	}
+	if last := len(doc.sections) - 1; last >= 0 {
+		// Separate the new section from the previous one with a blank line.
+		body := doc.sections[last].body
+		if n := len(body.entries); n > 0 && strings.TrimSpace(body.entries[n-1].raw) != "" {
+			body.add("")
+		}
+	}
+	sec := &iniSection{
+		name:   name,
+		header: fmt.Sprintf("[%s]", name),
+		body:   &section{syn: doc.syn},
+	}
+	doc.sections = append(doc.sections, sec)
+	return sec
+}
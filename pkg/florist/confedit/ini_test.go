@@ -0,0 +1,65 @@
+package confedit_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/florist/pkg/florist/confedit"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestIniSystemdUnit(t *testing.T) {
+	text := `[Unit]
+Description=Consul client
+# Wait for the network.
+After=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/consul agent
+Environment=A=1
+Environment=B=2
+`
+	doc, err := confedit.ParseIni(text)
+	assert.NoError(t, err, "ParseIni")
+	assert.DeepEqual(t, doc.Sections(), []string{"Unit", "Service"}, "sections")
+	assert.DeepEqual(t, doc.Values("Service", "Environment"), []string{"A=1", "B=2"},
+		"Environment values")
+
+	doc.Set("Unit", "Description", "Consul agent")
+	doc.Add("Service", "Environment", "C=3")
+	doc.Set("Service", "Restart", "on-failure")
+	doc.Set("Install", "WantedBy", "multi-user.target")
+
+	want := `[Unit]
+Description=Consul agent
+# Wait for the network.
+After=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/consul agent
+Environment=A=1
+Environment=B=2
+Environment=C=3
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
+	assert.Equal(t, doc.String(), want, "edited")
+}
+
+func TestIniNoSections(t *testing.T) {
+	text := "; sysctl settings\nnet.ipv4.ip_forward = 0\n"
+	doc, err := confedit.ParseIni(text)
+	assert.NoError(t, err, "ParseIni")
+
+	doc.Set("", "net.ipv4.ip_forward", "1")
+	doc.Set("", "vm.swappiness", "10")
+
+	want := "; sysctl settings\nnet.ipv4.ip_forward = 1\nvm.swappiness = 10\n"
+	assert.Equal(t, doc.String(), want, "edited")
+}
+
+func TestIniMalformedSection(t *testing.T) {
+	_, err := confedit.ParseIni("[Unit\nA=1\n")
+	assert.ErrorContains(t, err, `line 1: malformed section header: "[Unit"`, "ParseIni")
+}
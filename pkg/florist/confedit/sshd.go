@@ -0,0 +1,188 @@
+package confedit
+
+import (
+	"strings"
+)
+
+// Sshd is a configuration file in the format of sshd_config(5): one "key value" per
+// line, keys are case-insensitive and, for each key, the first obtained value is
+// used. The file can end with Match blocks, each applying to the lines that follow
+// it, up to the next Match or to the end of the file.
+//
+// Create it with [ParseSshd].
+type Sshd struct {
+	global  *section
+	matches []*SshdMatch
+}
+
+// SshdMatch is a Match block of a [Sshd] file. Obtain it with [Sshd.Match].
+type SshdMatch struct {
+	criteria string
+	header   string
+	body     *section
+}
+
+var sshdSyntax = &syntax{
+	parse: func(line string) (string, string, bool) {
+		// sshd_config(5): keywords and arguments are separated by whitespace or
+		// by optional whitespace and exactly one '='.
+		i := strings.IndexAny(line, " \t=")
+		if i < 0 {
+			return line, "", true
+		}
+		key := line[:i]
+		value := strings.TrimLeft(line[i:], " \t")
+		value = strings.TrimPrefix(value, "=")
+		return key, strings.TrimSpace(value), true
+	},
+	format: func(key, value string) string {
+		return key + " " + value
+	},
+	foldCase:  true,
+	firstWins: true,
+	comments:  "#",
+}
+
+// ParseSshd parses 'text' as a sshd_config(5) file. Parsing is lenient and never
+// fails; the error is there for uniformity with the other parsers and to be used
+// with [EditFile].
+func ParseSshd(text string) (*Sshd, error) {
+	doc := &Sshd{global: &section{syn: sshdSyntax}}
+	current := doc.global
+	for _, line := range splitLines(text) {
+		if criteria, ok := matchHeader(line); ok {
+			match := &SshdMatch{
+				criteria: criteria,
+				header:   line,
+				body:     &section{syn: sshdSyntax, indent: "\t"},
+			}
+			doc.matches = append(doc.matches, match)
+			current = match.body
+			continue
+		}
+		current.add(line)
+	}
+	for _, match := range doc.matches {
+		match.body.indent = bodyIndent(match.body)
+	}
+	return doc, nil
+}
+
+// Get returns the effective value of 'key' outside any Match block, and true if
+// 'key' is present.
+func (doc *Sshd) Get(key string) (string, bool) {
+	return doc.global.get(key)
+}
+
+// Values returns all the values of 'key' outside any Match block, in file order.
+// This is useful for keys that can be repeated, such as HostKey.
+func (doc *Sshd) Values(key string) []string {
+	return doc.global.values(key)
+}
+
+// Set sets 'key' to 'value' outside any Match block, removing any other occurrence.
+// If 'key' is not present, Set adds it after its commented-out default (for example
+// "#Port 22"), if any, otherwise before the first Match block.
+func (doc *Sshd) Set(key, value string) {
+	doc.global.set(key, value)
+}
+
+// Add adds another occurrence of 'key' outside any Match block, for keys that can be
+// repeated, such as HostKey. It is not an error if the same value is already present;
+// use [Sshd.Values] to check.
+func (doc *Sshd) Add(key, value string) {
+	doc.global.appendValue(key, value)
+}
+
+// Delete removes all the occurrences of 'key' outside any Match block. It returns
+// true if 'key' was present.
+func (doc *Sshd) Delete(key string) bool {
+	return doc.global.del(key)
+}
+
+// Match returns the Match block with 'criteria' (for example "User git" or
+// "Address 10.0.0.0/8"), appending a new one at the end of the file if not present.
+// Criteria are compared ignoring differences in whitespace.
+func (doc *Sshd) Match(criteria string) *SshdMatch {
+	for _, match := range doc.matches {
+		if sameCriteria(match.criteria, criteria) {
+			return match
+		}
+	}
+	match := &SshdMatch{
+		criteria: criteria,
+		header:   "Match " + criteria,
+		body:     &section{syn: sshdSyntax, indent: "\t"},
+	}
+	doc.matches = append(doc.matches, match)
+	return match
+}
+
+// DeleteMatch removes the Match block with 'criteria' and all its lines. It returns
+// true if the block was present.
+func (doc *Sshd) DeleteMatch(criteria string) bool {
+	for i, match := range doc.matches {
+		if sameCriteria(match.criteria, criteria) {
+			doc.matches = append(doc.matches[:i], doc.matches[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the file contents.
+func (doc *Sshd) String() string {
+	var bld strings.Builder
+	doc.global.write(&bld)
+	for _, match := range doc.matches {
+		bld.WriteString(match.header)
+		bld.WriteByte('\n')
+		match.body.write(&bld)
+	}
+	return bld.String()
+}
+
+// Get returns the value of 'key' in the Match block, and true if 'key' is present.
+func (match *SshdMatch) Get(key string) (string, bool) {
+	return match.body.get(key)
+}
+
+// Set sets 'key' to 'value' in the Match block, removing any other occurrence.
+func (match *SshdMatch) Set(key, value string) {
+	match.body.set(key, value)
+}
+
+// Delete removes all the occurrences of 'key' in the Match block. It returns true if
+// 'key' was present.
+func (match *SshdMatch) Delete(key string) bool {
+	return match.body.del(key)
+}
+
+// matchHeader returns the criteria of a "Match" line and true, or false if 'line'
+// is not a Match line.
+func matchHeader(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || sshdSyntax.isComment(trimmed) {
+		return "", false
+	}
+	key, criteria, _ := sshdSyntax.parse(trimmed)
+	if !strings.EqualFold(key, "Match") {
+		return "", false
+	}
+	return criteria, true
+}
+
+// bodyIndent returns the indentation used by the existing lines of a Match block,
+// defaulting to a tab.
+func bodyIndent(sec *section) string {
+	for _, e := range sec.entries {
+		if e.key != "" {
+			return e.raw[:len(e.raw)-len(strings.TrimLeft(e.raw, " \t"))]
+		}
+	}
+	return "\t"
+}
+
+func sameCriteria(a, b string) bool {
+	return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+}
@@ -0,0 +1,188 @@
+package confedit_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/florist/pkg/florist/confedit"
+	"github.com/marco-m/rosina/assert"
+)
+
+const sshdConfig = `#	$OpenBSD: sshd_config,v 1.104 2021/07/02 05:11:21 dtucker Exp $
+
+# This is the sshd server system-wide configuration file.
+
+#Port 22
+#AddressFamily any
+
+#HostKey /etc/ssh/ssh_host_rsa_key
+HostKey /etc/ssh/ssh_host_ed25519_key
+
+# Authentication:
+PermitRootLogin no
+#PasswordAuthentication yes
+X11Forwarding yes
+
+# Example of overriding settings on a per-user basis
+Match User anoncvs
+	X11Forwarding no
+	AllowTcpForwarding no
+`
+
+func TestSshdGet(t *testing.T) {
+	doc, err := confedit.ParseSshd(sshdConfig)
+	assert.NoError(t, err, "ParseSshd")
+
+	value, found := doc.Get("permitrootlogin")
+	assert.True(t, found, "PermitRootLogin found")
+	assert.Equal(t, value, "no", "PermitRootLogin")
+
+	_, found = doc.Get("Port")
+	assert.False(t, found, "commented-out Port found")
+
+	// Options in a Match block do not leak into the global scope.
+	value, _ = doc.Get("X11Forwarding")
+	assert.Equal(t, value, "yes", "global X11Forwarding")
+	value, _ = doc.Match("User   anoncvs").Get("X11Forwarding")
+	assert.Equal(t, value, "no", "Match X11Forwarding")
+
+	assert.Equal(t, doc.String(), sshdConfig, "round trip")
+}
+
+func TestSshdEdit(t *testing.T) {
+	type testCase struct {
+		name string
+		edit func(doc *confedit.Sshd)
+		want string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		doc, err := confedit.ParseSshd(sshdConfig)
+		assert.NoError(t, err, "ParseSshd")
+
+		tc.edit(doc)
+
+		assert.Equal(t, doc.String(), tc.want, "edited")
+	}
+
+	testCases := []testCase{
+		{
+			name: "set after commented-out default",
+			edit: func(doc *confedit.Sshd) { doc.Set("Port", "2222") },
+			want: `#	$OpenBSD: sshd_config,v 1.104 2021/07/02 05:11:21 dtucker Exp $
+
+# This is the sshd server system-wide configuration file.
+
+#Port 22
+Port 2222
+#AddressFamily any
+
+#HostKey /etc/ssh/ssh_host_rsa_key
+HostKey /etc/ssh/ssh_host_ed25519_key
+
+# Authentication:
+PermitRootLogin no
+#PasswordAuthentication yes
+X11Forwarding yes
+
+# Example of overriding settings on a per-user basis
+Match User anoncvs
+	X11Forwarding no
+	AllowTcpForwarding no
+`,
+		},
+		{
+			name: "replace existing, case-insensitive",
+			edit: func(doc *confedit.Sshd) { doc.Set("permitRootLogin", "prohibit-password") },
+			want: `#	$OpenBSD: sshd_config,v 1.104 2021/07/02 05:11:21 dtucker Exp $
+
+# This is the sshd server system-wide configuration file.
+
+#Port 22
+#AddressFamily any
+
+#HostKey /etc/ssh/ssh_host_rsa_key
+HostKey /etc/ssh/ssh_host_ed25519_key
+
+# Authentication:
+permitRootLogin prohibit-password
+#PasswordAuthentication yes
+X11Forwarding yes
+
+# Example of overriding settings on a per-user basis
+Match User anoncvs
+	X11Forwarding no
+	AllowTcpForwarding no
+`,
+		},
+		{
+			name: "add new, delete existing, edit and add match",
+			edit: func(doc *confedit.Sshd) {
+				doc.Set("MaxAuthTries", "2")
+				doc.Delete("X11Forwarding")
+				doc.Add("HostKey", "/etc/ssh/ssh_host_ecdsa_key")
+				doc.Match("User anoncvs").Set("PermitTTY", "no")
+				doc.Match("Address 10.0.0.0/8").Set("PasswordAuthentication", "yes")
+			},
+			want: `#	$OpenBSD: sshd_config,v 1.104 2021/07/02 05:11:21 dtucker Exp $
+
+# This is the sshd server system-wide configuration file.
+
+#Port 22
+#AddressFamily any
+
+#HostKey /etc/ssh/ssh_host_rsa_key
+HostKey /etc/ssh/ssh_host_ed25519_key
+HostKey /etc/ssh/ssh_host_ecdsa_key
+
+# Authentication:
+PermitRootLogin no
+#PasswordAuthentication yes
+MaxAuthTries 2
+
+# Example of overriding settings on a per-user basis
+Match User anoncvs
+	X11Forwarding no
+	AllowTcpForwarding no
+	PermitTTY no
+Match Address 10.0.0.0/8
+	PasswordAuthentication yes
+`,
+		},
+		{
+			name: "delete match",
+			edit: func(doc *confedit.Sshd) { doc.DeleteMatch("User anoncvs") },
+			want: `#	$OpenBSD: sshd_config,v 1.104 2021/07/02 05:11:21 dtucker Exp $
+
+# This is the sshd server system-wide configuration file.
+
+#Port 22
+#AddressFamily any
+
+#HostKey /etc/ssh/ssh_host_rsa_key
+HostKey /etc/ssh/ssh_host_ed25519_key
+
+# Authentication:
+PermitRootLogin no
+#PasswordAuthentication yes
+X11Forwarding yes
+
+# Example of overriding settings on a per-user basis
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestSshdSetRemovesDuplicates(t *testing.T) {
+	doc, err := confedit.ParseSshd("Port 22\nPort=2222\n")
+	assert.NoError(t, err, "ParseSshd")
+
+	value, _ := doc.Get("Port")
+	assert.Equal(t, value, "22", "first value wins")
+
+	doc.Set("Port", "22")
+	assert.Equal(t, doc.String(), "Port 22\n", "edited")
+}
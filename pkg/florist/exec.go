@@ -4,14 +4,67 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"log/slog"
 	"os/exec"
+	"strings"
 	"sync"
 )
 
-// CmdRun runs 'cmd', redirecting its stdout and stderr to 'log.Debug'.
+// Runner runs external commands on behalf of florist and of the flowers. The default
+// Runner is [ExecRunner]; tests can replace it with [SetRunner], for example with a
+// [FakeRunner].
+type Runner interface {
+	// Run runs 'cmd', redirecting its stdout and stderr to 'log.Debug', and blocks
+	// until 'cmd' terminates.
+	Run(log *slog.Logger, cmd *exec.Cmd) error
+	// Output runs 'cmd' and returns its stdout. Stderr is redirected to 'log.Debug'.
+	Output(log *slog.Logger, cmd *exec.Cmd) ([]byte, error)
+}
+
+var (
+	runnerMu sync.Mutex
+	runner   Runner = ExecRunner{}
+)
+
+// SetRunner replaces the Runner used by [CmdRun] and [CmdOutput], returning the
+// previous one. Passing nil restores the default, [ExecRunner].
+// DO NOT CALL in production code; see provisioner.Options.Runner.
+func SetRunner(r Runner) Runner {
+	if r == nil {
+		r = ExecRunner{}
+	}
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	prev := runner
+	runner = r
+	return prev
+}
+
+func currentRunner() Runner {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	return runner
+}
+
+// CmdRun runs 'cmd' with the current [Runner]. With the default runner, it redirects
+// the stdout and stderr of 'cmd' to 'log.Debug'.
 // CmdRun blocks until 'cmd' terminates.
 func CmdRun(log *slog.Logger, cmd *exec.Cmd) error {
+	return currentRunner().Run(log, cmd)
+}
+
+// CmdOutput runs 'cmd' with the current [Runner] and returns its stdout.
+// CmdOutput blocks until 'cmd' terminates.
+func CmdOutput(log *slog.Logger, cmd *exec.Cmd) ([]byte, error) {
+	return currentRunner().Output(log, cmd)
+}
+
+// ExecRunner is the default [Runner]: it executes the commands with package os/exec.
+type ExecRunner struct{}
+
+// Run implements [Runner.Run].
+func (ExecRunner) Run(log *slog.Logger, cmd *exec.Cmd) error {
 	log.Debug("cmd-run", "cmd", cmd.String())
 
 	stdout, err := cmd.StdoutPipe()
@@ -78,6 +131,28 @@ func CmdRun(log *slog.Logger, cmd *exec.Cmd) error {
 	return nil
 }
 
+// Output implements [Runner.Output].
+func (ExecRunner) Output(log *slog.Logger, cmd *exec.Cmd) ([]byte, error) {
+	log.Debug("cmd-output", "cmd", cmd.String())
+	// Keep also the stderr writer set by the caller, if any.
+	var stderr bytes.Buffer
+	if cmd.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
+	} else {
+		cmd.Stderr = &stderr
+	}
+	out, err := cmd.Output()
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if line != "" {
+			log.Debug("cmd-output", "stderr", line)
+		}
+	}
+	if err != nil {
+		return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
 const maxLineLen = 160
 
 // Splitter keeps state for [Splitter.ScanWithLength], meant to be passed to a
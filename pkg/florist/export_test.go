@@ -0,0 +1,5 @@
+package florist
+
+// Exported for the tests of package florist_test.
+
+var ResetTemplateFuncs = resetTemplateFuncs
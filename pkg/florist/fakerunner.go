@@ -0,0 +1,130 @@
+package florist
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// FakeRunner is a [Runner] for tests: it does not execute the commands, it records
+// them and returns canned responses. A command is identified by its command line,
+// that is its arguments joined by a space, for example "systemctl reload ssh".
+//
+// Usage:
+//
+//	fake := florist.NewFakeRunner()
+//	fake.On("lsb_release -cs", "bookworm\n", nil)
+//	prev := florist.SetRunner(fake)
+//	defer florist.SetRunner(prev)
+//	...
+//	assert.DeepEqual(t, fake.Calls(), []string{"sshd -t", "systemctl reload ssh"}, "calls")
+type FakeRunner struct {
+	mu        sync.Mutex
+	calls     []string
+	responses map[string]FakeResponse
+	// Handler, if not nil, is called for the commands without a canned response
+	// (see [FakeRunner.On]) and returns the response. If nil, these commands succeed
+	// with empty output.
+	Handler func(cmdline string, cmd *exec.Cmd) FakeResponse
+}
+
+// FakeResponse is the response of a [FakeRunner] to a command.
+type FakeResponse struct {
+	// Stdout of the command, returned by [Runner.Output].
+	Output string
+	// Error returned by the runner, simulating the failure of the command.
+	Err error
+}
+
+// NewFakeRunner returns a FakeRunner on which all the commands succeed with empty
+// output.
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{responses: make(map[string]FakeResponse)}
+}
+
+// On sets the response to command line 'cmdline', for example
+// "systemctl is-active consul".
+func (fr *FakeRunner) On(cmdline string, output string, err error) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.responses[cmdline] = FakeResponse{Output: output, Err: err}
+}
+
+// Calls returns the command lines run so far, in order.
+func (fr *FakeRunner) Calls() []string {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return append([]string(nil), fr.calls...)
+}
+
+// Reset forgets the command lines run so far. The responses are kept.
+func (fr *FakeRunner) Reset() {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.calls = nil
+}
+
+// Run implements [Runner.Run].
+func (fr *FakeRunner) Run(log *slog.Logger, cmd *exec.Cmd) error {
+	resp := fr.respond(log, cmd, true)
+	return resp.Err
+}
+
+// Output implements [Runner.Output].
+func (fr *FakeRunner) Output(log *slog.Logger, cmd *exec.Cmd) ([]byte, error) {
+	resp := fr.respond(log, cmd, true)
+	return []byte(resp.Output), resp.Err
+}
+
+// Silent returns a Runner that responds like fr, without recording the calls. Use
+// it to query the state without altering [FakeRunner.Calls], as done by
+// [Snapshotter.Runner].
+func (fr *FakeRunner) Silent() Runner {
+	return silentRunner{fr}
+}
+
+type silentRunner struct {
+	fr *FakeRunner
+}
+
+func (sr silentRunner) Run(log *slog.Logger, cmd *exec.Cmd) error {
+	return sr.fr.respond(log, cmd, false).Err
+}
+
+func (sr silentRunner) Output(log *slog.Logger, cmd *exec.Cmd) ([]byte, error) {
+	resp := sr.fr.respond(log, cmd, false)
+	return []byte(resp.Output), resp.Err
+}
+
+func (fr *FakeRunner) respond(log *slog.Logger, cmd *exec.Cmd, record bool) FakeResponse {
+	cmdline := strings.Join(cmd.Args, " ")
+	log.Debug("fake-cmd-run", "cmd", cmdline)
+
+	fr.mu.Lock()
+	if record {
+		fr.calls = append(fr.calls, cmdline)
+	}
+	resp, found := fr.responses[cmdline]
+	handler := fr.Handler
+	fr.mu.Unlock()
+
+	if found {
+		return resp
+	}
+	if handler != nil {
+		return handler(cmdline, cmd)
+	}
+	return FakeResponse{}
+}
+
+// String returns the command lines run so far, one per line. Useful in test failure
+// messages.
+func (fr *FakeRunner) String() string {
+	var bld strings.Builder
+	for i, call := range fr.Calls() {
+		fmt.Fprintf(&bld, "%d: %s\n", i, call)
+	}
+	return bld.String()
+}
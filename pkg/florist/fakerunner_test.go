@@ -0,0 +1,65 @@
+package florist_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os/exec"
+	"testing"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestCmdOutputSuccess(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	out, err := florist.CmdOutput(log, exec.Command("echo", "hello"))
+	assert.NoError(t, err, "florist.CmdOutput")
+	assert.Equal(t, string(out), "hello\n", "output")
+}
+
+func TestCmdOutputFailure(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", "echo oops >&2; exit 3")
+	cmd.Stderr = &stderr
+
+	_, err := florist.CmdOutput(log, cmd)
+
+	assert.ErrorContains(t, err, "exit status 3: oops", "florist.CmdOutput")
+	var exitErr *exec.ExitError
+	assert.True(t, errors.As(err, &exitErr), "errors.As ExitError")
+	assert.Equal(t, exitErr.ExitCode(), 3, "exit code")
+	assert.Equal(t, stderr.String(), "oops\n", "stderr of the caller")
+}
+
+func TestFakeRunner(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fake := florist.NewFakeRunner()
+	fake.On("lsb_release -cs", "bookworm\n", nil)
+	fake.On("systemctl is-active consul", "", errors.New("exit status 3"))
+	fake.Handler = func(cmdline string, cmd *exec.Cmd) florist.FakeResponse {
+		return florist.FakeResponse{Output: "handled: " + cmd.Args[0]}
+	}
+	prev := florist.SetRunner(fake)
+	t.Cleanup(func() { florist.SetRunner(prev) })
+
+	out, err := florist.CmdOutput(log, exec.Command("lsb_release", "-cs"))
+	assert.NoError(t, err, "canned output")
+	assert.Equal(t, string(out), "bookworm\n", "canned output")
+
+	err = florist.CmdRun(log, exec.Command("systemctl", "is-active", "consul"))
+	assert.ErrorContains(t, err, "exit status 3", "canned error")
+
+	out, err = florist.CmdOutput(log, exec.Command("uname", "-m"))
+	assert.NoError(t, err, "handler")
+	assert.Equal(t, string(out), "handled: uname", "handler output")
+
+	want := []string{"lsb_release -cs", "systemctl is-active consul", "uname -m"}
+	assert.DeepEqual(t, fake.Calls(), want, "calls")
+
+	fake.Reset()
+	assert.DeepEqual(t, fake.Calls(), []string(nil), "calls after reset")
+}
@@ -0,0 +1,221 @@
+package florist
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// The template functions added by the flowers with [AddTemplateFuncs].
+var (
+	extraFuncsMu sync.Mutex
+	extraFuncs   = template.FuncMap{}
+)
+
+// builtinFuncs returns the curated template functions available to all the florist
+// template helpers ([TemplateFromText], [TemplateFromFs], [RenderFile], ...).
+//
+// On purpose, there is no function to read environment variables: a template must
+// depend only on its data and on facts about the host.
+//
+//   - quote VALUE: VALUE as a double-quoted Go string, escaped as needed.
+//   - join SEP LIST: the elements of LIST separated by SEP.
+//   - indent N TEXT: TEXT with each non-empty line indented by N spaces.
+//   - toJSON VALUE: VALUE encoded as JSON.
+//   - toHCLString VALUE: VALUE as a double-quoted HCL string, escaping also
+//     the interpolation sequences "${" and "%{".
+//   - default DEFAULT VALUE: VALUE if not empty, otherwise DEFAULT.
+//   - required MSG VALUE: VALUE if not empty, otherwise fails the rendering with MSG.
+//   - b64enc VALUE: VALUE encoded as standard base64.
+//   - sha256 VALUE: the hex-encoded SHA-256 of VALUE.
+//   - hostname: the hostname of the host.
+//   - goos, goarch: the operating system and architecture, as named by Go.
+func builtinFuncs() template.FuncMap {
+	return template.FuncMap{
+		"quote":       tmplQuote,
+		"join":        tmplJoin,
+		"indent":      tmplIndent,
+		"toJSON":      tmplToJSON,
+		"toHCLString": tmplToHCLString,
+		"default":     tmplDefault,
+		"required":    tmplRequired,
+		"b64enc":      tmplB64enc,
+		"sha256":      tmplSha256,
+		"hostname":    os.Hostname,
+		"goos":        func() string { return runtime.GOOS },
+		"goarch":      func() string { return runtime.GOARCH },
+	}
+}
+
+// TemplateFuncs returns the functions available to the florist template helpers: the
+// curated ones plus the ones added with [AddTemplateFuncs]. This is useful if a flower
+// needs to use text/template directly.
+func TemplateFuncs() template.FuncMap {
+	funcs := builtinFuncs()
+	extraFuncsMu.Lock()
+	defer extraFuncsMu.Unlock()
+	maps.Copy(funcs, extraFuncs)
+	return funcs
+}
+
+// AddTemplateFuncs makes 'funcs' available to all the florist template helpers.
+// It returns an error if a function has the same name of a curated function or of a
+// function already added.
+func AddTemplateFuncs(funcs template.FuncMap) error {
+	errorf := makeErrorf("AddTemplateFuncs")
+	builtin := builtinFuncs()
+
+	extraFuncsMu.Lock()
+	defer extraFuncsMu.Unlock()
+	for name := range funcs {
+		if _, found := builtin[name]; found {
+			return errorf("function %q: would override a curated function", name)
+		}
+		if _, found := extraFuncs[name]; found {
+			return errorf("function %q: already added", name)
+		}
+	}
+	maps.Copy(extraFuncs, funcs)
+	return nil
+}
+
+// resetTemplateFuncs removes the functions added with [AddTemplateFuncs]. For the
+// tests.
+func resetTemplateFuncs() {
+	extraFuncsMu.Lock()
+	defer extraFuncsMu.Unlock()
+	extraFuncs = template.FuncMap{}
+}
+
+func tmplQuote(value any) string {
+	return strconv.Quote(toString(value))
+}
+
+func tmplJoin(sep string, list any) (string, error) {
+	if list == nil {
+		return "", nil
+	}
+	val := reflect.ValueOf(list)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: want a list, have %T", list)
+	}
+	elems := make([]string, 0, val.Len())
+	for i := range val.Len() {
+		elems = append(elems, toString(val.Index(i).Interface()))
+	}
+	return strings.Join(elems, sep), nil
+}
+
+func tmplIndent(n int, text string) string {
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tmplToJSON(value any) (string, error) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("toJSON: %s", err)
+	}
+	return string(buf), nil
+}
+
+// tmplToHCLString returns 'value' as an HCL quoted string literal. See
+// https://github.com/hashicorp/hcl/blob/main/hclsyntax/spec.md#template-literals
+func tmplToHCLString(value any) string {
+	var bld strings.Builder
+	bld.WriteByte('"')
+	s := toString(value)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			bld.WriteString(`\"`)
+		case '\\':
+			bld.WriteString(`\\`)
+		case '\n':
+			bld.WriteString(`\n`)
+		case '\r':
+			bld.WriteString(`\r`)
+		case '\t':
+			bld.WriteString(`\t`)
+		case '$', '%':
+			bld.WriteByte(c)
+			if i+1 < len(s) && s[i+1] == '{' {
+				bld.WriteByte(c)
+			}
+		default:
+			bld.WriteByte(c)
+		}
+	}
+	bld.WriteByte('"')
+	return bld.String()
+}
+
+func tmplDefault(def any, value any) any {
+	if isEmpty(value) {
+		return def
+	}
+	return value
+}
+
+func tmplRequired(msg string, value any) (any, error) {
+	if isEmpty(value) {
+		return nil, fmt.Errorf("required: %s", msg)
+	}
+	return value, nil
+}
+
+func tmplB64enc(value any) string {
+	return base64.StdEncoding.EncodeToString([]byte(toString(value)))
+}
+
+func tmplSha256(value any) string {
+	sum := sha256.Sum256([]byte(toString(value)))
+	return hex.EncodeToString(sum[:])
+}
+
+// isEmpty returns true if 'value' is nil, the zero value of its type or an empty
+// list, map or string.
+func isEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return val.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return val.IsNil()
+	default:
+		return val.IsZero()
+	}
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
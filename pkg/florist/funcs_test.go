@@ -0,0 +1,104 @@
+package florist_test
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestTemplateFuncsSuccess(t *testing.T) {
+	type Data struct {
+		Name    string
+		Servers []string
+		Port    int
+		Config  string
+		Extra   map[string]string
+	}
+	data := Data{
+		Name:    `my "app"`,
+		Servers: []string{"10.0.0.1", "10.0.0.2"},
+		Config:  "a: 1\nb: 2",
+		Extra:   map[string]string{"k": "v"},
+	}
+
+	type testCase struct {
+		name string
+		tmpl string
+		want string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		have, err := florist.TemplateFromText(tc.tmpl, data, tc.name)
+		assert.NoError(t, err, "TemplateFromText")
+		assert.Equal(t, have, tc.want, "rendered")
+	}
+
+	testCases := []testCase{
+		{
+			name: "quote",
+			tmpl: `name = {{quote .Name}}`,
+			want: `name = "my \"app\""`,
+		},
+		{
+			name: "join",
+			tmpl: `servers = {{join ", " .Servers}}`,
+			want: `servers = 10.0.0.1, 10.0.0.2`,
+		},
+		{
+			name: "indent",
+			tmpl: "config:\n{{indent 2 .Config}}",
+			want: "config:\n  a: 1\n  b: 2",
+		},
+		{
+			name: "toJSON",
+			tmpl: `{{toJSON .Servers}} {{toJSON .Extra}}`,
+			want: `["10.0.0.1","10.0.0.2"] {"k":"v"}`,
+		},
+		{
+			name: "toHCLString",
+			tmpl: `retry_join = [{{toHCLString "${a} %{b} \\"}}]`,
+			want: `retry_join = ["$${a} %%{b} \\"]`,
+		},
+		{
+			name: "default",
+			tmpl: `port = {{default 8500 .Port}} name = {{default "x" .Name}}`,
+			want: `port = 8500 name = my "app"`,
+		},
+		{
+			name: "b64enc and sha256",
+			tmpl: `{{b64enc "banana"}} {{sha256 "banana"}}`,
+			want: "YmFuYW5h b493d48364afe44d11c0165cf470a4164d1e2609911ef998be868d46ade3de4e",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestTemplateFuncsRequiredFailure(t *testing.T) {
+	_, err := florist.TemplateFromText(`{{required "Port is mandatory" .Port}}`,
+		struct{ Port int }{}, "required")
+	assert.ErrorContains(t, err, "required: Port is mandatory", "TemplateFromText")
+}
+
+func TestAddTemplateFuncs(t *testing.T) {
+	t.Cleanup(florist.ResetTemplateFuncs)
+
+	err := florist.AddTemplateFuncs(template.FuncMap{"upper": strings.ToUpper})
+	assert.NoError(t, err, "AddTemplateFuncs")
+
+	have, err := florist.TemplateFromText(`{{upper "daisy"}}`, nil, "upper")
+	assert.NoError(t, err, "TemplateFromText")
+	assert.Equal(t, have, "DAISY", "rendered")
+
+	err = florist.AddTemplateFuncs(template.FuncMap{"upper": strings.ToUpper})
+	assert.ErrorContains(t, err, `function "upper": already added`, "AddTemplateFuncs again")
+
+	err = florist.AddTemplateFuncs(template.FuncMap{"quote": strings.ToUpper})
+	assert.ErrorContains(t, err, `function "quote": would override a curated function`,
+		"AddTemplateFuncs builtin")
+}
@@ -1,93 +1,367 @@
 package florist
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-type Hash int
-
-const (
-	SHA256 Hash = iota + 1
+// netTransport, if not nil, replaces the Transport of the http.Client passed to
+// NetFetch. See [SetNetTransport].
+var (
+	netTransportMu sync.Mutex
+	netTransport   http.RoundTripper
+	netRetry       = DefaultNetRetry
 )
 
+// SetNetTransport makes [NetFetch] use 'rt' instead of the Transport of its
+// http.Client, returning the previous one. Passing nil restores the default.
+// This allows to serve the downloads from a fake server during testing (see package
+// flowertest). DO NOT CALL in production code.
+func SetNetTransport(rt http.RoundTripper) http.RoundTripper {
+	netTransportMu.Lock()
+	defer netTransportMu.Unlock()
+	prev := netTransport
+	netTransport = rt
+	return prev
+}
+
+// NetRetry configures the retries of [NetFetch]. See [SetNetRetry]. Zero fields take
+// the value of [DefaultNetRetry], except Backoff and MaxBackoff.
+type NetRetry struct {
+	// Maximum number of attempts, including the first one.
+	Attempts int
+	// Wait before the second attempt, doubled at each subsequent attempt.
+	Backoff time.Duration
+	// Maximum wait between attempts.
+	MaxBackoff time.Duration
+	// An attempt fails if no data is received for this long.
+	StallTimeout time.Duration
+	// Interval between the progress logs of a download.
+	ProgressInterval time.Duration
+}
+
+// DefaultNetRetry is the default configuration of the retries of [NetFetch].
+var DefaultNetRetry = NetRetry{
+	Attempts:         5,
+	Backoff:          2 * time.Second,
+	MaxBackoff:       30 * time.Second,
+	StallTimeout:     time.Minute,
+	ProgressInterval: 10 * time.Second,
+}
+
+// SetNetRetry makes [NetFetch] use 'retry', returning the previous configuration.
+// Meant mostly to speed up tests.
+func SetNetRetry(retry NetRetry) NetRetry {
+	netTransportMu.Lock()
+	defer netTransportMu.Unlock()
+	prev := netRetry
+	netRetry = retry
+	return prev
+}
+
+// NewNetClient returns an http.Client suitable for [NetFetch]. Contrary to a client
+// with a Timeout, it does not limit the total duration of a download, which for a
+// big file over a slow link can take minutes, but only the time to connect and to
+// receive the response headers. NetFetch detects stalled downloads by itself.
+func NewNetClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = 30 * time.Second
+	transport.ResponseHeaderTimeout = time.Minute
+	return &http.Client{Transport: transport}
+}
+
 // NetFetch uses client to download url to dstDir, returning the path of the downloaded
-// file.
-// Directory dstDir must exist.
-// If after the download the hash doesn't match, it will return an error.
+// file. If client is nil, it uses [NewNetClient].
 // If the file in dstDir exists and the hash matches, it will not be
 // redownloaded.
+//
+// The download goes to a ".part" file, renamed to the final name only if the hash
+// matches, so the destination file is either absent or complete. Transient errors
+// (network errors, HTTP 5xx, 408 and 429, stalled transfers) are retried with
+// exponential backoff; the next attempt resumes the ".part" file with an HTTP
+// Range request, also across runs. See [NetRetry].
+// If after the download the hash doesn't match, it will return an error.
+//
+// To take the hash from an upstream checksum file, see [NetFetchChecksumFile].
+// To use a local cache or a mirror, see [SetArtifactSource].
 func NetFetch(client *http.Client, url string, hashType Hash, hash string, dstDir string) (string, error) {
+	if !hashType.Available() {
+		return "", fmt.Errorf("NetFetch: unknown hash type %d", hashType)
+	}
+	return netFetch(client, url, hashType, hash, dstDir)
+}
+
+// netFetch is [NetFetch]; if hashType is 0, it does not verify the download, which
+// is then never skipped nor resumed across runs.
+func netFetch(client *http.Client, url string, hashType Hash, hash string, dstDir string) (string, error) {
 	log := slog.With("url", url)
 
 	if len(url) == 0 {
 		return "", fmt.Errorf("NetFetch: empty url")
 	}
-	hasher := sha256.New()
+	if client == nil {
+		client = NewNetClient()
+	}
+	netTransportMu.Lock()
+	if netTransport != nil {
+		clone := *client
+		clone.Transport = netTransport
+		client = &clone
+	}
+	retry := netRetry
+	src := artifactSource
+	netTransportMu.Unlock()
+	retry.Attempts = cmp.Or(retry.Attempts, DefaultNetRetry.Attempts)
+	retry.StallTimeout = cmp.Or(retry.StallTimeout, DefaultNetRetry.StallTimeout)
+	retry.ProgressInterval = cmp.Or(retry.ProgressInterval,
+		DefaultNetRetry.ProgressInterval)
 
-	// If file exists and the hash matches, just return.
+	verify := hashType != 0
 	dstPath := path.Join(dstDir, path.Base(url))
-	fi, err := os.Open(dstPath)
-	if err == nil {
-		if _, err := io.Copy(hasher, fi); err != nil {
-			return "", fmt.Errorf("NetFetch: reading %s: %w", dstPath, err)
-		}
-		have := hex.EncodeToString(hasher.Sum(nil))
-		if have == hash {
+	partPath := Path(dstPath) + ".part"
+	if verify {
+		// If file exists and the hash matches, just return.
+		if have, err := hashFile(Path(dstPath), hashType); err == nil && have == hash {
 			log.Debug("file exist locally, hash matches, skipping download",
 				"file", dstPath)
 			return dstPath, nil
 		}
+	} else {
+		// Do not resume a file left by a previous run, maybe of a different version.
+		os.Remove(partPath)
 	}
 
-	if err := os.MkdirAll(dstDir, 0o775); err != nil {
+	if err := os.MkdirAll(Path(dstDir), 0o775); err != nil {
 		return "", fmt.Errorf("NetFetch: %w", err)
 	}
-	dst, err := os.Create(dstPath)
+
+	cachePath, err := src.cachePath(url)
 	if err != nil {
 		return "", fmt.Errorf("NetFetch: %w", err)
 	}
-	defer dst.Close()
+	if _, err := os.Stat(cachePath); cachePath != "" && err == nil {
+		// If not verifying, both have and hash are empty.
+		var have string
+		if verify {
+			have, _ = hashFile(cachePath, hashType)
+		}
+		if have == hash {
+			log.Debug("taking file from the artifact cache", "file", cachePath)
+			if err := copyPlain(cachePath, Path(dstPath)); err != nil {
+				return "", fmt.Errorf("NetFetch: %w", err)
+			}
+			return dstPath, nil
+		}
+		log.Warn("ignoring file in the artifact cache: hash mismatch",
+			"file", cachePath, "have", have, "want", hash)
+	}
+	if src.Offline {
+		return "", fmt.Errorf("NetFetch: offline: %s: not in the artifact cache (%s)",
+			url, src.CacheDir)
+	}
+	fetchURL := src.rewrite(url)
+	if fetchURL != url {
+		log.Debug("using mirror", "mirror", fetchURL)
+	}
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
+	fetch := fetcher{client: client, url: fetchURL, partPath: partPath, retry: retry,
+		log: log}
+
+	backoff := retry.Backoff
+	for attempt := 1; ; attempt++ {
+		resumed, err := fetch.once()
+		if err == nil && !verify {
+			break
+		}
+		if err == nil {
+			have, err := hashFile(partPath, hashType)
+			if err != nil {
+				return "", fmt.Errorf("NetFetch: %w", err)
+			}
+			if have == hash {
+				break
+			}
+			// The contents are wrong: the next attempt must not resume them.
+			os.Remove(partPath)
+			mismatch := fmt.Errorf("NetFetch: hash mismatch: have: %s; want: %s",
+				have, hash)
+			// If resumed, maybe the file changed on the server between two attempts,
+			// so retry from scratch, since a full download is authoritative.
+			if !resumed || attempt >= retry.Attempts {
+				return "", mismatch
+			}
+			log.Warn("hash mismatch after resuming, restarting from scratch")
+			continue
+		}
+		var perm permanentError
+		if errors.As(err, &perm) || attempt >= retry.Attempts {
+			return "", err
+		}
+		log.Warn("download failed, retrying", "attempt", attempt, "wait", backoff,
+			"err", err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, retry.MaxBackoff)
+	}
+
+	if err := os.Rename(partPath, Path(dstPath)); err != nil {
 		return "", fmt.Errorf("NetFetch: %w", err)
 	}
+	if cachePath != "" {
+		log.Debug("adding file to the artifact cache", "file", cachePath)
+		if err := copyPlain(Path(dstPath), cachePath); err != nil {
+			return "", fmt.Errorf("NetFetch: %w", err)
+		}
+	}
+	log.Debug("", "dstPath", dstPath)
+
+	return dstPath, nil
+}
+
+// permanentError is an error of NetFetch that retrying would not fix.
+type permanentError struct {
+	error
+}
+
+// fetcher downloads url to partPath.
+type fetcher struct {
+	client   *http.Client
+	url      string
+	partPath string
+	retry    NetRetry
+	log      *slog.Logger
+}
+
+// once makes one download attempt, resuming partPath if it exists. It returns true
+// if the download has been resumed.
+func (fe fetcher) once() (bool, error) {
+	var offset int64
+	if fi, err := os.Stat(fe.partPath); err == nil {
+		offset = fi.Size()
+	}
+
+	// Cancel the request if the transfer stalls.
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stall := time.AfterFunc(fe.retry.StallTimeout, func() {
+		cancel(fmt.Errorf("no data received for %v", fe.retry.StallTimeout))
+	})
+	defer stall.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fe.url, nil)
+	if err != nil {
+		return false, permanentError{fmt.Errorf("NetFetch: %w", err)}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
 	start := time.Now()
-	resp, err := client.Do(req)
+	resp, err := fe.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("NetFetch: %w", err)
+		return false, fe.cause(ctx, err, start)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("NetFetch: received %d %s (GET %s) (elapsed: %v)",
-			resp.StatusCode, http.StatusText(resp.StatusCode), url, time.Since(start))
+	flags := os.O_WRONLY | os.O_CREATE
+	total := resp.ContentLength
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"),
+			fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(fe.partPath)
+			return false, fmt.Errorf("NetFetch: unexpected Content-Range: %s (GET %s)",
+				resp.Header.Get("Content-Range"), fe.url)
+		}
+		flags |= os.O_APPEND
+		if total >= 0 {
+			total += offset
+		}
+		fe.log.Debug("resuming download", "offset", offset)
+	case resp.StatusCode == http.StatusOK:
+		// Either a new download, or the server does not support Range.
+		flags |= os.O_TRUNC
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The part file is already complete (or longer than the file on the server);
+		// the hash check will tell.
+		return true, nil
+	default:
+		err := fmt.Errorf("NetFetch: received %d %s (GET %s) (elapsed: %v)",
+			resp.StatusCode, http.StatusText(resp.StatusCode), fe.url, time.Since(start))
+		switch {
+		case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout,
+			resp.StatusCode == http.StatusTooManyRequests:
+			return false, err
+		default:
+			return false, permanentError{err}
+		}
 	}
 
-	hasher.Reset()
-	mw := io.MultiWriter(dst, hasher)
+	dst, err := os.OpenFile(fe.partPath, flags, 0o644)
+	if err != nil {
+		return false, permanentError{fmt.Errorf("NetFetch: %w", err)}
+	}
+	defer dst.Close()
 
-	if _, err := io.Copy(mw, resp.Body); err != nil {
-		return "", fmt.Errorf("NetFetch: saving %s to %s: %w (elapsed: %v)",
-			url, dstPath, err, time.Since(start))
+	progress := &progressWriter{
+		written: offset, total: total, stall: stall, retry: fe.retry, log: fe.log,
+		lastLog: time.Now(),
+	}
+	if _, err := io.Copy(io.MultiWriter(dst, progress), resp.Body); err != nil {
+		return offset > 0, fe.cause(ctx, fmt.Errorf("saving %s to %s: %w",
+			fe.url, fe.partPath, err), start)
+	}
+	if err := dst.Close(); err != nil {
+		return false, permanentError{fmt.Errorf("NetFetch: %w", err)}
 	}
-	elapsed := time.Since(start).Round(time.Millisecond)
-	log.Debug("downloaded", "elapsed", elapsed)
+	fe.log.Debug("downloaded", "elapsed", time.Since(start).Round(time.Millisecond),
+		"bytes", progress.written)
+	return offset > 0, nil
+}
 
-	have := hex.EncodeToString(hasher.Sum(nil))
-	if have != hash {
-		return "", fmt.Errorf("NetFetch: hash mismatch: have: %s; want: %s", have, hash)
+// cause returns err, annotated with the cause of the cancellation of ctx, if any.
+func (fe fetcher) cause(ctx context.Context, err error, start time.Time) error {
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
 	}
-	log.Debug("", "dstPath", dstPath)
+	return fmt.Errorf("NetFetch: %w (elapsed: %v)", err, time.Since(start))
+}
 
-	return dstPath, nil
+// progressWriter logs the progress of a download and postpones the stall timer at
+// each write.
+type progressWriter struct {
+	written int64
+	total   int64 // -1 if unknown
+	stall   *time.Timer
+	retry   NetRetry
+	log     *slog.Logger
+	lastLog time.Time
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	pw.written += int64(len(p))
+	pw.stall.Reset(pw.retry.StallTimeout)
+	if time.Since(pw.lastLog) >= pw.retry.ProgressInterval {
+		pw.lastLog = time.Now()
+		percent := "unknown"
+		if pw.total > 0 {
+			percent = strconv.FormatInt(100*pw.written/pw.total, 10) + "%"
+		}
+		pw.log.Info("downloading", "bytes", pw.written, "total", pw.total,
+			"percent", percent)
+	}
+	return len(p), nil
 }
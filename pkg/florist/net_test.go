@@ -1,11 +1,18 @@
 package florist_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -73,3 +80,225 @@ func TestNetFetchMockFailure(t *testing.T) {
 		})
 	}
 }
+
+// fastRetry makes NetFetch retry without waiting, restoring the default at the end of
+// the test.
+func fastRetry(t *testing.T) {
+	prev := florist.SetNetRetry(florist.NetRetry{
+		Attempts:     3,
+		StallTimeout: 200 * time.Millisecond,
+	})
+	t.Cleanup(func() { florist.SetNetRetry(prev) })
+}
+
+func TestNetFetchRetryAndResume(t *testing.T) {
+	contents := strings.Repeat("0123456789", 1000)
+	sum := sha256.Sum256([]byte(contents))
+	hash := hex.EncodeToString(sum[:])
+
+	type testCase struct {
+		name string
+		// respond to request number n (starting from 0); return false to let
+		// ServeContent serve the request.
+		respond    func(n int, w http.ResponseWriter) bool
+		wantRanges []string // Range header of each request
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		fastRetry(t)
+		dir := t.TempDir()
+		var mu sync.Mutex
+		var ranges []string
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				n := len(ranges)
+				ranges = append(ranges, r.Header.Get("Range"))
+				mu.Unlock()
+				if tc.respond(n, w) {
+					return
+				}
+				http.ServeContent(w, r, "", time.Time{}, strings.NewReader(contents))
+			},
+		))
+		defer ts.Close()
+
+		fpath, err := florist.NetFetch(nil, ts.URL+"/file.bin", florist.SHA256, hash, dir)
+
+		assert.NoError(t, err, "florist.NetFetch")
+		assert.FileEqualsString(t, fpath, contents)
+		assert.DeepEqual(t, ranges, tc.wantRanges, "Range headers")
+		_, err = os.Stat(fpath + ".part")
+		assert.True(t, os.IsNotExist(err), ".part file should not exist")
+	}
+
+	// truncated sends the first 3000 bytes and closes the connection.
+	truncated := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, contents[:3000])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	testCases := []testCase{
+		{
+			name: "transient server errors",
+			respond: func(n int, w http.ResponseWriter) bool {
+				if n < 2 {
+					http.Error(w, "try later", http.StatusServiceUnavailable)
+					return true
+				}
+				return false
+			},
+			wantRanges: []string{"", "", ""},
+		},
+		{
+			name: "resume after connection closed",
+			respond: func(n int, w http.ResponseWriter) bool {
+				if n == 0 {
+					truncated(w)
+				}
+				return false
+			},
+			wantRanges: []string{"", "bytes=3000-"},
+		},
+		{
+			name: "resume after stall",
+			respond: func(n int, w http.ResponseWriter) bool {
+				if n == 0 {
+					w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+					w.WriteHeader(http.StatusOK)
+					io.WriteString(w, contents[:5000])
+					w.(http.Flusher).Flush()
+					time.Sleep(time.Second)
+					return true
+				}
+				return false
+			},
+			wantRanges: []string{"", "bytes=5000-"},
+		},
+		{
+			name: "server ignores Range",
+			respond: func(n int, w http.ResponseWriter) bool {
+				if n == 0 {
+					truncated(w)
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+				io.WriteString(w, contents)
+				return true
+			},
+			wantRanges: []string{"", "bytes=3000-"},
+		},
+		{
+			name: "file changed on the server during resume",
+			respond: func(n int, w http.ResponseWriter) bool {
+				if n == 0 {
+					w.Header().Set("Content-Length", strconv.Itoa(len(contents)))
+					w.WriteHeader(http.StatusOK)
+					io.WriteString(w, "XXX"+contents[3:3000])
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				return false
+			},
+			wantRanges: []string{"", "bytes=3000-", ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestNetFetchResumeAcrossRuns(t *testing.T) {
+	fastRetry(t)
+	dir := t.TempDir()
+	contents := "banana split"
+	sum := sha256.Sum256([]byte(contents))
+	var gotRange string
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			gotRange = r.Header.Get("Range")
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(contents))
+		},
+	))
+	defer ts.Close()
+	// Left by a previous, interrupted, run.
+	err := os.WriteFile(filepath.Join(dir, "file.txt.part"), []byte("banana"), 0o644)
+	assert.NoError(t, err, "os.WriteFile")
+
+	fpath, err := florist.NetFetch(nil, ts.URL+"/file.txt", florist.SHA256,
+		hex.EncodeToString(sum[:]), dir)
+
+	assert.NoError(t, err, "florist.NetFetch")
+	assert.FileEqualsString(t, fpath, contents)
+	assert.Equal(t, gotRange, "bytes=6-", "Range header")
+}
+
+func TestNetFetchGivesUp(t *testing.T) {
+	type testCase struct {
+		name         string
+		status       int
+		wantRequests int
+		wantErr      string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		fastRetry(t)
+		dir := t.TempDir()
+		var requests atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(tc.status)
+			},
+		))
+		defer ts.Close()
+
+		_, err := florist.NetFetch(nil, ts.URL+"/file", florist.SHA256, "abc", dir)
+
+		assert.ErrorContains(t, err, tc.wantErr, "florist.NetFetch")
+		assert.Equal(t, int(requests.Load()), tc.wantRequests, "requests")
+		_, err = os.Stat(filepath.Join(dir, "file"))
+		assert.True(t, os.IsNotExist(err), "file should not exist")
+	}
+
+	testCases := []testCase{
+		{
+			name:         "permanent error",
+			status:       http.StatusForbidden,
+			wantRequests: 1,
+			wantErr:      "NetFetch: received 403 Forbidden",
+		},
+		{
+			name:         "transient error, too many attempts",
+			status:       http.StatusBadGateway,
+			wantRequests: 3,
+			wantErr:      "NetFetch: received 502 Bad Gateway",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestNetFetchZeroAttemptsMeansDefault(t *testing.T) {
+	// No backoff: zero Backoff and MaxBackoff do not take the default.
+	prev := florist.SetNetRetry(florist.NetRetry{StallTimeout: 200 * time.Millisecond})
+	t.Cleanup(func() { florist.SetNetRetry(prev) })
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	))
+	defer ts.Close()
+
+	_, err := florist.NetFetch(nil, ts.URL+"/file", florist.SHA256, "abc", t.TempDir())
+
+	assert.ErrorContains(t, err, "503 Service Unavailable", "florist.NetFetch")
+	assert.Equal(t, int(requests.Load()), florist.DefaultNetRetry.Attempts, "requests")
+}
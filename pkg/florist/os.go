@@ -10,7 +10,6 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
-	"strconv"
 	"text/template"
 )
 
@@ -48,7 +47,7 @@ func ListFs(fsys fs.FS) []string {
 // Explanation of the TOCTOU vulnerability:
 // https://wiki.sei.cmu.edu/confluence/display/c/FIO45-C.+Avoid+TOCTOU+race+conditions+while+accessing+files
 func FileExists(fpath string) (bool, error) {
-	_, err := os.Stat(fpath)
+	_, err := os.Stat(Path(fpath))
 	if err == nil {
 		return true, nil
 	}
@@ -62,22 +61,20 @@ func FileExists(fpath string) (bool, error) {
 // 'fname'. WriteFile will fail if the base directory of 'fname' doesn't exist.
 // This is done on purpose to ensure that the caller addresses explicitly the
 // ownership and permissions of the path segments containing 'fname'.
+// Like all the florist file operations, WriteFile honors [SetRoot].
 func WriteFile(fname string, data string,
 	mode os.FileMode, owner string, group string,
 ) error {
 	slog.Debug("WriteFile", "name", fname)
-	if err := os.WriteFile(fname, []byte(data), mode); err != nil {
-		return fmt.Errorf("florist.WriteFile: %s", err)
+	if err := os.WriteFile(Path(fname), []byte(data), mode); err != nil {
+		return fmt.Errorf("florist.WriteFile: %s", unmapErr(err))
 	}
 	// We call Chmod explicitly because os.WriteFile does _not_ change the
 	// mode _if_ the file already exists.
-	if err := os.Chmod(fname, mode); err != nil {
-		return fmt.Errorf("florist.WriteFile: %s", err)
-	}
-	if err := Chown(fname, owner); err != nil {
-		return fmt.Errorf("florist.WriteFile: %s", err)
+	if err := os.Chmod(Path(fname), mode); err != nil {
+		return fmt.Errorf("florist.WriteFile: %s", unmapErr(err))
 	}
-	if err := Chgrp(fname, group); err != nil {
+	if err := chown(fname, owner, group); err != nil {
 		return fmt.Errorf("florist.WriteFile: %s", err)
 	}
 
@@ -104,19 +101,7 @@ func WhoAmI() (string, string, error) {
 // Chown sets the owner of 'fpath' to the user ID and primary group ID of 'username'.
 // See also [Chgrp].
 func Chown(fpath string, username string) error {
-	theUser, err := user.Lookup(username)
-	if err != nil {
-		return fmt.Errorf("florist.chown: %s", err)
-	}
-	uid, err := strconv.Atoi(theUser.Uid)
-	if err != nil {
-		return fmt.Errorf("florist.chown: %s", err)
-	}
-	gid, err := strconv.Atoi(theUser.Gid)
-	if err != nil {
-		return fmt.Errorf("florist.chown: %s", err)
-	}
-	if err := os.Chown(fpath, uid, gid); err != nil {
+	if err := chownUser(fpath, username); err != nil {
 		return fmt.Errorf("florist.chown: %s", err)
 	}
 	return nil
@@ -125,16 +110,7 @@ func Chown(fpath string, username string) error {
 // Chgrp sets the group of 'fpath' to the group ID of 'groupname'.
 // See also [Chown].
 func Chgrp(fpath string, groupname string) error {
-	theGroup, err := user.LookupGroup(groupname)
-	if err != nil {
-		return fmt.Errorf("florist.chgrp: %s", err)
-	}
-	uid := -1 // Meaning: do not change the UID.
-	gid, err := strconv.Atoi(theGroup.Gid)
-	if err != nil {
-		return fmt.Errorf("florist.chgrp: %s", err)
-	}
-	if err := os.Chown(fpath, uid, gid); err != nil {
+	if err := chown(fpath, "", groupname); err != nil {
 		return fmt.Errorf("florist.chgrp: %s", err)
 	}
 	return nil
@@ -144,30 +120,12 @@ func Chgrp(fpath string, groupname string) error {
 func ChOwnMod(name string, mode os.FileMode, owner string, group string) error {
 	errorf := makeErrorf("ChOwnMod")
 
-	theOwner, err := user.Lookup(owner)
-	if err != nil {
-		return errorf("%s", err)
-	}
-	uid, err := strconv.Atoi(theOwner.Uid)
-	if err != nil {
+	if err := chown(name, owner, group); err != nil {
 		return errorf("%s", err)
 	}
 
-	theGroup, err := user.LookupGroup(group)
-	if err != nil {
-		return errorf("%s", err)
-	}
-	gid, err := strconv.Atoi(theGroup.Gid)
-	if err != nil {
-		return errorf("%s", err)
-	}
-
-	if err := os.Chown(name, uid, gid); err != nil {
-		return errorf("%s", err)
-	}
-
-	if err := os.Chmod(name, mode); err != nil {
-		return errorf("%s", err)
+	if err := os.Chmod(Path(name), mode); err != nil {
+		return errorf("%s", unmapErr(err))
 	}
 	return nil
 }
@@ -178,32 +136,15 @@ func ChOwnMod(name string, mode os.FileMode, owner string, group string) error {
 // error and proceeds, eventually overriding the previous ownership and
 // permissions.
 func Mkdir(fpath string, perm os.FileMode, owner string, group string) error {
-	err := os.Mkdir(fpath, perm)
+	err := os.Mkdir(Path(fpath), perm)
 	if err != nil && !errors.Is(err, fs.ErrExist) {
-		return fmt.Errorf("florist.Mkdir: %s", err)
-	}
-
-	theUser, err := user.Lookup(owner)
-	if err != nil {
-		return fmt.Errorf("florist.Mkdir: %s", err)
-	}
-	uid, err := strconv.Atoi(theUser.Uid)
-	if err != nil {
-		return fmt.Errorf("florist.Mkdir: %s", err)
-	}
-	theGroup, err := user.LookupGroup(group)
-	if err != nil {
-		return fmt.Errorf("florist.Mkdir: %s", err)
-	}
-	gid, err := strconv.Atoi(theGroup.Gid)
-	if err != nil {
-		return fmt.Errorf("florist.Mkdir: %s", err)
+		return fmt.Errorf("florist.Mkdir: %s", unmapErr(err))
 	}
 
-	if err := os.Chmod(fpath, perm); err != nil {
-		return fmt.Errorf("florist.Mkdir: %s", err)
+	if err := os.Chmod(Path(fpath), perm); err != nil {
+		return fmt.Errorf("florist.Mkdir: %s", unmapErr(err))
 	}
-	if err := os.Chown(fpath, uid, gid); err != nil {
+	if err := chown(fpath, owner, group); err != nil {
 		return fmt.Errorf("florist.Mkdir: %s", err)
 	}
 
@@ -322,10 +263,12 @@ func renderTemplate(
 // the template file name.
 // Parameters 'delimL' and 'delimR' as template delimiters. If they are empty,
 // then the default delimiters "{{" and "}}" will be used.
+// The template can use the functions returned by [TemplateFuncs].
 func renderText(tmplText string, tmplData any, tmplName string,
 	delimL, delimR string,
 ) (string, error) {
 	tmpl := template.New(tmplName).
+		Funcs(TemplateFuncs()).
 		Delims(delimL, delimR).
 		Option("missingkey=error")
 
@@ -347,40 +290,40 @@ func copyFile(
 	srcFs fs.FS, srcPath string, dstPath string,
 	mode os.FileMode, owner string,
 ) error {
-	ownerUser, err := user.Lookup(owner)
-	if err != nil {
-		return fmt.Errorf("florist.copyfile: %s", err)
+	if !Hermetic() {
+		if _, err := user.Lookup(owner); err != nil {
+			return fmt.Errorf("florist.copyfile: %s", err)
+		}
 	}
 
 	var src fs.File
+	var err error
 	if srcFs != nil {
 		src, err = srcFs.Open(srcPath)
 	} else {
-		src, err = os.Open(srcPath)
+		src, err = os.Open(Path(srcPath))
 	}
 	if err != nil {
-		return fmt.Errorf("florist.copyfile: open src file: %s", err)
+		return fmt.Errorf("florist.copyfile: open src file: %s", unmapErr(err))
 	}
 	defer src.Close()
 
-	if err := os.MkdirAll(filepath.Dir(dstPath), mode|0o111); err != nil {
-		return fmt.Errorf("florist.copyfile: %s", err)
+	if err := os.MkdirAll(filepath.Dir(Path(dstPath)), mode|0o111); err != nil {
+		return fmt.Errorf("florist.copyfile: %s", unmapErr(err))
 	}
 
 	// if dstPath is an executable file and is running, then we will get back a
 	// TXTBSY (text file busy).
 	// The workaround is to unlink (or delete) the file beforehand.
-	_ = os.Remove(dstPath) // useless to check for errors now
+	_ = os.Remove(Path(dstPath)) // useless to check for errors now
 
-	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	dst, err := os.OpenFile(Path(dstPath), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
-		return fmt.Errorf("florist.copyfile: open dst file: %s", err)
+		return fmt.Errorf("florist.copyfile: open dst file: %s", unmapErr(err))
 	}
 	defer dst.Close()
 
-	uid, _ := strconv.Atoi(ownerUser.Uid)
-	gid, _ := strconv.Atoi(ownerUser.Gid)
-	if err := os.Chown(dstPath, uid, gid); err != nil {
+	if err := chownUser(dstPath, owner); err != nil {
 		return fmt.Errorf("florist.copyfile: %s", err)
 	}
 
@@ -4,6 +4,8 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"strconv"
+	"syscall"
 	"testing"
 
 	"github.com/marco-m/florist/pkg/florist"
@@ -51,6 +53,22 @@ func TestMkdirFailure(t *testing.T) {
 	assert.ErrorContains(t, err, "unknown user", "florist.Mkdir")
 }
 
+func TestChownSetsPrimaryGroupID(t *testing.T) {
+	fPath := filepath.Join(t.TempDir(), "foo")
+	err := os.WriteFile(fPath, []byte("hello"), 0o644)
+	assert.NoError(t, err, "os.WriteFile")
+	theUser, err := user.Current()
+	assert.NoError(t, err, "user.Current")
+
+	err = florist.Chown(fPath, theUser.Username)
+	assert.NoError(t, err, "florist.Chown")
+
+	fi, err := os.Stat(fPath)
+	assert.NoError(t, err, "os.Stat")
+	stat := fi.Sys().(*syscall.Stat_t)
+	assert.Equal(t, strconv.Itoa(int(stat.Gid)), theUser.Gid, "gid")
+}
+
 // whoami returns the user name and group name of the current user.
 func whoami(t *testing.T) (string, string) {
 	theUser, err := user.Current()
@@ -0,0 +1,292 @@
+package florist
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The filesystem root of all the florist file operations. See [SetRoot].
+var (
+	rootMu sync.Mutex
+	root   = "/"
+	// owners records the ownership of the paths, only in hermetic mode.
+	owners = map[string]Ownership{}
+)
+
+// Ownership is the owner and group of a path, as recorded in hermetic mode.
+// See [SetRoot] and [OwnerOf].
+type Ownership struct {
+	Owner string
+	Group string
+}
+
+// SetRoot sets the filesystem root of all the florist file operations (WriteFile,
+// Mkdir, CopyFile, SyncDir, NetFetch, the archive functions, ...) and of the packages
+// and flowers that use them.
+//
+// The default root, "/", means the real filesystem. Any other directory enables the
+// hermetic mode, meant for testing: each absolute path is mapped below 'dir' (for
+// example "/etc/motd" becomes "dir/etc/motd"), while relative paths are left as they
+// are. In hermetic mode, changing owner and group of a path does not require
+// elevated privileges: the ownership is only recorded (see [OwnerOf]) and the users
+// and groups do not need to exist.
+//
+// Directory 'dir' must be absolute and must exist. DO NOT CALL in production code;
+// see provisioner.Options.RootDir and package flowertest.
+func SetRoot(dir string) error {
+	errorf := makeErrorf("SetRoot")
+	if !filepath.IsAbs(dir) {
+		return errorf("root must be an absolute path: %q", dir)
+	}
+	dir = filepath.Clean(dir)
+	if dir != "/" {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return errorf("%s", err)
+		}
+		if !fi.IsDir() {
+			return errorf("%s: not a directory", dir)
+		}
+	}
+
+	rootMu.Lock()
+	defer rootMu.Unlock()
+	root = dir
+	owners = map[string]Ownership{}
+	return nil
+}
+
+// Root returns the filesystem root set by [SetRoot].
+func Root() string {
+	rootMu.Lock()
+	defer rootMu.Unlock()
+	return root
+}
+
+// Hermetic returns true if the filesystem root is not "/". See [SetRoot].
+func Hermetic() bool {
+	return Root() != "/"
+}
+
+// Path maps 'fpath' to the filesystem root set by [SetRoot]. An absolute path
+// becomes relative to the root; a relative path is returned unchanged.
+//
+// All the florist functions take and return unmapped paths and call Path internally.
+// Call Path only when using the os package directly.
+func Path(fpath string) string {
+	if !filepath.IsAbs(fpath) {
+		return fpath
+	}
+	rootDir := Root()
+	if rootDir == "/" {
+		return fpath
+	}
+	return filepath.Join(rootDir, fpath)
+}
+
+// unmapPath is the inverse of [Path].
+func unmapPath(fpath string) string {
+	rootDir := Root()
+	if rootDir == "/" || !filepath.IsAbs(fpath) {
+		return fpath
+	}
+	rel, err := filepath.Rel(rootDir, fpath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fpath
+	}
+	return filepath.Join("/", rel)
+}
+
+// OwnerOf returns the ownership recorded for 'fpath' in hermetic mode, and true if
+// found. See [SetRoot].
+func OwnerOf(fpath string) (Ownership, bool) {
+	rootMu.Lock()
+	defer rootMu.Unlock()
+	own, found := owners[filepath.Clean(fpath)]
+	return own, found
+}
+
+// chown sets the owner and group of 'fpath', within the root set by [SetRoot]. An
+// empty owner or group is left unchanged. In hermetic mode, it only records the
+// ownership.
+func chown(fpath string, owner string, group string) error {
+	if Hermetic() {
+		rootMu.Lock()
+		defer rootMu.Unlock()
+		key := filepath.Clean(fpath)
+		own := owners[key]
+		if owner != "" {
+			own.Owner = owner
+		}
+		if group != "" {
+			own.Group = group
+		}
+		owners[key] = own
+		return nil
+	}
+
+	uid, gid := -1, -1 // Meaning: do not change.
+	if owner != "" {
+		theUser, err := user.Lookup(owner)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(theUser.Uid); err != nil {
+			return err
+		}
+	}
+	if group != "" {
+		theGroup, err := user.LookupGroup(group)
+		if err != nil {
+			return err
+		}
+		if gid, err = strconv.Atoi(theGroup.Gid); err != nil {
+			return err
+		}
+	}
+	return unmapErr(os.Chown(Path(fpath), uid, gid))
+}
+
+// chownUser sets the owner of 'fpath' to 'username' and the group to the primary
+// group of 'username', by numeric ID: the primary group might have no name, or a
+// name different from 'username'. In hermetic mode, it only records the ownership,
+// see [primaryGroup].
+func chownUser(fpath string, username string) error {
+	if Hermetic() {
+		return chown(fpath, username, primaryGroup(username))
+	}
+
+	theUser, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(theUser.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(theUser.Gid)
+	if err != nil {
+		return err
+	}
+	return unmapErr(os.Chown(Path(fpath), uid, gid))
+}
+
+// primaryGroup returns the name of the primary group of 'username', to record it in
+// hermetic mode. Since in hermetic mode the user does not need to exist, if the
+// lookup fails it returns 'username', which is the primary group of the majority of
+// the users on a Debian system.
+func primaryGroup(username string) string {
+	theUser, err := user.Lookup(username)
+	if err != nil {
+		return username
+	}
+	theGroup, err := user.LookupGroupId(theUser.Gid)
+	if err != nil {
+		return username
+	}
+	return theGroup.Name
+}
+
+// MkdirAll is like [os.MkdirAll], within the root set by [SetRoot].
+func MkdirAll(fpath string, perm os.FileMode) error {
+	if err := os.MkdirAll(Path(fpath), perm); err != nil {
+		return fmt.Errorf("florist.MkdirAll: %s", unmapErr(err))
+	}
+	return nil
+}
+
+// MkdirTemp is like [os.MkdirTemp], within the root set by [SetRoot]. If 'dir' is
+// empty, it uses [os.TempDir]. It returns the unmapped path of the new directory.
+func MkdirTemp(dir string, pattern string) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	name, err := os.MkdirTemp(Path(dir), pattern)
+	if err != nil {
+		return "", fmt.Errorf("florist.MkdirTemp: %s", unmapErr(err))
+	}
+	return unmapPath(name), nil
+}
+
+// Remove is like [os.Remove], within the root set by [SetRoot].
+func Remove(fpath string) error {
+	if err := os.Remove(Path(fpath)); err != nil {
+		return fmt.Errorf("florist.Remove: %w", unmapErr(err))
+	}
+	return nil
+}
+
+// RemoveAll is like [os.RemoveAll], within the root set by [SetRoot].
+func RemoveAll(fpath string) error {
+	if err := os.RemoveAll(Path(fpath)); err != nil {
+		return fmt.Errorf("florist.RemoveAll: %w", unmapErr(err))
+	}
+	return nil
+}
+
+// Rename is like [os.Rename], within the root set by [SetRoot].
+func Rename(oldpath string, newpath string) error {
+	if err := os.Rename(Path(oldpath), Path(newpath)); err != nil {
+		return fmt.Errorf("florist.Rename: %w", unmapErr(err))
+	}
+	return nil
+}
+
+// Symlink creates 'linkname' as a symbolic link to 'target', within the root set by
+// [SetRoot]. Only 'linkname' is mapped: 'target' is stored as it is, so that the link
+// has the same contents it would have in the real filesystem.
+func Symlink(target string, linkname string) error {
+	if err := os.Symlink(target, Path(linkname)); err != nil {
+		return fmt.Errorf("florist.Symlink: %w", unmapErr(err))
+	}
+	return nil
+}
+
+// ReadFile is like [os.ReadFile], within the root set by [SetRoot].
+func ReadFile(fpath string) ([]byte, error) {
+	buf, err := os.ReadFile(Path(fpath))
+	if err != nil {
+		return nil, fmt.Errorf("florist.ReadFile: %w", unmapErr(err))
+	}
+	return buf, nil
+}
+
+// ReadDir is like [os.ReadDir], within the root set by [SetRoot].
+func ReadDir(fpath string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(Path(fpath))
+	if err != nil {
+		return nil, fmt.Errorf("florist.ReadDir: %w", unmapErr(err))
+	}
+	return entries, nil
+}
+
+// OpenFile is like [os.OpenFile], within the root set by [SetRoot].
+func OpenFile(fpath string, flag int, perm os.FileMode) (*os.File, error) {
+	fi, err := os.OpenFile(Path(fpath), flag, perm)
+	if err != nil {
+		return nil, fmt.Errorf("florist.OpenFile: %w", unmapErr(err))
+	}
+	return fi, nil
+}
+
+// unmapErr replaces, in the path errors, the mapped path with the unmapped one, so
+// that the error messages do not depend on the root set by [SetRoot].
+func unmapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch e := err.(type) {
+	case *fs.PathError:
+		return &fs.PathError{Op: e.Op, Path: unmapPath(e.Path), Err: e.Err}
+	case *os.LinkError:
+		return &os.LinkError{Op: e.Op, Old: unmapPath(e.Old), New: unmapPath(e.New), Err: e.Err}
+	default:
+		return err
+	}
+}
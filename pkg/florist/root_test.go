@@ -0,0 +1,72 @@
+package florist_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/rosina/assert"
+)
+
+// setRoot sets the florist root to a temporary directory for the duration of the test.
+func setRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	assert.NoError(t, florist.SetRoot(root), "florist.SetRoot")
+	t.Cleanup(func() {
+		if err := florist.SetRoot("/"); err != nil {
+			t.Errorf("restoring root: %s", err)
+		}
+	})
+	return root
+}
+
+func TestHermeticRoot(t *testing.T) {
+	root := setRoot(t)
+	assert.True(t, florist.Hermetic(), "florist.Hermetic")
+	assert.Equal(t, florist.Path("/etc/motd"), filepath.Join(root, "etc/motd"),
+		"florist.Path absolute")
+	assert.Equal(t, florist.Path("relative/file"), "relative/file",
+		"florist.Path relative")
+
+	// The users do not need to exist: ownership is only recorded.
+	err := florist.MkdirAll("/etc", 0o755)
+	assert.NoError(t, err, "florist.MkdirAll")
+	err = florist.Mkdir("/etc/consul.d", 0o750, "consul", "consul")
+	assert.NoError(t, err, "florist.Mkdir")
+	err = florist.WriteFile("/etc/consul.d/consul.hcl", "hello", 0o640,
+		"consul", "consul-readers")
+	assert.NoError(t, err, "florist.WriteFile")
+
+	assert.FileEqualsString(t, filepath.Join(root, "etc/consul.d/consul.hcl"), "hello")
+	own, found := florist.OwnerOf("/etc/consul.d/consul.hcl")
+	assert.True(t, found, "florist.OwnerOf found")
+	assert.Equal(t, own, florist.Ownership{Owner: "consul", Group: "consul-readers"},
+		"ownership")
+
+	err = florist.Chgrp("/etc/consul.d/consul.hcl", "consul")
+	assert.NoError(t, err, "florist.Chgrp")
+	own, _ = florist.OwnerOf("/etc/consul.d/consul.hcl")
+	assert.Equal(t, own, florist.Ownership{Owner: "consul", Group: "consul"},
+		"ownership after Chgrp")
+
+	err = florist.Symlink("/usr/share/zoneinfo/UTC", "/etc/localtime")
+	assert.NoError(t, err, "florist.Symlink")
+	target, err := os.Readlink(filepath.Join(root, "etc/localtime"))
+	assert.NoError(t, err, "os.Readlink")
+	assert.Equal(t, target, "/usr/share/zoneinfo/UTC", "symlink target")
+
+	_, err = florist.ReadFile("/etc/nonexistent")
+	assert.ErrorContains(t, err, "florist.ReadFile: open /etc/nonexistent: ",
+		"error mentions the unmapped path")
+}
+
+func TestSetRootFailure(t *testing.T) {
+	err := florist.SetRoot("relative")
+	assert.ErrorContains(t, err, "SetRoot: root must be an absolute path", "relative")
+
+	err = florist.SetRoot(filepath.Join(t.TempDir(), "nonexistent"))
+	assert.ErrorContains(t, err, "no such file or directory", "nonexistent")
+	assert.Equal(t, florist.Root(), "/", "root unchanged")
+}
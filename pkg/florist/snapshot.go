@@ -0,0 +1,252 @@
+package florist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SnapshotDirs are the directories recorded by default by a [Snapshotter]. Users and
+// groups are covered by /etc/passwd and /etc/group.
+var SnapshotDirs = []string{"/etc", "/opt", "/srv", "/usr/local"}
+
+// Snapshotter takes snapshots of the host state that the flowers modify: files and
+// directories (contents, mode, owner, group, symlink target), users and groups,
+// installed packages and systemd units. Comparing two snapshots tells if something
+// changed in between; see [Snapshot.Diff].
+//
+// Like all the florist file operations, Snapshotter honors [SetRoot]. The packages
+// and the units are queried with [CmdOutput], but not under a root set with
+// SetRoot: they would be the ones of the host, and the queries would end up among
+// the calls of a [FakeRunner] installed for the flowers.
+type Snapshotter struct {
+	// If true, do not record packages and units: only the files.
+	FilesOnly bool
+	// If not nil, query the packages and the units with Runner instead of with
+	// [CmdOutput], also under a root set with [SetRoot].
+	Runner Runner
+
+	dirs   []string
+	hashes map[string]cachedHash
+}
+
+// cachedHash avoids hashing again the files that did not change, such as the
+// thousands of files of a Go installation.
+type cachedHash struct {
+	size    int64
+	modTime time.Time
+	ino     uint64
+	hash    string
+}
+
+// Snapshot is the host state recorded by [Snapshotter.Take].
+type Snapshot struct {
+	files    map[string]fileState
+	packages string
+	units    string
+}
+
+type fileState struct {
+	mode   fs.FileMode
+	owner  string
+	target string
+	hash   string
+}
+
+func (fst fileState) String() string {
+	s := fmt.Sprintf("mode=%v owner=%s", fst.mode, fst.owner)
+	if fst.target != "" {
+		s += " target=" + fst.target
+	}
+	if fst.hash != "" {
+		s += " sha256=" + fst.hash
+	}
+	return s
+}
+
+// NewSnapshotter returns a Snapshotter for directories 'dirs', or for [SnapshotDirs]
+// if 'dirs' is empty.
+func NewSnapshotter(dirs ...string) *Snapshotter {
+	if len(dirs) == 0 {
+		dirs = SnapshotDirs
+	}
+	return &Snapshotter{dirs: dirs, hashes: make(map[string]cachedHash)}
+}
+
+// Take records the current host state. Directories that do not exist are skipped;
+// files that cannot be read (for example /etc/shadow, if not running as root) are
+// recorded without their contents.
+func (sn *Snapshotter) Take() (*Snapshot, error) {
+	errorf := makeErrorf("Snapshotter.Take")
+	log := slog.With("fn", "Snapshotter.Take")
+	snap := &Snapshot{files: make(map[string]fileState)}
+
+	for _, dir := range sn.dirs {
+		if err := sn.walk(snap, dir); err != nil {
+			return nil, errorf("%s", err)
+		}
+	}
+
+	if sn.FilesOnly || (sn.Runner == nil && Root() != "/") {
+		return snap, nil
+	}
+	output := CmdOutput
+	if sn.Runner != nil {
+		output = sn.Runner.Output
+	}
+
+	// Packages and units are best effort: the tools might not be there (for example,
+	// when developing on macOS).
+	out, err := output(log, exec.Command("dpkg-query", "--show",
+		"--showformat=${Package} ${Version} ${db:Status-Abbrev}\n"))
+	if err != nil {
+		log.Debug("cannot list packages", "err", err)
+	}
+	snap.packages = string(out)
+
+	out, err = output(log, exec.Command("systemctl", "list-unit-files",
+		"--no-legend", "--no-pager"))
+	if err != nil {
+		log.Debug("cannot list unit files", "err", err)
+	}
+	snap.units = string(out)
+	out, err = output(log, exec.Command("systemctl", "list-units", "--all",
+		"--no-legend", "--no-pager", "--plain"))
+	if err != nil {
+		log.Debug("cannot list units", "err", err)
+	}
+	snap.units += string(out)
+
+	return snap, nil
+}
+
+func (sn *Snapshotter) walk(snap *Snapshot, dir string) error {
+	walkFn := func(realPath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				return nil
+			}
+			return err
+		}
+		fpath := unmapPath(realPath)
+		fi, err := de.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // Removed while walking.
+			}
+			return err
+		}
+		fst := fileState{mode: fi.Mode(), owner: fileOwner(fpath, fi)}
+		switch {
+		case fi.Mode()&fs.ModeSymlink != 0:
+			fst.target, err = os.Readlink(realPath)
+			if err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			fst.hash = sn.hash(realPath, fi)
+		}
+		snap.files[fpath] = fst
+		return nil
+	}
+	return filepath.WalkDir(Path(dir), walkFn)
+}
+
+// hash returns the hex-encoded SHA-256 of file 'realPath', or "unreadable".
+func (sn *Snapshotter) hash(realPath string, fi fs.FileInfo) string {
+	var ino uint64
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		ino = uint64(st.Ino)
+	}
+	if prev, found := sn.hashes[realPath]; found && prev.size == fi.Size() &&
+		prev.modTime.Equal(fi.ModTime()) && prev.ino == ino {
+		return prev.hash
+	}
+
+	fp, err := os.Open(realPath)
+	if err != nil {
+		return "unreadable"
+	}
+	defer fp.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fp); err != nil {
+		return "unreadable"
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	sn.hashes[realPath] = cachedHash{
+		size: fi.Size(), modTime: fi.ModTime(), ino: ino, hash: hash,
+	}
+	return hash
+}
+
+// fileOwner returns owner and group of 'fpath' as "owner:group". In hermetic mode, it
+// uses the recorded names, otherwise the numeric IDs.
+func fileOwner(fpath string, fi fs.FileInfo) string {
+	if Hermetic() {
+		own, _ := OwnerOf(fpath)
+		return own.Owner + ":" + own.Group
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return strconv.Itoa(int(st.Uid)) + ":" + strconv.Itoa(int(st.Gid))
+	}
+	return ":"
+}
+
+// Diff returns the differences from snapshot 'before' to snapshot 'after', one per
+// line, sorted. It returns nil if nothing changed.
+func (before *Snapshot) Diff(after *Snapshot) []string {
+	var diffs []string
+	for fpath, b := range before.files {
+		a, found := after.files[fpath]
+		switch {
+		case !found:
+			diffs = append(diffs, "deleted "+fpath)
+		case a != b:
+			diffs = append(diffs, fmt.Sprintf("changed %s: %s -> %s", fpath, b, a))
+		}
+	}
+	for fpath := range after.files {
+		if _, found := before.files[fpath]; !found {
+			diffs = append(diffs, "created "+fpath)
+		}
+	}
+	diffs = append(diffs, diffLines("package", before.packages, after.packages)...)
+	diffs = append(diffs, diffLines("unit", before.units, after.units)...)
+	sort.Strings(diffs)
+	return diffs
+}
+
+// diffLines returns the lines removed and added from 'before' to 'after', ignoring
+// the order.
+func diffLines(what string, before string, after string) []string {
+	count := make(map[string]int)
+	for _, line := range strings.Split(before, "\n") {
+		count[strings.TrimSpace(line)]--
+	}
+	for _, line := range strings.Split(after, "\n") {
+		count[strings.TrimSpace(line)]++
+	}
+	var diffs []string
+	for line, n := range count {
+		switch {
+		case line == "" || n == 0:
+		case n < 0:
+			diffs = append(diffs, fmt.Sprintf("%s removed: %s", what, line))
+		default:
+			diffs = append(diffs, fmt.Sprintf("%s added: %s", what, line))
+		}
+	}
+	return diffs
+}
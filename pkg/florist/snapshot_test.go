@@ -0,0 +1,73 @@
+package florist_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	setRoot(t)
+	fake := florist.NewFakeRunner()
+	fake.On("systemctl list-unit-files --no-legend --no-pager", "ssh.service enabled enabled\n", nil)
+
+	assert.NoError(t, florist.MkdirAll("/etc/profile.d", 0o755), "florist.MkdirAll")
+	write := func(fname, data string, mode os.FileMode, owner string) {
+		t.Helper()
+		err := florist.WriteFile(fname, data, mode, owner, owner)
+		assert.NoError(t, err, "florist.WriteFile")
+	}
+	write("/etc/environment", "A=1\n", 0o644, "root")
+	write("/etc/profile.d/old.sh", "", 0o644, "root")
+	write("/etc/same", "same", 0o644, "root")
+
+	snapshotter := florist.NewSnapshotter("/etc", "/nonexistent")
+	snapshotter.Runner = fake
+	before, err := snapshotter.Take()
+	assert.NoError(t, err, "before")
+
+	assert.DeepEqual(t, before.Diff(before), []string(nil), "no changes")
+
+	write("/etc/environment", "A=1\nA=1\n", 0o644, "root")
+	write("/etc/same", "same", 0o644, "root") // Rewritten with the same contents.
+	write("/etc/profile.d/new.sh", "", 0o644, "root")
+	assert.NoError(t, florist.Remove("/etc/profile.d/old.sh"), "florist.Remove")
+	assert.NoError(t, florist.Chown("/etc/profile.d", "consul"), "florist.Chown")
+	fake.On("systemctl list-unit-files --no-legend --no-pager", "ssh.service disabled enabled\n", nil)
+
+	after, err := snapshotter.Take()
+	assert.NoError(t, err, "after")
+
+	want := []string{
+		"changed /etc/environment: mode=-rw-r--r-- owner=root:root sha256=" +
+			sha256hex("A=1\n") + " -> mode=-rw-r--r-- owner=root:root sha256=" +
+			sha256hex("A=1\nA=1\n"),
+		"changed /etc/profile.d: mode=drwxr-xr-x owner=: -> mode=drwxr-xr-x owner=consul:consul",
+		"created /etc/profile.d/new.sh",
+		"deleted /etc/profile.d/old.sh",
+		"unit added: ssh.service disabled enabled",
+		"unit removed: ssh.service enabled enabled",
+	}
+	assert.DeepEqual(t, before.Diff(after), want, "changes")
+}
+
+func sha256hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSnapshotUnderRootDoesNotQueryTheRunner(t *testing.T) {
+	setRoot(t)
+	fake := florist.NewFakeRunner()
+	prev := florist.SetRunner(fake)
+	t.Cleanup(func() { florist.SetRunner(prev) })
+
+	_, err := florist.NewSnapshotter("/etc").Take()
+	assert.NoError(t, err, "Take")
+
+	assert.DeepEqual(t, fake.Calls(), []string(nil), "calls")
+}
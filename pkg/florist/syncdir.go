@@ -0,0 +1,317 @@
+package florist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// TemplateSuffix is the suffix of the files that [SyncDir] renders as templates.
+// The suffix is removed from the destination file name.
+const TemplateSuffix = ".tmpl"
+
+// SyncDirOpts contains the options for [SyncDir].
+type SyncDirOpts struct {
+	// Data passed to the templates. Optional.
+	Data any
+	// The template delimiters. Default: "{{" and "}}".
+	DelimL, DelimR string
+	// Owner and group of the files and directories. Mandatory.
+	Owner, Group string
+	// Mode of the files. Default: 0o644.
+	FileMode os.FileMode
+	// Mode of the directories. Default: 0o755.
+	DirMode os.FileMode
+	// Per-path overrides of mode, owner and group. For each path, the first matching
+	// rule wins.
+	Rules []SyncRule
+	// If true, delete the files and directories below dstDir that are not present in
+	// srcDir.
+	Prune bool
+}
+
+// SyncRule overrides mode, owner and group for the paths matching Pattern.
+type SyncRule struct {
+	// Pattern is matched with [path.Match] against the path relative to dstDir, after
+	// removal of [TemplateSuffix]. For example: "*.hcl", "secrets/*".
+	Pattern string
+	// If zero, use the default from SyncDirOpts.
+	Mode os.FileMode
+	// If empty, use the default from SyncDirOpts.
+	Owner, Group string
+}
+
+// ChangeOp is the kind of a [Change].
+type ChangeOp string
+
+const (
+	Created ChangeOp = "created"
+	Updated ChangeOp = "updated"
+	Deleted ChangeOp = "deleted"
+)
+
+// Change is a modification done to the filesystem.
+type Change struct {
+	Path string
+	Op   ChangeOp
+}
+
+func (ch Change) String() string {
+	return fmt.Sprintf("%s %s", ch.Op, ch.Path)
+}
+
+// SyncDir makes directory 'dstDir' in the "real" filesystem (within the root set by
+// [SetRoot]) match directory 'srcDir' in filesystem 'fsys' (for example, via
+// go:embed). It renders the files ending in [TemplateSuffix] with opts.Data, dropping
+// the suffix from the destination name, and copies the other files. Directory
+// 'dstDir' is created if needed, but its parent must exist.
+//
+// A file or directory is modified only if its contents, mode, owner or group differ
+// from the wanted ones. If opts.Prune is true, the files and directories below
+// 'dstDir' that are not in 'srcDir' are deleted.
+//
+// SyncDir returns the list of changes done, in path order.
+func SyncDir(fsys fs.FS, srcDir string, dstDir string, opts *SyncDirOpts) ([]Change, error) {
+	errorf := makeErrorf("SyncDir")
+	log := slog.With("fn", "SyncDir", "src", srcDir, "dst", dstDir)
+
+	if opts == nil || opts.Owner == "" || opts.Group == "" {
+		return nil, errorf("missing owner or group")
+	}
+	// Do not modify the caller's options when setting the defaults.
+	optsCopy := *opts
+	opts = &optsCopy
+	if opts.FileMode == 0 {
+		opts.FileMode = 0o644
+	}
+	if opts.DirMode == 0 {
+		opts.DirMode = 0o755
+	}
+	sub, err := fs.Sub(fsys, srcDir)
+	if err != nil {
+		return nil, errorf("%s", err)
+	}
+
+	var changes []Change
+	managed := map[string]bool{".": true}
+	// Map from destination to source, to detect "x" and "x.tmpl" in the same tree.
+	sources := map[string]string{}
+
+	walkFn := func(srcPath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := srcPath
+		isTemplate := !de.IsDir() && strings.HasSuffix(rel, TemplateSuffix)
+		if isTemplate {
+			rel = strings.TrimSuffix(rel, TemplateSuffix)
+		}
+		if prev, found := sources[rel]; found {
+			return fmt.Errorf("%s and %s have the same destination %s",
+				path.Join(srcDir, prev), path.Join(srcDir, srcPath), rel)
+		}
+		sources[rel] = srcPath
+		managed[rel] = true
+		dstPath := filepath.Join(dstDir, filepath.FromSlash(rel))
+
+		if de.IsDir() {
+			mode, owner, group := opts.attributes(rel, true)
+			change, err := syncDirectory(dstPath, mode, owner, group)
+			if err != nil {
+				return err
+			}
+			if change != "" {
+				changes = append(changes, Change{Path: dstPath, Op: change})
+			}
+			return nil
+		}
+
+		if !de.Type().IsRegular() {
+			log.Debug("skipping non-regular file", "path", srcPath)
+			return nil
+		}
+		buf, err := fs.ReadFile(sub, srcPath)
+		if err != nil {
+			return err
+		}
+		contents := string(buf)
+		if isTemplate {
+			contents, err = renderText(contents, opts.Data, path.Join(srcDir, srcPath),
+				opts.DelimL, opts.DelimR)
+			if err != nil {
+				return err
+			}
+		}
+		mode, owner, group := opts.attributes(rel, false)
+		change, err := syncFile(dstPath, contents, mode, owner, group)
+		if err != nil {
+			return err
+		}
+		if change != "" {
+			log.Debug("synced", "path", dstPath, "op", change)
+			changes = append(changes, Change{Path: dstPath, Op: change})
+		}
+		return nil
+	}
+	if err := fs.WalkDir(sub, ".", walkFn); err != nil {
+		return changes, errorf("%s", err)
+	}
+
+	if opts.Prune {
+		deleted, err := pruneDir(dstDir, managed)
+		changes = append(changes, deleted...)
+		if err != nil {
+			return changes, errorf("%s", err)
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// attributes returns mode, owner and group for path 'rel', relative to dstDir.
+func (opts *SyncDirOpts) attributes(rel string, isDir bool) (os.FileMode, string, string) {
+	mode, owner, group := opts.FileMode, opts.Owner, opts.Group
+	if isDir {
+		mode = opts.DirMode
+	}
+	for _, rule := range opts.Rules {
+		if matched, _ := path.Match(rule.Pattern, rel); !matched {
+			continue
+		}
+		if rule.Mode != 0 {
+			mode = rule.Mode
+		}
+		if rule.Owner != "" {
+			owner = rule.Owner
+		}
+		if rule.Group != "" {
+			group = rule.Group
+		}
+		break
+	}
+	return mode, owner, group
+}
+
+// syncDirectory ensures that directory 'dstPath' exists with 'mode', 'owner' and
+// 'group'. It returns the change done, if any.
+func syncDirectory(dstPath string, mode os.FileMode, owner, group string) (ChangeOp, error) {
+	fi, err := os.Stat(Path(dstPath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if err == nil {
+		if !fi.IsDir() {
+			return "", fmt.Errorf("%s: exists and is not a directory", dstPath)
+		}
+		same, err := sameAttributes(dstPath, fi, mode, owner, group)
+		if err != nil || same {
+			return "", err
+		}
+	}
+	if err := Mkdir(dstPath, mode, owner, group); err != nil {
+		return "", err
+	}
+	if fi == nil {
+		return Created, nil
+	}
+	return Updated, nil
+}
+
+// syncFile ensures that file 'dstPath' has 'contents', 'mode', 'owner' and 'group'.
+// It returns the change done, if any.
+func syncFile(dstPath, contents string, mode os.FileMode, owner, group string) (ChangeOp, error) {
+	fi, err := os.Stat(Path(dstPath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if err == nil {
+		if fi.IsDir() {
+			return "", fmt.Errorf("%s: exists and is a directory", dstPath)
+		}
+		have, err := os.ReadFile(Path(dstPath))
+		if err != nil {
+			return "", err
+		}
+		same, err := sameAttributes(dstPath, fi, mode, owner, group)
+		if err != nil {
+			return "", err
+		}
+		if same && bytes.Equal(have, []byte(contents)) {
+			return "", nil
+		}
+	}
+	if err := WriteFile(dstPath, contents, mode, owner, group); err != nil {
+		return "", err
+	}
+	if fi == nil {
+		return Created, nil
+	}
+	return Updated, nil
+}
+
+// sameAttributes returns true if 'fi', the FileInfo of 'fpath', has 'mode', 'owner'
+// and 'group'.
+func sameAttributes(fpath string, fi fs.FileInfo, mode os.FileMode, owner, group string) (bool, error) {
+	if fi.Mode().Perm() != mode.Perm() {
+		return false, nil
+	}
+	if Hermetic() {
+		own, _ := OwnerOf(fpath)
+		return own == Ownership{Owner: owner, Group: group}, nil
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, nil
+	}
+	theUser, err := user.Lookup(owner)
+	if err != nil {
+		return false, err
+	}
+	theGroup, err := user.LookupGroup(group)
+	if err != nil {
+		return false, err
+	}
+	return strconv.Itoa(int(st.Uid)) == theUser.Uid &&
+		strconv.Itoa(int(st.Gid)) == theGroup.Gid, nil
+}
+
+// pruneDir deletes the files and directories below 'dstDir' whose relative path is
+// not in 'managed'.
+func pruneDir(dstDir string, managed map[string]bool) ([]Change, error) {
+	var changes []Change
+	walkFn := func(dstPath string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(Path(dstDir), dstPath)
+		if err != nil {
+			return err
+		}
+		if managed[filepath.ToSlash(rel)] {
+			return nil
+		}
+		if err := os.RemoveAll(dstPath); err != nil {
+			return err
+		}
+		changes = append(changes, Change{Path: unmapPath(dstPath), Op: Deleted})
+		if de.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	}
+	err := filepath.WalkDir(Path(dstDir), walkFn)
+	return changes, unmapErr(err)
+}
@@ -0,0 +1,110 @@
+package florist_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/rosina/assert"
+)
+
+func TestSyncDir(t *testing.T) {
+	owner, group := whoami(t)
+	dstDir := filepath.Join(t.TempDir(), "consul-template")
+	fsys := fstest.MapFS{
+		"embedded/config/base.hcl":           {Data: []byte("log_level = \"info\"\n")},
+		"embedded/config/vault.hcl.tmpl":     {Data: []byte("address = \"{{.Address}}\"\n")},
+		"embedded/templates/secret.ctmpl":    {Data: []byte("{{ with secret }}\n")},
+		"embedded/unrelated/ignored-file.md": {Data: []byte("ignored")},
+	}
+	opts := &florist.SyncDirOpts{
+		Data:  struct{ Address string }{Address: "https://vault:8200"},
+		Owner: owner,
+		Group: group,
+		Rules: []florist.SyncRule{
+			{Pattern: "templates/*", Mode: 0o600},
+			{Pattern: "templates", Mode: 0o700},
+		},
+		Prune: true,
+	}
+
+	sync := func(t *testing.T) []florist.Change {
+		changes, err := florist.SyncDir(fsys, "embedded", dstDir, opts)
+		assert.NoError(t, err, "SyncDir")
+		return changes
+	}
+
+	t.Run("first sync creates everything", func(t *testing.T) {
+		changes := sync(t)
+		assert.Equal(t, len(changes), 8, "number of changes")
+		assert.FileEqualsString(t, filepath.Join(dstDir, "config/vault.hcl"),
+			"address = \"https://vault:8200\"\n")
+
+		fi, err := os.Stat(filepath.Join(dstDir, "templates/secret.ctmpl"))
+		assert.NoError(t, err, "os.Stat file")
+		assert.Equal(t, fi.Mode().Perm(), os.FileMode(0o600), "file mode from rule")
+		fi, err = os.Stat(filepath.Join(dstDir, "templates"))
+		assert.NoError(t, err, "os.Stat dir")
+		assert.Equal(t, fi.Mode().Perm(), os.FileMode(0o700), "dir mode from rule")
+	})
+
+	t.Run("second sync changes nothing", func(t *testing.T) {
+		changes := sync(t)
+		assert.DeepEqual(t, changes, []florist.Change(nil), "changes")
+	})
+
+	t.Run("sync restores modified files and prunes unmanaged ones", func(t *testing.T) {
+		modified := filepath.Join(dstDir, "config/base.hcl")
+		err := os.WriteFile(modified, []byte("modified"), 0o644)
+		assert.NoError(t, err, "os.WriteFile modified")
+		unmanagedDir := filepath.Join(dstDir, "old")
+		err = os.Mkdir(unmanagedDir, 0o755)
+		assert.NoError(t, err, "os.Mkdir unmanaged")
+		err = os.WriteFile(filepath.Join(unmanagedDir, "old.hcl"), nil, 0o644)
+		assert.NoError(t, err, "os.WriteFile unmanaged")
+
+		changes := sync(t)
+		want := []florist.Change{
+			{Path: modified, Op: florist.Updated},
+			{Path: unmanagedDir, Op: florist.Deleted},
+		}
+		assert.DeepEqual(t, changes, want, "changes")
+		assert.FileEqualsString(t, modified, "log_level = \"info\"\n")
+	})
+}
+
+func TestSyncDirFailure(t *testing.T) {
+	fsys := fstest.MapFS{"src/a.tmpl": {Data: []byte("{{.Missing}}")}}
+
+	_, err := florist.SyncDir(fsys, "src", t.TempDir(), nil)
+	assert.ErrorContains(t, err, "SyncDir: missing owner or group", "SyncDir nil opts")
+
+	owner, group := whoami(t)
+	_, err = florist.SyncDir(fsys, "src", t.TempDir(),
+		&florist.SyncDirOpts{Owner: owner, Group: group, Data: struct{}{}})
+	assert.ErrorContains(t, err, `can't evaluate field Missing`, "SyncDir template")
+
+	fsys = fstest.MapFS{
+		"src/motd":      {Data: []byte("hello")},
+		"src/motd.tmpl": {Data: []byte("hello {{.}}")},
+	}
+	_, err = florist.SyncDir(fsys, "src", t.TempDir(),
+		&florist.SyncDirOpts{Owner: owner, Group: group})
+	assert.ErrorContains(t, err,
+		"SyncDir: src/motd and src/motd.tmpl have the same destination motd",
+		"SyncDir collision")
+}
+
+func TestSyncDirDoesNotModifyOpts(t *testing.T) {
+	fsys := fstest.MapFS{"src/a": {Data: []byte("a")}}
+	owner, group := whoami(t)
+	opts := florist.SyncDirOpts{Owner: owner, Group: group}
+	want := opts
+
+	_, err := florist.SyncDir(fsys, "src", t.TempDir(), &opts)
+
+	assert.NoError(t, err, "florist.SyncDir")
+	assert.DeepEqual(t, opts, want, "opts")
+}
@@ -0,0 +1,94 @@
+package flowertest
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// This file contains fixtures to build the artifacts served by the fake HTTP server
+// (see [Harness.Serve]): archives and signing keys.
+
+// MakeTar returns a tar archive containing files (name -> contents).
+func MakeTar(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		contents := files[name]
+		if err := tw.WriteHeader(&tar.Header{
+			Name: name, Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatalf("flowertest.MakeTar: %s", err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatalf("flowertest.MakeTar: %s", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("flowertest.MakeTar: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// MakeTarGz returns a tar.gz archive containing files (name -> contents).
+func MakeTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	if _, err := gzw.Write(MakeTar(t, files)); err != nil {
+		t.Fatalf("flowertest.MakeTarGz: %s", err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatalf("flowertest.MakeTarGz: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// MakeZip returns a ZIP archive containing files (name -> contents).
+func MakeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("flowertest.MakeZip: %s", err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatalf("flowertest.MakeZip: %s", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("flowertest.MakeZip: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// NewOpenPGPKey returns a new OpenPGP key and its armored public key.
+func NewOpenPGPKey(t *testing.T) (*openpgp.Entity, string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Florist Test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("flowertest.NewOpenPGPKey: %s", err)
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("flowertest.NewOpenPGPKey: %s", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("flowertest.NewOpenPGPKey: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("flowertest.NewOpenPGPKey: %s", err)
+	}
+	return entity, buf.String()
+}
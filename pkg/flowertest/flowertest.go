@@ -0,0 +1,361 @@
+// Package flowertest is a test harness for flower authors. It allows to run
+// Init, Install and Configure of a flower in an ordinary "go test", on the
+// development host and without privileges:
+//
+//   - the file operations happen below a temporary directory (see florist.SetRoot);
+//   - the external commands are recorded by a florist.FakeRunner instead of being
+//     executed;
+//   - the downloads done with florist.NetFetch are served by a fake HTTP server.
+//
+// Usage:
+//
+//	func TestFooConfigure(t *testing.T) {
+//	    h := flowertest.New(t)
+//	    fl := &foo.Flower{...}
+//	    assert.NoError(t, h.Configure(fl), "Configure")
+//
+//	    h.AssertFileContains("/etc/foo/foo.conf", "port = 1234")
+//	    h.AssertOwner("/etc/foo/foo.conf", "foo", "foo")
+//	    h.AssertServiceNotified("restart", "foo")
+//	    h.AssertIdempotent(fl.Configure)
+//	}
+//
+// The harness changes global state of package florist; tests using it must not run
+// in parallel.
+package flowertest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+// Skeleton is the list of the directories created by [New] below the root.
+var Skeleton = []string{
+	"/etc",
+	"/opt",
+	"/usr/local/bin",
+	"/var/lib",
+	florist.WorkDir,
+	florist.HomeDir,
+}
+
+// Harness is the test harness. Create it with [New].
+type Harness struct {
+	// Root is the real directory acting as the filesystem root.
+	Root string
+	// Runner records the commands run by the flower. Use it to set canned responses
+	// with [florist.FakeRunner.On].
+	Runner *florist.FakeRunner
+
+	t      testing.TB
+	server *httptest.Server
+	mu     sync.Mutex
+	files  map[string][]byte // URL -> contents
+	gets   []string          // URLs requested
+}
+
+// New returns a Harness with a root containing the skeleton of the directories that
+// the flowers expect to exist (see [Skeleton]). It restores the previous state of
+// package florist at the end of the test.
+func New(t testing.TB) *Harness {
+	t.Helper()
+	h := &Harness{
+		Root:   t.TempDir(),
+		Runner: florist.NewFakeRunner(),
+		t:      t,
+		files:  make(map[string][]byte),
+	}
+
+	if err := florist.SetRoot(h.Root); err != nil {
+		t.Fatalf("flowertest.New: %s", err)
+	}
+	prevRunner := florist.SetRunner(h.Runner)
+	h.server = httptest.NewServer(http.HandlerFunc(h.serve))
+	prevTransport := florist.SetNetTransport(redirector{h.server})
+	prevLog := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(testWriter{t},
+		&slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	t.Cleanup(func() {
+		slog.SetDefault(prevLog)
+		florist.SetNetTransport(prevTransport)
+		h.server.Close()
+		florist.SetRunner(prevRunner)
+		if err := florist.SetRoot("/"); err != nil {
+			t.Errorf("flowertest: restoring root: %s", err)
+		}
+	})
+
+	h.MkdirAll(Skeleton...)
+	return h
+}
+
+// Install calls fl.Init and fl.Install, as the install subcommand of the provisioner
+// does. It also forgets the commands run so far.
+func (h *Harness) Install(fl florist.Flower) error {
+	h.Runner.Reset()
+	if err := fl.Init(); err != nil {
+		return fmt.Errorf("flowertest: init: %w", err)
+	}
+	if err := fl.Install(); err != nil {
+		return fmt.Errorf("flowertest: install: %w", err)
+	}
+	return nil
+}
+
+// Configure calls fl.Init and fl.Configure, as the configure subcommand of the
+// provisioner does. It also forgets the commands run so far.
+func (h *Harness) Configure(fl florist.Flower) error {
+	h.Runner.Reset()
+	if err := fl.Init(); err != nil {
+		return fmt.Errorf("flowertest: init: %w", err)
+	}
+	if err := fl.Configure(); err != nil {
+		return fmt.Errorf("flowertest: configure: %w", err)
+	}
+	return nil
+}
+
+// Path returns the real path of 'fpath', below [Harness.Root].
+func (h *Harness) Path(fpath string) string {
+	return florist.Path(fpath)
+}
+
+// MkdirAll creates directories 'dirs' below the root, to prepare the state expected
+// by the flower (for example "/etc/ssh").
+func (h *Harness) MkdirAll(dirs ...string) {
+	h.t.Helper()
+	for _, dir := range dirs {
+		if err := florist.MkdirAll(dir, 0o755); err != nil {
+			h.t.Fatalf("flowertest.MkdirAll: %s", err)
+		}
+	}
+}
+
+// WriteFile writes file 'fpath' below the root, creating the parent directories, to
+// prepare the state expected by the flower.
+func (h *Harness) WriteFile(fpath string, contents string) {
+	h.t.Helper()
+	h.MkdirAll(filepath.Dir(fpath))
+	if err := os.WriteFile(h.Path(fpath), []byte(contents), 0o644); err != nil {
+		h.t.Fatalf("flowertest.WriteFile: %s", err)
+	}
+}
+
+// Serve makes the fake HTTP server return 'contents' for 'url', and returns the
+// hex-encoded SHA-256 of 'contents', to be used as the hash passed to
+// florist.NetFetch.
+func (h *Harness) Serve(url string, contents []byte) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.files[url] = contents
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// Requests returns the URLs requested to the fake HTTP server, in order.
+func (h *Harness) Requests() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.gets)
+}
+
+//
+// Assertions. They report a test error but do not stop the test.
+//
+
+// AssertFile asserts that file 'fpath' has 'contents'.
+func (h *Harness) AssertFile(fpath string, contents string) {
+	h.t.Helper()
+	buf, err := os.ReadFile(h.Path(fpath))
+	if err != nil {
+		h.t.Errorf("AssertFile: %s", err)
+		return
+	}
+	if string(buf) != contents {
+		h.t.Errorf("AssertFile %s:\nhave: %q\nwant: %q", fpath, buf, contents)
+	}
+}
+
+// AssertFileContains asserts that file 'fpath' contains 'substr'.
+func (h *Harness) AssertFileContains(fpath string, substr string) {
+	h.t.Helper()
+	buf, err := os.ReadFile(h.Path(fpath))
+	if err != nil {
+		h.t.Errorf("AssertFileContains: %s", err)
+		return
+	}
+	if !strings.Contains(string(buf), substr) {
+		h.t.Errorf("AssertFileContains %s:\nfile:\n%s\ndoes not contain: %q",
+			fpath, buf, substr)
+	}
+}
+
+// AssertNoFile asserts that 'fpath' does not exist.
+func (h *Harness) AssertNoFile(fpath string) {
+	h.t.Helper()
+	_, err := os.Lstat(h.Path(fpath))
+	if err == nil {
+		h.t.Errorf("AssertNoFile %s: exists", fpath)
+		return
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		h.t.Errorf("AssertNoFile: %s", err)
+	}
+}
+
+// AssertMode asserts that 'fpath' has permissions 'mode'.
+func (h *Harness) AssertMode(fpath string, mode os.FileMode) {
+	h.t.Helper()
+	fi, err := os.Stat(h.Path(fpath))
+	if err != nil {
+		h.t.Errorf("AssertMode: %s", err)
+		return
+	}
+	if have := fi.Mode().Perm(); have != mode.Perm() {
+		h.t.Errorf("AssertMode %s: have: %v; want: %v", fpath, have, mode.Perm())
+	}
+}
+
+// AssertOwner asserts that 'fpath' has been assigned 'owner' and 'group'.
+func (h *Harness) AssertOwner(fpath string, owner string, group string) {
+	h.t.Helper()
+	have, found := florist.OwnerOf(fpath)
+	if !found {
+		h.t.Errorf("AssertOwner %s: no ownership set", fpath)
+		return
+	}
+	want := florist.Ownership{Owner: owner, Group: group}
+	if have != want {
+		h.t.Errorf("AssertOwner %s: have: %+v; want: %+v", fpath, have, want)
+	}
+}
+
+// AssertSymlink asserts that 'linkname' is a symbolic link to 'target'.
+func (h *Harness) AssertSymlink(linkname string, target string) {
+	h.t.Helper()
+	have, err := os.Readlink(h.Path(linkname))
+	if err != nil {
+		h.t.Errorf("AssertSymlink: %s", err)
+		return
+	}
+	if have != target {
+		h.t.Errorf("AssertSymlink %s: have target: %s; want: %s", linkname, have, target)
+	}
+}
+
+// AssertCommands asserts that the commands run so far are exactly 'want', in order.
+// Each command is the command line with the arguments joined by a space.
+func (h *Harness) AssertCommands(want ...string) {
+	h.t.Helper()
+	have := h.Runner.Calls()
+	if !slices.Equal(have, want) {
+		h.t.Errorf("AssertCommands:\nhave:\n%s\nwant:\n%s",
+			strings.Join(have, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// AssertCommandRun asserts that command line 'cmdline' has been run.
+func (h *Harness) AssertCommandRun(cmdline string) {
+	h.t.Helper()
+	if !slices.Contains(h.Runner.Calls(), cmdline) {
+		h.t.Errorf("AssertCommandRun: %q not run; commands run:\n%s",
+			cmdline, h.Runner)
+	}
+}
+
+// AssertServiceNotified asserts that systemd unit 'unit' has been subjected to
+// 'action' ("start", "restart", "reload", "enable", ...), via package systemd.
+func (h *Harness) AssertServiceNotified(action string, unit string) {
+	h.t.Helper()
+	cmdline := fmt.Sprintf("systemctl %s %s", action, unit)
+	if !slices.Contains(h.Runner.Calls(), cmdline) {
+		h.t.Errorf("AssertServiceNotified: %q not run; commands run:\n%s",
+			cmdline, h.Runner)
+	}
+}
+
+// AssertIdempotent calls 'run' (for example, the Configure method of a flower that has
+// already been run once) and asserts that it does not change the host state: the
+// files below the root (contents, mode, symlink target and ownership) and the
+// packages and units, as reported by the canned responses of [Harness.Runner].
+// This is the equivalent of the --verify-idempotent flag of the provisioner.
+func (h *Harness) AssertIdempotent(run func() error) {
+	h.t.Helper()
+	snapshotter := florist.NewSnapshotter("/")
+	// Do not mix the queries of the snapshots with the calls of the flower.
+	snapshotter.Runner = h.Runner.Silent()
+	before, err := snapshotter.Take()
+	if err != nil {
+		h.t.Fatalf("AssertIdempotent: %s", err)
+	}
+	if err := run(); err != nil {
+		h.t.Errorf("AssertIdempotent: second run: %s", err)
+		return
+	}
+	after, err := snapshotter.Take()
+	if err != nil {
+		h.t.Fatalf("AssertIdempotent: %s", err)
+	}
+	if diffs := before.Diff(after); len(diffs) > 0 {
+		h.t.Errorf("AssertIdempotent: second run changed the host state:\n%s",
+			strings.Join(diffs, "\n"))
+	}
+}
+
+// urlHeader carries the original URL from redirector to the fake server.
+const urlHeader = "X-Flowertest-Url"
+
+func (h *Harness) serve(w http.ResponseWriter, r *http.Request) {
+	url := r.Header.Get(urlHeader)
+	h.mu.Lock()
+	h.gets = append(h.gets, url)
+	contents, found := h.files[url]
+	h.mu.Unlock()
+	if !found {
+		http.Error(w, "flowertest: not served: "+url, http.StatusNotFound)
+		return
+	}
+	// ServeContent supports Range requests, used by the resumed downloads.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(contents))
+}
+
+// redirector is an http.RoundTripper that sends all the requests to the fake server.
+type redirector struct {
+	server *httptest.Server
+}
+
+func (rd redirector) RoundTrip(req *http.Request) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	clone.Header.Set(urlHeader, req.URL.String())
+	clone.URL.Scheme = "http"
+	clone.URL.Host = rd.server.Listener.Addr().String()
+	return rd.server.Client().Transport.RoundTrip(clone)
+}
+
+// testWriter sends the log output of the flower to the test log.
+type testWriter struct {
+	t testing.TB
+}
+
+func (tw testWriter) Write(p []byte) (int, error) {
+	tw.t.Helper()
+	tw.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
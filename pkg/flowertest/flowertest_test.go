@@ -0,0 +1,100 @@
+package flowertest_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/flowertest"
+	"github.com/marco-m/florist/pkg/systemd"
+)
+
+const exeURL = "https://example.com/releases/peony_1.0.0_linux_amd64"
+
+// peony is a minimal flower, exercising the features of the harness.
+type peony struct {
+	Hash string
+	Port int
+}
+
+var _ florist.Flower = (*peony)(nil)
+
+func (fl *peony) String() string      { return "peony" }
+func (fl *peony) Description() string { return "a test flower" }
+func (fl *peony) Embedded() []string  { return nil }
+
+func (fl *peony) Init() error {
+	if fl.Port == 0 {
+		fl.Port = 8080
+	}
+	return nil
+}
+
+func (fl *peony) Install() error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	exePath, err := florist.NetFetch(client, exeURL, florist.SHA256, fl.Hash,
+		florist.WorkDir)
+	if err != nil {
+		return err
+	}
+	return florist.CopyFile(exePath, "/usr/local/bin/peony", 0o755, "root")
+}
+
+func (fl *peony) Configure() error {
+	if err := florist.Mkdir("/etc/peony", 0o750, "root", "peony"); err != nil {
+		return err
+	}
+	conf := fmt.Sprintf("port = %d\n", fl.Port)
+	if err := florist.WriteFile("/etc/peony/peony.conf", conf, 0o640,
+		"root", "peony"); err != nil {
+		return err
+	}
+	return systemd.Restart("peony")
+}
+
+func TestHarnessInstall(t *testing.T) {
+	h := flowertest.New(t)
+	fl := &peony{Hash: h.Serve(exeURL, []byte("#!/bin/sh\n"))}
+
+	err := h.Install(fl)
+	assert.NoError(t, err, "h.Install")
+
+	assert.DeepEqual(t, h.Requests(), []string{exeURL}, "requests")
+	h.AssertFile("/usr/local/bin/peony", "#!/bin/sh\n")
+	h.AssertMode("/usr/local/bin/peony", 0o755)
+	h.AssertOwner("/usr/local/bin/peony", "root", "root")
+	h.AssertCommands()
+}
+
+func TestHarnessInstallHashMismatch(t *testing.T) {
+	h := flowertest.New(t)
+	h.Serve(exeURL, []byte("tampered"))
+	fl := &peony{Hash: "0123"}
+
+	err := h.Install(fl)
+	assert.ErrorContains(t, err, "flowertest: install: NetFetch: hash mismatch",
+		"h.Install")
+}
+
+func TestHarnessConfigure(t *testing.T) {
+	h := flowertest.New(t)
+	fl := &peony{Port: 1234}
+
+	err := h.Configure(fl)
+	assert.NoError(t, err, "h.Configure")
+
+	h.AssertFile("/etc/peony/peony.conf", "port = 1234\n")
+	h.AssertMode("/etc/peony/peony.conf", 0o640)
+	h.AssertOwner("/etc/peony/peony.conf", "root", "peony")
+	h.AssertOwner("/etc/peony", "root", "peony")
+	h.AssertNoFile("/usr/local/bin/peony")
+	h.AssertServiceNotified("restart", "peony")
+	h.AssertCommands("systemctl restart peony")
+	h.AssertIdempotent(fl.Configure)
+	// Only the calls of the second Configure, not the ones of the snapshots.
+	h.AssertCommands("systemctl restart peony", "systemctl restart peony")
+}
@@ -0,0 +1,191 @@
+package flowertest
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/marco-m/florist/internal"
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+// sandboxBinDir is where [Sandbox.Run] copies the binary, below the root filesystem.
+const sandboxBinDir = "/.florist-sandbox"
+
+// Sandbox runs a provisioner binary chrooted into a throwaway root filesystem, as
+// root of an unprivileged Linux user namespace (plus a mount and a UTS namespace).
+// This allows to run the flower integration tests on a plain Linux CI worker,
+// without a disposable VM and without privileges.
+//
+// The binary sees RootFS as "/" and itself as uid 0, mapped to the uid of the test
+// process; it cannot change the ownership of a file to another user. The binary
+// should be statically linked (CGO_ENABLED=0), unless RootFS contains the needed
+// libraries. The external commands that the flowers run (apt-get, systemctl, ...)
+// must be present in RootFS, so in practice a sandbox built from a skeleton (see
+// [NewSandbox]) is suitable only for flowers that handle files.
+type Sandbox struct {
+	// RootFS is the directory seen as "/" by the binary.
+	RootFS string
+	// Env is the environment of the binary. Default: PATH and HOME.
+	Env []string
+
+	t testing.TB
+}
+
+// SandboxResult is the outcome of [Sandbox.Run].
+type SandboxResult struct {
+	// Stdout and Stderr of the binary.
+	Stdout, Stderr string
+	// Changes are the changes done by the binary to the root filesystem, in the
+	// format of florist.Snapshot.Diff, with paths relative to the sandbox root.
+	Changes []string
+}
+
+// NewSandbox returns a Sandbox whose root filesystem is a copy of directory 'srcRoot'
+// (for example, a root filesystem prepared with debootstrap or exported from a
+// container image), so that the test can modify it. If 'srcRoot' is empty, the root
+// filesystem is a minimal skeleton, containing the directories of [Skeleton] and
+// /etc/passwd and /etc/group with the root user and group.
+//
+// NewSandbox skips the test if the user namespaces are not available.
+func NewSandbox(t testing.TB, srcRoot string) *Sandbox {
+	t.Helper()
+	SkipIfNoUserNamespaces(t)
+
+	sb := &Sandbox{
+		RootFS: t.TempDir(),
+		Env:    []string{"PATH=/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin", "HOME=/root"},
+		t:      t,
+	}
+	if srcRoot != "" {
+		// The cp tool preserves symlinks, hard links and special files better than a
+		// Go implementation would do.
+		cmd := exec.Command("cp", "--archive", "--no-target-directory", srcRoot, sb.RootFS)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("flowertest.NewSandbox: copying %s: %s: %s", srcRoot, err, out)
+		}
+		return sb
+	}
+
+	for _, dir := range append([]string{"/root", "/tmp"}, Skeleton...) {
+		if err := os.MkdirAll(filepath.Join(sb.RootFS, dir), 0o755); err != nil {
+			t.Fatalf("flowertest.NewSandbox: %s", err)
+		}
+	}
+	files := map[string]string{
+		"/etc/passwd": "root:x:0:0:root:/root:/bin/sh\n",
+		"/etc/group":  "root:x:0:\n",
+	}
+	for fname, contents := range files {
+		err := os.WriteFile(filepath.Join(sb.RootFS, fname), []byte(contents), 0o644)
+		if err != nil {
+			t.Fatalf("flowertest.NewSandbox: %s", err)
+		}
+	}
+	return sb
+}
+
+// Run copies 'binary' into the sandbox and runs it with 'args', returning its output
+// and the changes it did to the root filesystem. For example:
+//
+//	res, err := sb.Run(provisionerExe, "configure", "--settings=/opt/florist/config.json")
+//
+// In case of error, the returned SandboxResult is still valid.
+func (sb *Sandbox) Run(binary string, args ...string) (*SandboxResult, error) {
+	errorf := internal.MakeErrorf("Sandbox.Run")
+	res := &SandboxResult{}
+
+	binDir := filepath.Join(sb.RootFS, sandboxBinDir)
+	if err := os.MkdirAll(binDir, 0o755); err != nil {
+		return res, errorf("%s", err)
+	}
+	exe := filepath.Join(sandboxBinDir, filepath.Base(binary))
+	buf, err := os.ReadFile(binary)
+	if err != nil {
+		return res, errorf("%s", err)
+	}
+	if err := os.WriteFile(filepath.Join(sb.RootFS, exe), buf, 0o755); err != nil {
+		return res, errorf("%s", err)
+	}
+
+	snapshotter := florist.NewSnapshotter(sb.RootFS)
+	snapshotter.FilesOnly = true
+	before, err := snapshotter.Take()
+	if err != nil {
+		return res, errorf("%s", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exe, args...)
+	cmd.Path = exe // Do not look up exe in the PATH of the host.
+	cmd.Dir = "/"
+	cmd.Env = sb.Env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Chroot:     sb.RootFS,
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+		GidMappingsEnableSetgroups: false,
+	}
+	errRun := cmd.Run()
+	res.Stdout = stdout.String()
+	res.Stderr = stderr.String()
+
+	after, err := snapshotter.Take()
+	if err != nil {
+		return res, errorf("%s", err)
+	}
+	for _, change := range before.Diff(after) {
+		change = strings.Replace(change, sb.RootFS, "", 1)
+		if strings.Contains(change, " "+sandboxBinDir) {
+			continue
+		}
+		res.Changes = append(res.Changes, change)
+	}
+
+	if errRun != nil {
+		return res, errorf("%s: %s", errRun, strings.TrimSpace(res.Stderr))
+	}
+	return res, nil
+}
+
+// Path returns the real path of 'fpath', as seen by the binary run in the sandbox.
+func (sb *Sandbox) Path(fpath string) string {
+	return filepath.Join(sb.RootFS, fpath)
+}
+
+// SkipIfNoUserNamespaces skips the test if the unprivileged user namespaces are not
+// available (for example, disabled by sysctl or by a container runtime).
+func SkipIfNoUserNamespaces(t testing.TB) {
+	t.Helper()
+	if _, err := os.Stat("/proc/self/ns/user"); errors.Is(err, fs.ErrNotExist) {
+		t.Skip("skip: user namespaces not supported by the kernel")
+	}
+	cmd := exec.Command("true")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+		UidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getuid(), Size: 1},
+		},
+		GidMappings: []syscall.SysProcIDMap{
+			{ContainerID: 0, HostID: os.Getgid(), Size: 1},
+		},
+	}
+	// We only care if the process can be created, not about its exit status.
+	if err := cmd.Start(); err != nil {
+		t.Skipf("skip: cannot create user namespace: %s", err)
+	}
+	_ = cmd.Wait()
+}
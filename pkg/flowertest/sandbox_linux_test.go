@@ -0,0 +1,56 @@
+package flowertest_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/flowertest"
+)
+
+// buildSandboxed builds a static binary from testdata/sandboxed.
+func buildSandboxed(t *testing.T) string {
+	t.Helper()
+	goExe, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("skip: go tool not found")
+	}
+	exe := filepath.Join(t.TempDir(), "sandboxed")
+	cmd := exec.Command(goExe, "build", "-o", exe, "./testdata/sandboxed")
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, "go build: "+string(out))
+	return exe
+}
+
+func TestSandboxRun(t *testing.T) {
+	sb := flowertest.NewSandbox(t, "")
+	exe := buildSandboxed(t)
+	err := os.WriteFile(sb.Path("/etc/obsolete"), nil, 0o644)
+	assert.NoError(t, err, "os.WriteFile")
+
+	res, err := sb.Run(exe)
+	assert.NoError(t, err, "sb.Run")
+
+	assert.Equal(t, res.Stdout, "configured\n", "stdout")
+	assert.FileEqualsString(t, sb.Path("/etc/peony/peony.conf"), "port = 1234\n")
+	want := []string{
+		"created /etc/peony",
+		"created /etc/peony/peony.conf",
+		"deleted /etc/obsolete",
+	}
+	assert.DeepEqual(t, res.Changes, want, "changes")
+}
+
+func TestSandboxRunFailure(t *testing.T) {
+	sb := flowertest.NewSandbox(t, "")
+	exe := buildSandboxed(t)
+
+	res, err := sb.Run(exe, "fail")
+	assert.ErrorContains(t, err,
+		"Sandbox.Run: exit status 1: sandboxed: failing as requested", "sb.Run")
+	assert.DeepEqual(t, res.Changes, []string(nil), "changes")
+}
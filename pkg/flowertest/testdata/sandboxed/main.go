@@ -0,0 +1,34 @@
+// Command sandboxed is run by the tests of flowertest.Sandbox.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "sandboxed:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if len(os.Args) > 1 && os.Args[1] == "fail" {
+		return fmt.Errorf("failing as requested")
+	}
+	if err := florist.Mkdir("/etc/peony", 0o750, "root", "root"); err != nil {
+		return err
+	}
+	if err := florist.WriteFile("/etc/peony/peony.conf", "port = 1234\n", 0o640,
+		"root", "root"); err != nil {
+		return err
+	}
+	if err := os.Remove("/etc/obsolete"); err != nil {
+		return err
+	}
+	fmt.Println("configured")
+	return nil
+}
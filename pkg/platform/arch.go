@@ -0,0 +1,86 @@
+package platform
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Arch is the architecture of a machine, named as GOARCH: "amd64", "arm64".
+// This is also the name used by Debian and by the release assets of most projects
+// (HashiCorp, Go, Tailscale, GoReleaser). See [Arch.Uname] for the other common
+// naming scheme.
+type Arch string
+
+const (
+	AMD64 Arch = "amd64"
+	ARM64 Arch = "arm64"
+)
+
+var unameNames = map[Arch]string{
+	AMD64: "x86_64",
+	ARM64: "aarch64",
+}
+
+var (
+	archMu sync.Mutex
+	arch   = Arch(runtime.GOARCH)
+)
+
+// MachineArch returns the architecture of the machine. Since the provisioner is a
+// native executable, this is the GOARCH it has been built for, unless changed by
+// [SetArch].
+func MachineArch() Arch {
+	archMu.Lock()
+	defer archMu.Unlock()
+	return arch
+}
+
+// SetArch makes [MachineArch] return a, returning the previous value. Use it to
+// download the artifacts of another architecture (fetch-artifacts --arch) and in
+// tests.
+func SetArch(a Arch) Arch {
+	archMu.Lock()
+	defer archMu.Unlock()
+	prev := arch
+	arch = a
+	return prev
+}
+
+// ParseArch returns the Arch named s, in either naming scheme: "amd64" or "x86_64",
+// "arm64" or "aarch64".
+func ParseArch(s string) (Arch, error) {
+	for a, uname := range unameNames {
+		if s == string(a) || s == uname {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("platform.ParseArch: unknown architecture %q", s)
+}
+
+func (a Arch) String() string {
+	return string(a)
+}
+
+// Uname returns the name of a as printed by "uname -m" and used also by RPM, Rust
+// and some release assets: "x86_64", "aarch64". If unknown, it returns a.
+func (a Arch) Uname() string {
+	if name, ok := unameNames[a]; ok {
+		return name
+	}
+	return string(a)
+}
+
+// HashFor returns the hash of an artifact for the machine architecture: the value
+// of hashes for [MachineArch] or, if hashes is empty, hash. This allows flowers to
+// accept both a single Hash and per-architecture Hashes.
+func HashFor(hashes map[string]string, hash string) (string, error) {
+	if len(hashes) == 0 {
+		return hash, nil
+	}
+	a := MachineArch()
+	if h, ok := hashes[string(a)]; ok {
+		return h, nil
+	}
+	return "", fmt.Errorf("no hash for architecture %s", a)
+}
@@ -0,0 +1,80 @@
+package platform_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/platform"
+)
+
+func TestParseArch(t *testing.T) {
+	for _, name := range []string{"amd64", "x86_64"} {
+		arch, err := platform.ParseArch(name)
+		assert.NoError(t, err, "platform.ParseArch")
+		assert.Equal(t, arch, platform.AMD64, name)
+		assert.Equal(t, arch.Uname(), "x86_64", "arch.Uname")
+	}
+	for _, name := range []string{"arm64", "aarch64"} {
+		arch, err := platform.ParseArch(name)
+		assert.NoError(t, err, "platform.ParseArch")
+		assert.Equal(t, arch, platform.ARM64, name)
+		assert.Equal(t, arch.Uname(), "aarch64", "arch.Uname")
+	}
+
+	_, err := platform.ParseArch("riscv64")
+	assert.ErrorContains(t, err, `platform.ParseArch: unknown architecture "riscv64"`,
+		"platform.ParseArch")
+}
+
+func TestHashFor(t *testing.T) {
+	type testCase struct {
+		name    string
+		arch    platform.Arch
+		hashes  map[string]string
+		hash    string
+		want    string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		prev := platform.SetArch(tc.arch)
+		defer platform.SetArch(prev)
+
+		have, err := platform.HashFor(tc.hashes, tc.hash)
+
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr, "platform.HashFor")
+			return
+		}
+		assert.NoError(t, err, "platform.HashFor")
+		assert.Equal(t, have, tc.want, "hash")
+	}
+
+	hashes := map[string]string{"amd64": "aaaa", "arm64": "bbbb"}
+	testCases := []testCase{
+		{
+			name: "only hash",
+			arch: platform.ARM64,
+			hash: "cccc",
+			want: "cccc",
+		},
+		{
+			name:   "hashes replace hash",
+			arch:   platform.ARM64,
+			hashes: hashes,
+			hash:   "cccc",
+			want:   "bbbb",
+		},
+		{
+			name:    "architecture missing from hashes",
+			arch:    "riscv64",
+			hashes:  hashes,
+			wantErr: "no hash for architecture riscv64",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
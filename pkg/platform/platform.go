@@ -12,9 +12,17 @@ type Info struct {
 	Id string
 
 	Codename string
+
+	// See [MachineArch].
+	Arch Arch
 }
 
 // CollectInfo returns information about the current platform.
 func CollectInfo() (Info, error) {
-	return collectInfo()
+	info, err := collectInfo()
+	if err != nil {
+		return Info{}, err
+	}
+	info.Arch = MachineArch()
+	return info, nil
 }
@@ -2,20 +2,24 @@ package platform
 
 import (
 	"fmt"
+	"log/slog"
 	"os/exec"
 	"strings"
+
+	"github.com/marco-m/florist/pkg/florist"
 )
 
 func collectInfo() (Info, error) {
 	info := Info{}
+	log := slog.With("fn", "platform.CollectInfo")
 
-	id, err := exec.Command("lsb_release", "--id", "--short").Output()
+	id, err := florist.CmdOutput(log, exec.Command("lsb_release", "--id", "--short"))
 	if err != nil {
 		return Info{}, fmt.Errorf("CollectInfo: %s", err)
 	}
 	info.Id = strings.ToLower(strings.TrimSpace(string(id)))
 
-	codename, err := exec.Command("lsb_release", "-cs").Output()
+	codename, err := florist.CmdOutput(log, exec.Command("lsb_release", "-cs"))
 	if err != nil {
 		return Info{}, fmt.Errorf("CollectInfo: %s", err)
 	}
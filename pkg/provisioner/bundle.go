@@ -0,0 +1,307 @@
+package provisioner
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marco-m/florist/internal"
+)
+
+// A bundle is a single artifact containing the provisioner and the settings, so that
+// one artifact per environment can be uploaded to Packer or to an object storage.
+// See the bundle subcommand. It comes in two formats:
+//
+//   - exe: the provisioner executable, followed by a payload (a tar archive with the
+//     manifest and the settings) and by a trailer (payload size and magic). The
+//     configure subcommand of a bundle reads the embedded settings.
+//   - tar: a gzipped tar archive with the provisioner, the manifest and the settings.
+//
+// The settings can be encrypted with AES-256-GCM; see [EncryptSettings].
+const (
+	// BundleManifestName is the name of the manifest in a bundle.
+	BundleManifestName = "manifest.json"
+	// bundleMagic terminates an exe bundle.
+	bundleMagic = "florist-bundle-1"
+	// bundleTrailerSize is the size of the trailer: payload size plus magic.
+	bundleTrailerSize = 8 + len(bundleMagic)
+	// encryptedMagic starts encrypted settings.
+	encryptedMagic = "florist-encrypted-1\n"
+)
+
+// ErrNotBundle is returned by [ReadBundle] when the file is not an exe bundle.
+var ErrNotBundle = errors.New("not a bundle")
+
+// BundleManifest describes the contents of a bundle.
+type BundleManifest struct {
+	Created           time.Time `json:"created"`
+	Provisioner       string    `json:"provisioner"`
+	ProvisionerSHA256 string    `json:"provisioner_sha256"`
+	// Name of the settings file in the bundle.
+	Settings string `json:"settings"`
+	// SHA-256 of the settings as stored in the bundle (encrypted or not).
+	SettingsSHA256 string `json:"settings_sha256"`
+	Encrypted      bool   `json:"encrypted"`
+}
+
+// Bundle is the payload of an exe bundle, as returned by [ReadBundle].
+type Bundle struct {
+	Manifest BundleManifest
+	// The settings, encrypted if Manifest.Encrypted.
+	Settings []byte
+}
+
+// ReadBundle reads the payload of the exe bundle 'exe'. If 'exe' is not a bundle, it
+// returns ErrNotBundle.
+func ReadBundle(exe string) (*Bundle, error) {
+	errorf := internal.MakeErrorf("ReadBundle: " + exe)
+	fi, err := os.Open(exe)
+	if err != nil {
+		return nil, fmt.Errorf("ReadBundle: %w", err)
+	}
+	defer fi.Close()
+	payloadOff, payloadSize, err := bundlePayload(fi)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{}
+	var manifestFound bool
+	tr := tar.NewReader(io.NewSectionReader(fi, payloadOff, payloadSize))
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errorf("%s", err)
+		}
+		buf, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, errorf("%s", err)
+		}
+		switch hdr.Name {
+		case BundleManifestName:
+			if err := json.Unmarshal(buf, &bundle.Manifest); err != nil {
+				return nil, errorf("%s: %s", hdr.Name, err)
+			}
+			manifestFound = true
+		default:
+			bundle.Settings = buf
+		}
+	}
+	if !manifestFound {
+		return nil, errorf("missing %s", BundleManifestName)
+	}
+	if have := sha256hex(bundle.Settings); have != bundle.Manifest.SettingsSHA256 {
+		return nil, errorf("settings: hash mismatch: have: %s; want: %s", have,
+			bundle.Manifest.SettingsSHA256)
+	}
+	return bundle, nil
+}
+
+// bundlePayload returns offset and size of the payload of exe bundle 'fi', or
+// ErrNotBundle.
+func bundlePayload(fi *os.File) (int64, int64, error) {
+	st, err := fi.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ReadBundle: %w", err)
+	}
+	if st.Size() < int64(bundleTrailerSize) {
+		return 0, 0, ErrNotBundle
+	}
+	trailer := make([]byte, bundleTrailerSize)
+	if _, err := fi.ReadAt(trailer, st.Size()-int64(bundleTrailerSize)); err != nil {
+		return 0, 0, fmt.Errorf("ReadBundle: %w", err)
+	}
+	if string(trailer[8:]) != bundleMagic {
+		return 0, 0, ErrNotBundle
+	}
+	size := int64(binary.BigEndian.Uint64(trailer[:8]))
+	off := st.Size() - int64(bundleTrailerSize) - size
+	if size < 0 || off < 0 {
+		return 0, 0, fmt.Errorf("ReadBundle: %s: corrupted trailer", fi.Name())
+	}
+	return off, size, nil
+}
+
+// readExecutable returns the contents of executable 'exe', without the bundle
+// payload if 'exe' is a bundle.
+func readExecutable(exe string) ([]byte, error) {
+	fi, err := os.Open(exe)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	off, _, err := bundlePayload(fi)
+	if errors.Is(err, ErrNotBundle) {
+		return io.ReadAll(fi)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.NewSectionReader(fi, 0, off))
+}
+
+// writeBundleExe writes to 'w' the exe bundle made of 'exe', 'manifest' and
+// 'settings'.
+func writeBundleExe(w io.Writer, exe []byte, manifest BundleManifest, settings []byte) error {
+	var payload bytes.Buffer
+	tw := tar.NewWriter(&payload)
+	if err := writeBundleFiles(tw, manifest, settings); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	trailer := binary.BigEndian.AppendUint64(nil, uint64(payload.Len()))
+	trailer = append(trailer, bundleMagic...)
+	for _, buf := range [][]byte{exe, payload.Bytes(), trailer} {
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBundleTar writes to 'w' the tar bundle made of 'exe', 'manifest' and
+// 'settings'.
+func writeBundleTar(w io.Writer, exe []byte, manifest BundleManifest, settings []byte) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	hdr := &tar.Header{
+		Name:    manifest.Provisioner,
+		Mode:    0o755,
+		Size:    int64(len(exe)),
+		ModTime: manifest.Created,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(exe); err != nil {
+		return err
+	}
+	if err := writeBundleFiles(tw, manifest, settings); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeBundleFiles(tw *tar.Writer, manifest BundleManifest, settings []byte) error {
+	manifestBuf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, file := range []struct {
+		name     string
+		contents []byte
+	}{
+		{BundleManifestName, append(manifestBuf, '\n')},
+		{manifest.Settings, settings},
+	} {
+		hdr := &tar.Header{
+			Name:    file.name,
+			Mode:    0o600,
+			Size:    int64(len(file.contents)),
+			ModTime: manifest.Created,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateSettingsKey returns a new random key for [EncryptSettings], base64-encoded.
+func GenerateSettingsKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("GenerateSettingsKey: %s", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// EncryptSettings encrypts 'plaintext' with AES-256-GCM, using 'key', as returned by
+// [GenerateSettingsKey].
+func EncryptSettings(key string, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("EncryptSettings: %s", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("EncryptSettings: %s", err)
+	}
+	out := append([]byte(encryptedMagic), nonce...)
+	return aead.Seal(out, nonce, plaintext, []byte(encryptedMagic)), nil
+}
+
+// DecryptSettings decrypts 'data', as returned by [EncryptSettings]. If 'data' is not
+// encrypted, it returns it unchanged.
+func DecryptSettings(key string, data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	if key == "" {
+		return nil, fmt.Errorf("DecryptSettings: settings are encrypted, missing key")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("DecryptSettings: %s", err)
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("DecryptSettings: truncated data")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(encryptedMagic))
+	if err != nil {
+		return nil, fmt.Errorf("DecryptSettings: wrong key or corrupted data")
+	}
+	return plaintext, nil
+}
+
+// IsEncrypted returns true if 'data' has been encrypted by [EncryptSettings].
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("key: %s", err)
+	}
+	if len(rawKey) != 32 {
+		return nil, fmt.Errorf("key: invalid size: %d (want 32)", len(rawKey))
+	}
+	block, err := aes.NewCipher(rawKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sha256hex(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,196 @@
+package provisioner_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/provisioner"
+)
+
+// bundleOpts returns Options whose PreConfigureFn records the value of key "color".
+func bundleOpts(t *testing.T, color *string) *provisioner.Options {
+	return &provisioner.Options{
+		LogOutput: io.Discard,
+		RootDir:   t.TempDir(),
+		SetupFn:   func(prov *provisioner.Provisioner) error { return nil },
+		PreConfigureFn: func(prov *provisioner.Provisioner, config *provisioner.Config) (any, error) {
+			*color = config.Get("color")
+			return nil, nil
+		},
+	}
+}
+
+func writeSettings(t *testing.T, contents string) string {
+	t.Helper()
+	fpath := filepath.Join(t.TempDir(), "settings.json")
+	assert.NoError(t, os.WriteFile(fpath, []byte(contents), 0o600), "os.WriteFile")
+	return fpath
+}
+
+func TestBundleExe(t *testing.T) {
+	var color string
+	settings := writeSettings(t, `{"color": "red"}`)
+	output := filepath.Join(t.TempDir(), "prov-prod")
+
+	err := provisioner.MainErr([]string{"program", "bundle",
+		"--settings=" + settings, "--output=" + output}, bundleOpts(t, &color))
+	assert.NoError(t, err, "bundle")
+
+	bundle, err := provisioner.ReadBundle(output)
+	assert.NoError(t, err, "ReadBundle")
+	assert.Equal(t, string(bundle.Settings), `{"color": "red"}`, "settings")
+	assert.Equal(t, bundle.Manifest.Settings, "config.json", "manifest settings")
+	assert.True(t, !bundle.Manifest.Encrypted, "manifest encrypted")
+	fi, err := os.Stat(output)
+	assert.NoError(t, err, "os.Stat")
+	assert.Equal(t, fi.Mode().Perm(), os.FileMode(0o755), "mode")
+
+	exe, err := os.Executable()
+	assert.NoError(t, err, "os.Executable")
+	_, err = provisioner.ReadBundle(exe)
+	assert.True(t, errors.Is(err, provisioner.ErrNotBundle), "ReadBundle(test binary)")
+}
+
+func TestConfigureSettingsFromBundleExe(t *testing.T) {
+	var color string
+	settings := writeSettings(t, `{"color": "red"}`)
+	output := filepath.Join(t.TempDir(), "prov-prod")
+	err := provisioner.MainErr([]string{"program", "bundle",
+		"--settings=" + settings, "--output=" + output}, bundleOpts(t, &color))
+	assert.NoError(t, err, "bundle")
+
+	// Run configure from the bundle, that is the test binary plus the settings,
+	// since the settings are looked up in the running executable.
+	configure := func(args ...string) (string, error) {
+		cs := append([]string{"-test.run=^TestHelperConfigure$", "--"}, args...)
+		cmd := exec.Command(output, cs...)
+		cmd.Env = append(os.Environ(), "GO_WANT_HELPER_CONFIGURE=1")
+		out, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return string(out), fmt.Errorf("%s: %s", err, exitErr.Stderr)
+		}
+		return string(out), err
+	}
+
+	out, err := configure()
+	assert.NoError(t, err, "configure")
+	assert.Equal(t, out, "color=red", "embedded settings")
+
+	other := writeSettings(t, `{"color": "blue"}`)
+	out, err = configure("--settings=" + other)
+	assert.NoError(t, err, "configure --settings")
+	assert.Equal(t, out, "color=blue", "settings from the flag")
+
+	// Naming explicitly the default file must not fall back to the embedded settings.
+	defaultSettings := "/opt/florist/config.json"
+	if _, err := os.Stat(defaultSettings); err == nil {
+		t.Skipf("%s exists on this host", defaultSettings)
+	}
+	_, err = configure("--settings=" + defaultSettings)
+	assert.ErrorContains(t, err, "reading settings: open "+defaultSettings, "configure")
+}
+
+// TestHelperConfigure is not a test: it runs configure, printing the value of
+// setting "color", when executed by TestConfigureSettingsFromBundleExe.
+func TestHelperConfigure(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_CONFIGURE") != "1" {
+		return
+	}
+	args := []string{"program", "configure"}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			args = append(args, os.Args[i+1:]...)
+			break
+		}
+	}
+	var color string
+	err := provisioner.MainErr(args, bundleOpts(t, &color))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print("color=" + color)
+	os.Exit(0)
+}
+
+func TestBundleTarEncrypted(t *testing.T) {
+	var color string
+	opts := bundleOpts(t, &color)
+	dir := t.TempDir()
+	key := filepath.Join(dir, "settings.key")
+	settings := writeSettings(t, `{"color": "blue"}`)
+	output := filepath.Join(dir, "prov-prod.tar.gz")
+
+	err := provisioner.MainErr([]string{"program", "bundle", "--gen-key=" + key}, opts)
+	assert.NoError(t, err, "bundle --gen-key")
+	err = provisioner.MainErr([]string{"program", "bundle", "--format=tar",
+		"--settings=" + settings, "--encrypt-key=" + key, "--output=" + output}, opts)
+	assert.NoError(t, err, "bundle")
+
+	files := untar(t, output)
+	encrypted, found := files["config.json.enc"]
+	assert.True(t, found, "config.json.enc in bundle")
+	assert.True(t, provisioner.IsEncrypted(encrypted), "settings encrypted")
+	_, found = files[provisioner.BundleManifestName]
+	assert.True(t, found, "manifest in bundle")
+	encPath := filepath.Join(dir, "config.json.enc")
+	assert.NoError(t, os.WriteFile(encPath, encrypted, 0o600), "os.WriteFile")
+
+	err = provisioner.MainErr([]string{"program", "configure",
+		"--settings=" + encPath, "--settings-key=" + key}, opts)
+	assert.NoError(t, err, "configure")
+	assert.Equal(t, color, "blue", "setting from the encrypted file")
+
+	err = provisioner.MainErr([]string{"program", "configure",
+		"--settings=" + encPath}, opts)
+	assert.ErrorContains(t, err, "settings are encrypted, missing key", "configure")
+
+	otherKey := filepath.Join(dir, "other.key")
+	err = provisioner.MainErr([]string{"program", "bundle", "--gen-key=" + otherKey}, opts)
+	assert.NoError(t, err, "bundle --gen-key")
+	err = provisioner.MainErr([]string{"program", "configure",
+		"--settings=" + encPath, "--settings-key=" + otherKey}, opts)
+	assert.ErrorContains(t, err, "DecryptSettings: wrong key or corrupted data", "configure")
+}
+
+func TestBundleInvalidSettings(t *testing.T) {
+	var color string
+	settings := writeSettings(t, `{"color": `)
+
+	err := provisioner.MainErr([]string{"program", "bundle", "--settings=" + settings,
+		"--output=" + filepath.Join(t.TempDir(), "out")}, bundleOpts(t, &color))
+
+	assert.ErrorContains(t, err, "bundle: NewConfig: parsing "+settings, "bundle")
+}
+
+// untar returns the contents of the files in the gzipped tar archive 'fpath'.
+func untar(t *testing.T, fpath string) map[string][]byte {
+	t.Helper()
+	fi, err := os.Open(fpath)
+	assert.NoError(t, err, "os.Open")
+	defer fi.Close()
+	zr, err := gzip.NewReader(fi)
+	assert.NoError(t, err, "gzip.NewReader")
+	tr := tar.NewReader(zr)
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files
+		}
+		assert.NoError(t, err, "tr.Next")
+		buf, err := io.ReadAll(tr)
+		assert.NoError(t, err, "io.ReadAll")
+		files[hdr.Name] = buf
+	}
+}
@@ -0,0 +1,134 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/marco-m/clim"
+)
+
+type bundleCmd struct {
+	Settings   string
+	Output     string
+	Format     string
+	EncryptKey string
+	GenKey     string
+}
+
+func newBundleCmd(parent *clim.CLI[App]) error {
+	bundleCmd := bundleCmd{}
+
+	cli, err := clim.NewSub(parent, "bundle",
+		"create a single artifact with this provisioner and a settings file", bundleCmd.Run)
+	if err != nil {
+		return err
+	}
+
+	return cli.AddFlags(&clim.Flag{
+		Value: clim.String(&bundleCmd.Settings, ""),
+		Long:  "settings", Label: "PATH", Help: "Settings file (JSON) to embed",
+	}, &clim.Flag{
+		Value: clim.String(&bundleCmd.Output, ""),
+		Long:  "output", Label: "PATH", Help: "Bundle to create",
+	}, &clim.Flag{
+		Value: clim.String(&bundleCmd.Format, "exe"),
+		Long:  "format", Label: "FORMAT",
+		Help: "exe (self-contained executable) or tar (.tar.gz)",
+	}, &clim.Flag{
+		Value: clim.String(&bundleCmd.EncryptKey, ""),
+		Long:  "encrypt-key", Label: "PATH", Help: "Encrypt the settings with this key file",
+	}, &clim.Flag{
+		Value: clim.String(&bundleCmd.GenKey, ""),
+		Long:  "gen-key", Label: "PATH",
+		Help: "Generate a key file for --encrypt-key, then exit",
+	})
+}
+
+func (cmd *bundleCmd) Run(app App) error {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("bundle: "+format, a...)
+	}
+
+	if cmd.GenKey != "" {
+		key, err := GenerateSettingsKey()
+		if err != nil {
+			return errorf("%s", err)
+		}
+		if err := os.WriteFile(cmd.GenKey, []byte(key+"\n"), 0o600); err != nil {
+			return errorf("%s", err)
+		}
+		app.log.Info("generated-key", "path", cmd.GenKey)
+		return nil
+	}
+
+	if cmd.Settings == "" || cmd.Output == "" {
+		return errorf("--settings and --output are required")
+	}
+	var write func(w io.Writer, exe []byte, manifest BundleManifest, settings []byte) error
+	var mode os.FileMode
+	switch cmd.Format {
+	case "exe":
+		write, mode = writeBundleExe, 0o755
+	case "tar":
+		write, mode = writeBundleTar, 0o644
+	default:
+		return errorf("--format: unknown format %q (want exe or tar)", cmd.Format)
+	}
+
+	settings, err := os.ReadFile(cmd.Settings)
+	if err != nil {
+		return errorf("%s", err)
+	}
+	// Catch mistakes now instead of at configure time.
+	if _, err := newConfigFromBytes(cmd.Settings, settings); err != nil {
+		return errorf("%s", err)
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return errorf("%s", err)
+	}
+	// If this provisioner is itself a bundle, do not nest the bundles.
+	exe, err := readExecutable(exePath)
+	if err != nil {
+		return errorf("%s", err)
+	}
+
+	manifest := BundleManifest{
+		Created:           time.Now().UTC().Round(time.Second),
+		Provisioner:       filepath.Base(exePath),
+		ProvisionerSHA256: sha256hex(exe),
+		Settings:          "config.json",
+	}
+	if cmd.EncryptKey != "" {
+		key, err := os.ReadFile(cmd.EncryptKey)
+		if err != nil {
+			return errorf("%s", err)
+		}
+		if settings, err = EncryptSettings(string(key), settings); err != nil {
+			return errorf("%s", err)
+		}
+		manifest.Settings += ".enc"
+		manifest.Encrypted = true
+	}
+	manifest.SettingsSHA256 = sha256hex(settings)
+
+	var buf bytes.Buffer
+	if err := write(&buf, exe, manifest, settings); err != nil {
+		return errorf("%s", err)
+	}
+	tmp := cmd.Output + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), mode); err != nil {
+		return errorf("%s", err)
+	}
+	if err := os.Rename(tmp, cmd.Output); err != nil {
+		return errorf("%s", err)
+	}
+	app.log.Info("bundle-created", "output", cmd.Output, "format", cmd.Format,
+		"encrypted", manifest.Encrypted)
+	return nil
+}
@@ -0,0 +1,130 @@
+package provisioner
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/marco-m/clim"
+
+	"github.com/marco-m/florist/pkg/cloudinit"
+)
+
+type cloudinitCmd struct {
+	Settings          string
+	Output            string
+	Format            string
+	Provider          string
+	ProvisionerURL    string
+	ProvisionerSHA256 string
+}
+
+func newCloudinitCmd(parent *clim.CLI[App]) error {
+	cloudinitCmd := cloudinitCmd{}
+
+	cli, err := clim.NewSub(parent, "cloudinit",
+		"generate cloud-init user-data that bootstraps this provisioner", cloudinitCmd.Run)
+	if err != nil {
+		return err
+	}
+
+	return cli.AddFlags(&clim.Flag{
+		Value: clim.String(&cloudinitCmd.Settings, ""),
+		Long:  "settings", Label: "PATH", Help: "Settings file (JSON) to embed",
+	}, &clim.Flag{
+		Value: clim.String(&cloudinitCmd.Output, ""),
+		Long:  "output", Label: "PATH", Help: "User-data to create (default: stdout)",
+	}, &clim.Flag{
+		Value: clim.String(&cloudinitCmd.Format, "user-data"),
+		Long:  "format", Label: "FORMAT",
+		Help: "user-data, iso (NoCloud seed image) or dir (NoCloud seed directory)",
+	}, &clim.Flag{
+		Value: clim.String(&cloudinitCmd.Provider, ""),
+		Long:  "provider", Label: "NAME",
+		Help: "Fail if the user-data exceeds the limit of this cloud provider",
+	}, &clim.Flag{
+		Value: clim.String(&cloudinitCmd.ProvisionerURL, ""),
+		Long:  "provisioner-url", Label: "URL",
+		Help: "Download the provisioner from URL instead of embedding it",
+	}, &clim.Flag{
+		Value: clim.String(&cloudinitCmd.ProvisionerSHA256, ""),
+		Long:  "provisioner-sha256", Label: "HASH",
+		Help: "SHA-256 of the provisioner at --provisioner-url (mandatory with it)",
+	})
+}
+
+func (cmd *cloudinitCmd) Run(app App) error {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("cloudinit: "+format, a...)
+	}
+
+	switch cmd.Format {
+	case "user-data":
+	case "iso", "dir":
+		if cmd.Output == "" {
+			return errorf("--format=%s requires --output", cmd.Format)
+		}
+	default:
+		return errorf("--format: unknown format %q (want user-data, iso or dir)", cmd.Format)
+	}
+	// We do not default to the hash of this provisioner: the file at the URL could
+	// be a bundle or another build, and the mismatch would show up only at boot.
+	if (cmd.ProvisionerURL == "") != (cmd.ProvisionerSHA256 == "") {
+		return errorf("--provisioner-url and --provisioner-sha256 go together")
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return errorf("%s", err)
+	}
+	// If this provisioner is an exe bundle, the embedded settings are ignored anyway
+	// in favor of --settings, so strip them.
+	exe, err := readExecutable(exePath)
+	if err != nil {
+		return errorf("%s", err)
+	}
+
+	var bs cloudinit.Bootstrap
+	if cmd.ProvisionerURL != "" {
+		bs.ProvisionerURL = cmd.ProvisionerURL
+		bs.ProvisionerSHA256 = cmd.ProvisionerSHA256
+	} else {
+		bs.Provisioner = exe
+	}
+	if cmd.Settings != "" {
+		if bs.Settings, err = os.ReadFile(cmd.Settings); err != nil {
+			return errorf("%s", err)
+		}
+		// Catch mistakes now instead of at boot time.
+		if _, err := newConfigFromBytes(cmd.Settings, bs.Settings); err != nil {
+			return errorf("%s", err)
+		}
+	}
+
+	userData, err := bs.Render(cmd.Provider)
+	if err != nil {
+		return errorf("%s", err)
+	}
+	// Changing the instance ID makes cloud-init provision again, so derive it from
+	// the user-data.
+	seed := cloudinit.Seed{
+		UserData: userData,
+		MetaData: cloudinit.MetaData{InstanceID: "florist-" + sha256hex(userData)[:12]},
+	}
+	switch {
+	case cmd.Format == "iso":
+		err = seed.WriteISO(cmd.Output)
+	case cmd.Format == "dir":
+		err = seed.WriteDir(cmd.Output)
+	case cmd.Output == "":
+		_, err = os.Stdout.Write(userData)
+		return err
+	default:
+		err = os.WriteFile(cmd.Output, userData, 0o600)
+	}
+	if err != nil {
+		return errorf("%s", err)
+	}
+	app.log.Info("user-data-created", "output", cmd.Output, "format", cmd.Format,
+		"size", len(userData), "embedded", bs.ProvisionerURL == "")
+	return nil
+}
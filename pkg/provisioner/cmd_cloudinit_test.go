@@ -0,0 +1,54 @@
+package provisioner_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/provisioner"
+)
+
+func TestCloudinit(t *testing.T) {
+	var color string
+	settings := writeSettings(t, `{"color": "red"}`)
+	output := filepath.Join(t.TempDir(), "user-data")
+	hash := strings.Repeat("ab", 32)
+
+	err := provisioner.MainErr([]string{"program", "cloudinit", "--settings=" + settings,
+		"--provisioner-url=https://example.com/prov", "--provisioner-sha256=" + hash,
+		"--provider=aws",
+		"--output=" + output}, bundleOpts(t, &color))
+	assert.NoError(t, err, "cloudinit")
+
+	assert.FileContains(t, output, "#cloud-config\n")
+	assert.FileContains(t, output, `"content": "{\"color\": \"red\"}"`)
+	assert.FileContains(t, output, `'https://example.com/prov'`)
+	assert.FileContains(t, output, hash)
+
+	seedDir := filepath.Join(t.TempDir(), "cidata")
+	err = provisioner.MainErr([]string{"program", "cloudinit", "--format=dir",
+		"--provisioner-url=https://example.com/prov", "--provisioner-sha256=" + hash,
+		"--output=" + seedDir},
+		bundleOpts(t, &color))
+	assert.NoError(t, err, "cloudinit --format=dir")
+	assert.FileContains(t, filepath.Join(seedDir, "user-data"), "#cloud-config\n")
+	assert.FileContains(t, filepath.Join(seedDir, "meta-data"), `"instance-id": "florist-`)
+
+	// The test binary, compressed, is way bigger than the AWS limit.
+	err = provisioner.MainErr([]string{"program", "cloudinit", "--provider=aws",
+		"--output=" + output}, bundleOpts(t, &color))
+	assert.ErrorContains(t, err, "cloudinit: cloudinit.CheckSize: user-data too big for aws",
+		"cloudinit")
+}
+
+func TestCloudinitProvisionerURLWithoutHash(t *testing.T) {
+	var color string
+
+	err := provisioner.MainErr([]string{"program", "cloudinit",
+		"--provisioner-url=https://example.com/prov"}, bundleOpts(t, &color))
+
+	assert.ErrorContains(t, err,
+		"cloudinit: --provisioner-url and --provisioner-sha256 go together", "cloudinit")
+}
@@ -1,7 +1,9 @@
 package provisioner
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/marco-m/clim"
@@ -9,9 +11,15 @@ import (
 )
 
 type configureCmd struct {
-	Settings string
+	Settings         string
+	SettingsKey      string
+	VerifyIdempotent bool
 }
 
+// defaultSettings is the settings file used when flag --settings is not set and the
+// provisioner is not an exe bundle.
+var defaultSettings = filepath.Join(florist.HomeDir, "config.json")
+
 func newConfigureCmd(parent *clim.CLI[App]) error {
 	configureCmd := configureCmd{}
 
@@ -21,8 +29,18 @@ func newConfigureCmd(parent *clim.CLI[App]) error {
 	}
 
 	if err := cli.AddFlags(&clim.Flag{
-		Value: clim.String(&configureCmd.Settings, filepath.Join(florist.HomeDir, "config.json")),
-		Long:  "settings", Help: "Settings file (JSON)",
+		Value: clim.String(&configureCmd.Settings, ""),
+		Long:  "settings",
+		Help: "Settings file (JSON) (default: if this is a bundle, the embedded " +
+			"settings, else " + defaultSettings + ")",
+	}, &clim.Flag{
+		Value: clim.String(&configureCmd.SettingsKey, ""),
+		Long:  "settings-key", Label: "PATH",
+		Help: "Key file to decrypt the settings (see bundle --encrypt-key)",
+	}, &clim.Flag{
+		Value: clim.Bool(&configureCmd.VerifyIdempotent, false),
+		Long:  "verify-idempotent",
+		Help:  "configure each flower a second time and fail if anything changed",
 	}); err != nil {
 		return err
 	}
@@ -32,7 +50,7 @@ func newConfigureCmd(parent *clim.CLI[App]) error {
 
 func (cmd *configureCmd) Run(app App) error {
 	run := func() error {
-		config, err := NewConfig(cmd.Settings)
+		config, err := loadConfig(app, cmd.Settings, cmd.SettingsKey)
 		if err != nil {
 			app.prov.errs = append(app.prov.errs, err)
 		}
@@ -57,6 +75,12 @@ func (cmd *configureCmd) Run(app App) error {
 			}
 		}
 
+		if cmd.VerifyIdempotent && len(app.prov.errs) == 0 {
+			if err := verifyIdempotent(app, "configure"); err != nil {
+				app.prov.errs = append(app.prov.errs, err)
+			}
+		}
+
 		if cfgErr := config.Errors(); cfgErr != nil {
 			app.prov.errs = append(app.prov.errs, cfgErr)
 		}
@@ -73,7 +97,7 @@ func (cmd *configureCmd) Run(app App) error {
 		if len(app.prov.errs) > 0 {
 			status = "❌ failure"
 		}
-		if err := customizeMotd("configured", status, app.opts.RootDir); err != nil {
+		if err := customizeMotd("configured", status); err != nil {
 			app.prov.errs = append(app.prov.errs, err)
 		}
 
@@ -85,3 +109,48 @@ func (cmd *configureCmd) Run(app App) error {
 
 	return timelog(run, app)
 }
+
+// loadConfig loads the settings from file 'settings' or, if empty, from the exe
+// bundle or, if the provisioner is not a bundle, from [defaultSettings]. The
+// settings are decrypted with the key file 'settingsKey', if needed.
+func loadConfig(app App, settings string, settingsKey string) (*Config, error) {
+	var key string
+	if settingsKey != "" {
+		buf, err := os.ReadFile(settingsKey)
+		if err != nil {
+			return &Config{settingsPath: settings}, fmt.Errorf("--settings-key: %s", err)
+		}
+		key = string(buf)
+	}
+
+	var data []byte
+	if settings == "" {
+		settings = defaultSettings
+		exe, err := os.Executable()
+		if err != nil {
+			return &Config{settingsPath: settings}, err
+		}
+		bundle, err := ReadBundle(exe)
+		switch {
+		case err == nil:
+			settings = exe + ":" + bundle.Manifest.Settings
+			data = bundle.Settings
+			app.log.Info("settings-from-bundle", "bundle", exe,
+				"created", bundle.Manifest.Created)
+		case !errors.Is(err, ErrNotBundle):
+			return &Config{settingsPath: settings}, err
+		}
+	}
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(settings); err != nil {
+			return &Config{settingsPath: settings}, fmt.Errorf("reading settings: %s", err)
+		}
+	}
+
+	plaintext, err := DecryptSettings(key, data)
+	if err != nil {
+		return &Config{settingsPath: settings}, fmt.Errorf("%s: %s", settings, err)
+	}
+	return newConfigFromBytes(settings, plaintext)
+}
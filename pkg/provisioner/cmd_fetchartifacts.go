@@ -0,0 +1,152 @@
+package provisioner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/marco-m/clim"
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/platform"
+)
+
+// fetchJobs is the maximum number of artifacts that fetch-artifacts downloads in
+// parallel.
+const fetchJobs = 4
+
+type fetchArtifactsCmd struct {
+	CacheDir    string
+	Arch        string
+	Settings    string
+	SettingsKey string
+}
+
+func newFetchArtifactsCmd(parent *clim.CLI[App]) error {
+	fetchArtifactsCmd := fetchArtifactsCmd{}
+
+	cli, err := clim.NewSub(parent, "fetch-artifacts",
+		"download the artifacts of the flowers to a cache, for an offline install",
+		fetchArtifactsCmd.Run)
+	if err != nil {
+		return err
+	}
+
+	return cli.AddFlags(&clim.Flag{
+		Value: clim.String(&fetchArtifactsCmd.CacheDir, ""),
+		Long:  "cache-dir", Label: "DIR",
+		Help:     "Artifact cache (then: install --cache-dir=DIR --offline)",
+		Required: true,
+	}, &clim.Flag{
+		Value: clim.String(&fetchArtifactsCmd.Arch, ""),
+		Long:  "arch", Label: "ARCH",
+		Help: "Fetch for architecture ARCH (amd64, arm64) instead of this machine's",
+	}, &clim.Flag{
+		Value: clim.String(&fetchArtifactsCmd.Settings, ""),
+		Long:  "settings",
+		Help:  "Settings file (JSON), to read the mirrors (keys " + MirrorPrefix + "URL)",
+	}, &clim.Flag{
+		Value: clim.String(&fetchArtifactsCmd.SettingsKey, ""),
+		Long:  "settings-key", Label: "PATH",
+		Help: "Key file to decrypt the settings (see bundle --encrypt-key)",
+	})
+}
+
+func (cmd *fetchArtifactsCmd) Run(app App) error {
+	run := func() error {
+		if cmd.Arch != "" {
+			arch, err := platform.ParseArch(cmd.Arch)
+			if err != nil {
+				return fmt.Errorf("fetch-artifacts: --arch: %s", err)
+			}
+			defer platform.SetArch(platform.SetArch(arch))
+		}
+		if err := setArtifactSource(app, florist.ArtifactSource{CacheDir: cmd.CacheDir},
+			cmd.Settings, cmd.SettingsKey); err != nil {
+			return fmt.Errorf("fetch-artifacts: %s", err)
+		}
+
+		type job struct {
+			fl  florist.Flower
+			art florist.Artifact
+		}
+		var jobs []job
+		var errs []error
+		for _, k := range app.prov.ordered {
+			fl := app.prov.flowers[k]
+			artifacter, ok := fl.(florist.Artifacter)
+			if !ok {
+				continue
+			}
+			if err := fl.Init(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			artifacts, err := artifacter.Artifacts()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", fl, err))
+				continue
+			}
+			for _, art := range artifacts {
+				jobs = append(jobs, job{fl: fl, art: art})
+			}
+		}
+
+		// Each job downloads to its own directory: artifacts of different flowers
+		// can have checksum or signature files with the same name. The artifacts
+		// stay in the cache.
+		tmpDir := path.Join(florist.WorkDir, "fetch-artifacts")
+		defer os.RemoveAll(florist.Path(tmpDir))
+		client := florist.NewNetClient()
+		jobErrs := make([]error, len(jobs))
+		sem := make(chan struct{}, fetchJobs)
+		var wg sync.WaitGroup
+		for i, jb := range jobs {
+			wg.Go(func() {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				app.log.Info("fetching", "flower", jb.fl.String(), "url", jb.art.URL)
+				dstDir := path.Join(tmpDir, strconv.Itoa(i))
+				if _, err := jb.art.Fetch(client, dstDir); err != nil {
+					jobErrs[i] = fmt.Errorf("%s: %s", jb.fl, err)
+				}
+			})
+		}
+		wg.Wait()
+		count := 0
+		for _, err := range jobErrs {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			count++
+		}
+		app.log.Info("fetched", "artifacts-count", count, "cache-dir", cmd.CacheDir)
+
+		if err := florist.JoinErrors(errs...); err != nil {
+			return fmt.Errorf("fetch-artifacts: %s", err)
+		}
+		return nil
+	}
+
+	return timelog(run, app)
+}
+
+// setArtifactSource configures florist.NetFetch with src, plus the mirrors of the
+// settings file, if any.
+func setArtifactSource(app App, src florist.ArtifactSource, settings string,
+	settingsKey string,
+) error {
+	if settings != "" {
+		config, err := loadConfig(app, settings, settingsKey)
+		if err != nil {
+			return err
+		}
+		src.Mirrors = config.Mirrors()
+	}
+	app.log.Debug("artifact-source", "cache-dir", src.CacheDir, "offline", src.Offline,
+		"mirrors", src.Mirrors)
+	florist.SetArtifactSource(src)
+	return nil
+}
@@ -4,19 +4,60 @@ import (
 	"fmt"
 
 	"github.com/marco-m/clim"
+	"github.com/marco-m/florist/pkg/florist"
 )
 
-type installCmd struct{}
+type installCmd struct {
+	VerifyIdempotent bool
+	CacheDir         string
+	Offline          bool
+	Settings         string
+	SettingsKey      string
+}
 
 func newInstallCmd(parent *clim.CLI[App]) error {
 	installCmd := installCmd{}
 
-	_, err := clim.NewSub(parent, "install", "install the flowers", installCmd.Run)
-	return err
+	cli, err := clim.NewSub(parent, "install", "install the flowers", installCmd.Run)
+	if err != nil {
+		return err
+	}
+
+	return cli.AddFlags(&clim.Flag{
+		Value: clim.Bool(&installCmd.VerifyIdempotent, false),
+		Long:  "verify-idempotent",
+		Help:  "install each flower a second time and fail if anything changed",
+	}, &clim.Flag{
+		Value: clim.String(&installCmd.CacheDir, ""),
+		Long:  "cache-dir", Label: "DIR",
+		Help: "Artifact cache: take the downloads from there (see fetch-artifacts)",
+	}, &clim.Flag{
+		Value: clim.Bool(&installCmd.Offline, false),
+		Long:  "offline",
+		Help:  "Never download; fail if an artifact is not in --cache-dir",
+	}, &clim.Flag{
+		Value: clim.String(&installCmd.Settings, ""),
+		Long:  "settings",
+		Help:  "Settings file (JSON), to read the mirrors (keys " + MirrorPrefix + "URL)",
+	}, &clim.Flag{
+		Value: clim.String(&installCmd.SettingsKey, ""),
+		Long:  "settings-key", Label: "PATH",
+		Help: "Key file to decrypt the settings (see bundle --encrypt-key)",
+	})
 }
 
 func (cmd *installCmd) Run(app App) error {
 	run := func() error {
+		if cmd.Offline && cmd.CacheDir == "" {
+			return fmt.Errorf("install: --offline requires --cache-dir")
+		}
+		if err := setArtifactSource(app, florist.ArtifactSource{
+			CacheDir: cmd.CacheDir,
+			Offline:  cmd.Offline,
+		}, cmd.Settings, cmd.SettingsKey); err != nil {
+			return fmt.Errorf("install: %s", err)
+		}
+
 		app.log.Info("installing", "flowers-count", len(app.prov.flowers),
 			"flowers", app.prov.ordered)
 
@@ -31,8 +72,14 @@ func (cmd *installCmd) Run(app App) error {
 			}
 		}
 
+		if cmd.VerifyIdempotent {
+			if err := verifyIdempotent(app, "install"); err != nil {
+				return err
+			}
+		}
+
 		status := "✅  success"
-		return customizeMotd("installed", status, app.opts.RootDir)
+		return customizeMotd("installed", status)
 	}
 
 	return timelog(run, app)
@@ -0,0 +1,100 @@
+package provisioner
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/marco-m/clim"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/pull"
+)
+
+type pullCmd struct {
+	URL          string
+	PublicKey    string
+	StateDir     string
+	Force        bool
+	InstallTimer bool
+	Interval     time.Duration
+}
+
+func newPullCmd(parent *clim.CLI[App]) error {
+	pullCmd := pullCmd{}
+
+	cli, err := clim.NewSub(parent, "pull",
+		"configure from the latest signed bundle, if changed", pullCmd.Run)
+	if err != nil {
+		return err
+	}
+
+	return cli.AddFlags(&clim.Flag{
+		Value: clim.String(&pullCmd.URL, ""),
+		Long:  "url", Label: "URL", Help: "Base URL of the bundle",
+		Required: true,
+	}, &clim.Flag{
+		Value: clim.String(&pullCmd.PublicKey, ""),
+		Long:  "public-key", Label: "KEY",
+		Help:     "Public key (ed25519, base64) to verify the bundle",
+		Required: true,
+	}, &clim.Flag{
+		Value: clim.String(&pullCmd.StateDir, pull.StateDir),
+		Long:  "state-dir", Label: "DIR", Help: "Where to download the bundle",
+	}, &clim.Flag{
+		Value: clim.Bool(&pullCmd.Force, false),
+		Long:  "force",
+		Help:  "configure even if the bundle did not change or is older than the applied one",
+	}, &clim.Flag{
+		Value: clim.Bool(&pullCmd.InstallTimer, false),
+		Long:  "install-timer",
+		Help:  "instead of pulling, install a systemd timer that pulls periodically",
+	}, &clim.Flag{
+		Value: clim.Duration(&pullCmd.Interval, time.Hour),
+		Long:  "interval", Label: "DURATION", Help: "Interval of the timer",
+	})
+}
+
+func (cmd *pullCmd) Run(app App) error {
+	run := func() error {
+		publicKey, err := pull.ParsePublicKey(cmd.PublicKey)
+		if err != nil {
+			return fmt.Errorf("pull: %s", err)
+		}
+
+		if cmd.InstallTimer {
+			exe, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("pull: %s", err)
+			}
+			app.log.Info("installing-pull-timer", "interval", cmd.Interval)
+			return pull.InstallTimer(pull.TimerConfig{
+				Command: []string{
+					exe, "pull", "--url=" + cmd.URL, "--public-key=" + cmd.PublicKey,
+					"--state-dir=" + cmd.StateDir,
+				},
+				Interval: cmd.Interval,
+			})
+		}
+
+		outcome, err := pull.Pull(pull.Config{
+			URL:       cmd.URL,
+			PublicKey: publicKey,
+			StateDir:  cmd.StateDir,
+			Force:     cmd.Force,
+		})
+		if err != nil {
+			// When configure ran, it already updated the motd.
+			if !outcome.Configured {
+				err = florist.JoinErrors(err, customizeMotd("pulled", "❌ failure"))
+			}
+			return err
+		}
+		if !outcome.Configured {
+			app.log.Info("pull-nothing-to-do", "bundle-created", outcome.Manifest.Created)
+		}
+		return nil
+	}
+
+	return timelog(run, app)
+}
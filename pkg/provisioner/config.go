@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -21,6 +22,17 @@ func NewConfig(settingsPath string) (*Config, error) {
 	return cfg, nil
 }
 
+// newConfigFromBytes is like [NewConfig], for settings already read. 'name' is used
+// in the error messages.
+func newConfigFromBytes(name string, buf []byte) (*Config, error) {
+	cfg := &Config{settingsPath: name}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	if err := dec.Decode(&cfg.settings); err != nil {
+		return cfg, fmt.Errorf("NewConfig: parsing %s: %s", name, err)
+	}
+	return cfg, nil
+}
+
 func parse(path string, data any) error {
 	rd, err := os.Open(path)
 	if err != nil {
@@ -78,3 +90,23 @@ func (cfg *Config) Errors() error {
 	}
 	return nil
 }
+
+// MirrorPrefix is the prefix of the settings keys that configure the mirrors of the
+// artifacts downloaded by the flowers. For example, the setting
+//
+//	"mirror:https://releases.hashicorp.com/": "https://mirror.example.com/hashicorp/"
+//
+// makes the flowers download from the mirror. See florist.ArtifactSource.
+const MirrorPrefix = "mirror:"
+
+// Mirrors returns the URL prefix rewrites of the settings with keys starting with
+// [MirrorPrefix].
+func (cfg *Config) Mirrors() map[string]string {
+	mirrors := make(map[string]string)
+	for k, v := range cfg.settings {
+		if prefix, found := strings.CutPrefix(k, MirrorPrefix); found {
+			mirrors[prefix] = v
+		}
+	}
+	return mirrors
+}
@@ -30,7 +30,12 @@ type Options struct {
 	// command-line flag.
 	LogOutput io.Writer
 	// Set to a temporary directory during testing. DO NOT MODIFY in production code.
+	// It is passed to florist.SetRoot, so that all the florist file operations, and
+	// the flowers that use them, happen below RootDir.
 	RootDir string
+	// Runs the external commands. Defaults to florist.ExecRunner. Set to a
+	// florist.FakeRunner during testing. DO NOT MODIFY in production code.
+	Runner florist.Runner
 	// The setup function, called before any command-line subcommand. Mandatory.
 	SetupFn func(prov *Provisioner) error
 	// The preConfigure function, called before the command-line configure
@@ -105,9 +110,21 @@ func MainErr(args []string, opts *Options) error {
 	if err := newInstallCmd(cli); err != nil {
 		return err
 	}
+	if err := newFetchArtifactsCmd(cli); err != nil {
+		return err
+	}
 	if err := newConfigureCmd(cli); err != nil {
 		return err
 	}
+	if err := newPullCmd(cli); err != nil {
+		return err
+	}
+	if err := newBundleCmd(cli); err != nil {
+		return err
+	}
+	if err := newCloudinitCmd(cli); err != nil {
+		return err
+	}
 
 	action, err := cli.Parse(args[1:])
 	if err != nil {
@@ -126,6 +143,10 @@ func MainErr(args []string, opts *Options) error {
 	if opts.RootDir == "" {
 		opts.RootDir = "/"
 	}
+	if err := florist.SetRoot(opts.RootDir); err != nil {
+		return fmt.Errorf("florist.Main: %s", err)
+	}
+	florist.SetRunner(opts.Runner)
 	if opts.SetupFn == nil {
 		return fmt.Errorf("florist.Main: SetupFn is nil")
 	}
@@ -227,6 +248,10 @@ func LowLevelInit(logOutput io.Writer, logLevel string) error {
 		return errorf("%s", err)
 	}
 
+	// With a hermetic root (see florist.SetRoot), the parent of WorkDir might not exist.
+	if err := florist.MkdirAll(path.Dir(florist.WorkDir), 0o755); err != nil {
+		return errorf("%s", err)
+	}
 	if err := florist.Mkdir(florist.WorkDir, 0o755, User().Username, Group().Name); err != nil {
 		return errorf("%s", err)
 	}
@@ -237,18 +262,17 @@ func LowLevelInit(logOutput io.Writer, logLevel string) error {
 	return nil
 }
 
-// root is a hack to ease testing.
-func customizeMotd(op string, status string, rootDir string) error {
+func customizeMotd(op string, status string) error {
 	now := time.Now().UTC().Round(time.Second)
 	line := fmt.Sprintf("%s 🌼 florist 🌺 System %s (%s)\n", now, op, status)
-	name := path.Join(rootDir, "/etc/motd")
+	name := "/etc/motd"
 	slog.Debug("customize-motd", "target", name, "operation", op, "status", status)
 
-	if err := os.MkdirAll(path.Dir(name), 0o755); err != nil {
+	if err := florist.MkdirAll(path.Dir(name), 0o755); err != nil {
 		return err
 	}
 
-	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	f, err := florist.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
 	if err != nil {
 		return err
 	}
@@ -4,11 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/marco-m/florist/pkg/florist"
 	"github.com/marco-m/florist/pkg/provisioner"
+	"github.com/marco-m/rosina/assert"
 )
 
 func TestProvisionerConfigureZeroFlowers(t *testing.T) {
@@ -182,3 +190,191 @@ func TestProvisionerIntermediateErrorsKeepsGoing(t *testing.T) {
 		}
 	}
 }
+
+// fileFlower writes Line to File during configure, appending if Append is true.
+type fileFlower struct {
+	Name   string
+	File   string
+	Line   string
+	Append bool
+}
+
+func (ff *fileFlower) String() string      { return ff.Name }
+func (ff *fileFlower) Description() string { return "writes " + ff.File }
+func (ff *fileFlower) Embedded() []string  { return nil }
+func (ff *fileFlower) Init() error         { return florist.MkdirAll("/etc", 0o755) }
+func (ff *fileFlower) Install() error      { return nil }
+
+func (ff *fileFlower) Configure() error {
+	if !ff.Append {
+		return florist.WriteFile(ff.File, ff.Line, 0o644, "root", "root")
+	}
+	fi, err := florist.OpenFile(ff.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	_, err = fi.WriteString(ff.Line)
+	return err
+}
+
+func TestProvisionerConfigureVerifyIdempotent(t *testing.T) {
+	fake := florist.NewFakeRunner()
+	opts := &provisioner.Options{
+		LogOutput: io.Discard,
+		RootDir:   t.TempDir(),
+		Runner:    fake,
+		SetupFn: func(prov *provisioner.Provisioner) error {
+			return prov.AddFlowers(
+				&fileFlower{Name: "writer", File: "/etc/writer", Line: "A=1\n"},
+				&fileFlower{Name: "appender", File: "/etc/environment", Line: "B=2\n",
+					Append: true},
+			)
+		},
+		PreConfigureFn: func(prov *provisioner.Provisioner, config *provisioner.Config) (any, error) {
+			return nil, nil
+		},
+	}
+	cmdline := []string{"program", "configure", "--settings=testdata/simple.json",
+		"--verify-idempotent"}
+
+	err := provisioner.MainErr(cmdline, opts)
+
+	assert.ErrorContains(t, err,
+		"configure: verify-idempotent: flower appender: not idempotent: second configure: changed /etc/environment: ",
+		"provisioner.MainErr")
+	if strings.Contains(err.Error(), "flower writer") {
+		t.Errorf("flower writer reported as not idempotent: %s", err)
+	}
+	have, _ := os.ReadFile(filepath.Join(opts.RootDir, "etc/environment"))
+	assert.Equal(t, string(have), "B=2\nB=2\n", "the second run happened")
+	assert.DeepEqual(t, fake.Calls(), []string(nil),
+		"snapshot queries not among the calls")
+}
+
+// artifactFlower downloads an artifact during Install.
+type artifactFlower struct {
+	artifact florist.Artifact
+}
+
+func (fl *artifactFlower) String() string      { return "artifact" }
+func (fl *artifactFlower) Description() string { return "downloads an artifact" }
+func (fl *artifactFlower) Embedded() []string  { return nil }
+func (fl *artifactFlower) Init() error         { return nil }
+func (fl *artifactFlower) Configure() error    { return nil }
+
+func (fl *artifactFlower) Artifacts() ([]florist.Artifact, error) {
+	return []florist.Artifact{fl.artifact}, nil
+}
+
+func (fl *artifactFlower) Install() error {
+	fpath, err := fl.artifact.Fetch(nil, florist.WorkDir)
+	if err != nil {
+		return err
+	}
+	return florist.CopyFile(fpath, "/banana", 0o644, provisioner.User().Username)
+}
+
+func TestProvisionerFetchArtifactsThenInstallOffline(t *testing.T) {
+	t.Cleanup(func() { florist.SetArtifactSource(florist.ArtifactSource{}) })
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r.URL.Path)
+			fmt.Fprint(w, "banana")
+		},
+	))
+	defer ts.Close()
+	tmpDir := t.TempDir()
+	settings := filepath.Join(tmpDir, "settings.json")
+	err := os.WriteFile(settings, []byte(`{"mirror:https://releases.example.com/": "`+
+		ts.URL+`/mirror/"}`), 0o600)
+	assert.NoError(t, err, "os.WriteFile")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	rootDir := t.TempDir()
+	opts := &provisioner.Options{
+		LogOutput: io.Discard,
+		RootDir:   rootDir,
+		SetupFn: func(prov *provisioner.Provisioner) error {
+			return prov.AddFlowers(&artifactFlower{florist.Artifact{
+				URL:  "https://releases.example.com/fruits/banana",
+				Hash: "b493d48364afe44d11c0165cf470a4164d1e2609911ef998be868d46ade3de4e",
+			}})
+		},
+		PreConfigureFn: func(prov *provisioner.Provisioner, config *provisioner.Config) (any, error) {
+			return nil, nil
+		},
+	}
+
+	err = provisioner.MainErr([]string{"program", "fetch-artifacts",
+		"--cache-dir=" + cacheDir, "--settings=" + settings}, opts)
+	assert.NoError(t, err, "fetch-artifacts")
+	assert.DeepEqual(t, requests, []string{"/mirror/fruits/banana"}, "requests")
+	assert.FileEqualsString(t,
+		filepath.Join(cacheDir, "releases.example.com/fruits/banana"), "banana")
+
+	ts.Close()
+	err = provisioner.MainErr([]string{"program", "install",
+		"--cache-dir=" + cacheDir, "--offline"}, opts)
+	assert.NoError(t, err, "install")
+	assert.FileEqualsString(t, filepath.Join(rootDir, "banana"), "banana")
+}
+
+// artifactsFlower has more than one artifact.
+type artifactsFlower struct {
+	artifactFlower
+	artifacts []florist.Artifact
+}
+
+func (fl *artifactsFlower) Artifacts() ([]florist.Artifact, error) {
+	return fl.artifacts, nil
+}
+
+func TestProvisionerFetchArtifactsInParallel(t *testing.T) {
+	t.Cleanup(func() { florist.SetArtifactSource(florist.ArtifactSource{}) })
+	// Each request waits for the other: the test passes only if the two downloads
+	// run in parallel.
+	var mu sync.Mutex
+	arrived := 0
+	both := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			arrived++
+			if arrived == 2 {
+				close(both)
+			}
+			mu.Unlock()
+			select {
+			case <-both:
+				fmt.Fprint(w, "banana")
+			case <-time.After(5 * time.Second):
+				http.Error(w, "downloads not in parallel", http.StatusNotFound)
+			}
+		},
+	))
+	defer ts.Close()
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	hash := "b493d48364afe44d11c0165cf470a4164d1e2609911ef998be868d46ade3de4e"
+	opts := &provisioner.Options{
+		LogOutput: io.Discard,
+		RootDir:   t.TempDir(),
+		SetupFn: func(prov *provisioner.Provisioner) error {
+			// Same base name: each download must go to its own directory.
+			return prov.AddFlowers(&artifactsFlower{artifacts: []florist.Artifact{
+				{URL: ts.URL + "/a/banana", Hash: hash},
+				{URL: ts.URL + "/b/banana", Hash: hash},
+			}})
+		},
+		PreConfigureFn: func(prov *provisioner.Provisioner, config *provisioner.Config) (any, error) {
+			return nil, nil
+		},
+	}
+
+	err := provisioner.MainErr([]string{"program", "fetch-artifacts",
+		"--cache-dir=" + cacheDir}, opts)
+	assert.NoError(t, err, "fetch-artifacts")
+	host := strings.TrimPrefix(ts.URL, "http://")
+	assert.FileEqualsString(t, filepath.Join(cacheDir, host, "a/banana"), "banana")
+	assert.FileEqualsString(t, filepath.Join(cacheDir, host, "b/banana"), "banana")
+}
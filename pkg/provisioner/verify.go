@@ -0,0 +1,52 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+// verifyIdempotent runs 'phase' ("install" or "configure") of each flower a second
+// time and returns an error listing the flowers whose second run changed the host
+// state. It is the implementation of the --verify-idempotent flag.
+func verifyIdempotent(app App, phase string) error {
+	log := app.log.With("verify-idempotent", phase)
+	snapshotter := florist.NewSnapshotter()
+	var errs []error
+
+	for _, k := range app.prov.ordered {
+		fl := app.prov.flowers[k]
+		log.Info("verifying", "flower", fl.String())
+		before, err := snapshotter.Take()
+		if err != nil {
+			return fmt.Errorf("verify-idempotent: %s", err)
+		}
+		if err := fl.Init(); err != nil {
+			errs = append(errs, fmt.Errorf("flower %s: second init: %s", fl, err))
+			continue
+		}
+		run := fl.Install
+		if phase == "configure" {
+			run = fl.Configure
+		}
+		if err := run(); err != nil {
+			errs = append(errs, fmt.Errorf("flower %s: second %s: %s", fl, phase, err))
+			continue
+		}
+		after, err := snapshotter.Take()
+		if err != nil {
+			return fmt.Errorf("verify-idempotent: %s", err)
+		}
+		if diffs := before.Diff(after); len(diffs) > 0 {
+			log.Error("not idempotent", "flower", fl.String(), "changes", diffs)
+			errs = append(errs, fmt.Errorf("flower %s: not idempotent: second %s: %s",
+				fl, phase, strings.Join(diffs, "; ")))
+		}
+	}
+
+	if err := florist.JoinErrors(errs...); err != nil {
+		return fmt.Errorf("verify-idempotent: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+// Package pull implements the pull mode: instead of being pushed to a host, the
+// provisioner runs on the host periodically (see [InstallTimer]), fetches from an
+// HTTP server the latest signed bundle (provisioner binary plus settings) and runs
+// its configure subcommand only if the bundle changed.
+//
+// A bundle is a directory served over HTTP, created by [Publish]:
+//
+//	manifest.json      names and SHA-256 of the files below
+//	manifest.json.sig  ed25519 signature of manifest.json, base64-encoded
+//	<provisioner>      the provisioner binary
+//	config.json        the settings
+package pull
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marco-m/florist/internal"
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+const (
+	// ManifestName is the name of the manifest of a bundle.
+	ManifestName = "manifest.json"
+	// SignatureName is the name of the signature of the manifest.
+	SignatureName = ManifestName + ".sig"
+	// StateDir is the default directory where the bundle is downloaded.
+	StateDir = florist.HomeDir + "/pull"
+	// appliedName is the file, in the state directory, containing the SHA-256 and
+	// the creation time of the manifest of the last bundle configured successfully.
+	appliedName = "applied"
+	// maxManifestSize limits the download of the manifest and of its signature.
+	maxManifestSize = 1 << 20
+)
+
+// Manifest describes a bundle.
+type Manifest struct {
+	Created     time.Time `json:"created"`
+	Provisioner File      `json:"provisioner"`
+	Settings    File      `json:"settings"`
+}
+
+// File is a file of a bundle.
+type File struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// Config is the configuration of [Pull].
+type Config struct {
+	// Base URL of the bundle: the files are fetched from URL/manifest.json, ...
+	// Mandatory.
+	URL string
+	// Key to verify the signature of the manifest. Mandatory.
+	PublicKey ed25519.PublicKey
+	// Directory where to download the bundle. Default: [StateDir].
+	StateDir string
+	// Run configure even if the bundle did not change or if it is older than the
+	// last one configured successfully.
+	Force bool
+	// Used to download the bundle. Default: [florist.NewNetClient].
+	Client *http.Client
+}
+
+// Outcome is the outcome of [Pull].
+type Outcome struct {
+	// True if configure has been run, successfully or not.
+	Configured bool
+	// The manifest of the bundle.
+	Manifest Manifest
+}
+
+// Pull fetches the bundle at cfg.URL, verifies its signature and the hashes of its
+// files and, if the bundle is different from the last one configured successfully
+// (or if cfg.Force), runs "<provisioner> configure --settings=<settings>".
+//
+// To protect from rollback and replay attacks, where whoever controls the HTTP
+// server serves an older bundle, validly signed, Pull refuses a bundle created
+// before the last one configured successfully, unless cfg.Force.
+//
+// The output of configure goes to the log; when run by the systemd service installed
+// by [InstallTimer], this means the journal. Configure itself updates /etc/motd.
+func Pull(cfg Config) (Outcome, error) {
+	errorf := internal.MakeErrorf("pull.Pull")
+	log := slog.With("fn", "pull.Pull", "url", cfg.URL)
+	var outcome Outcome
+
+	if cfg.URL == "" {
+		return outcome, errorf("missing URL")
+	}
+	if len(cfg.PublicKey) != ed25519.PublicKeySize {
+		return outcome, errorf("missing or invalid PublicKey")
+	}
+	if cfg.StateDir == "" {
+		cfg.StateDir = StateDir
+	}
+	if cfg.Client == nil {
+		cfg.Client = florist.NewNetClient()
+	}
+	baseURL := strings.TrimSuffix(cfg.URL, "/")
+
+	manifestBuf, err := fetch(cfg.Client, baseURL+"/"+ManifestName)
+	if err != nil {
+		return outcome, errorf("%s", err)
+	}
+	sigBuf, err := fetch(cfg.Client, baseURL+"/"+SignatureName)
+	if err != nil {
+		return outcome, errorf("%s", err)
+	}
+	if err := Verify(cfg.PublicKey, manifestBuf, sigBuf); err != nil {
+		return outcome, errorf("%s", err)
+	}
+	if err := json.Unmarshal(manifestBuf, &outcome.Manifest); err != nil {
+		return outcome, errorf("%s: %s", ManifestName, err)
+	}
+	manifest := outcome.Manifest
+	for _, fi := range []File{manifest.Provisioner, manifest.Settings} {
+		if fi.Name == "" || fi.Name != path.Base(fi.Name) || fi.SHA256 == "" {
+			return outcome, errorf("%s: invalid file entry: %+v", ManifestName, fi)
+		}
+	}
+
+	sum := sha256.Sum256(manifestBuf)
+	manifestHash := hex.EncodeToString(sum[:])
+	appliedPath := path.Join(cfg.StateDir, appliedName)
+	appliedHash, appliedCreated := readApplied(appliedPath)
+	if appliedHash == manifestHash && !cfg.Force {
+		log.Info("bundle-unchanged", "manifest-sha256", manifestHash)
+		return outcome, nil
+	}
+	if manifest.Created.Before(appliedCreated) && !cfg.Force {
+		return outcome, errorf("refusing bundle created %s, older than the applied "+
+			"one (created %s): possible rollback attack, force to apply it anyway",
+			manifest.Created.Format(time.RFC3339), appliedCreated.Format(time.RFC3339))
+	}
+
+	bundleDir := path.Join(cfg.StateDir, "bundle")
+	if err := florist.MkdirAll(bundleDir, 0o700); err != nil {
+		return outcome, errorf("%s", err)
+	}
+	exe, err := florist.NetFetch(cfg.Client, baseURL+"/"+manifest.Provisioner.Name,
+		florist.SHA256, manifest.Provisioner.SHA256, bundleDir)
+	if err != nil {
+		return outcome, errorf("%s", err)
+	}
+	if err := os.Chmod(florist.Path(exe), 0o755); err != nil {
+		return outcome, errorf("%s", err)
+	}
+	settings, err := florist.NetFetch(cfg.Client, baseURL+"/"+manifest.Settings.Name,
+		florist.SHA256, manifest.Settings.SHA256, bundleDir)
+	if err != nil {
+		return outcome, errorf("%s", err)
+	}
+	if err := os.Chmod(florist.Path(settings), 0o600); err != nil {
+		return outcome, errorf("%s", err)
+	}
+
+	log.Info("bundle-changed-configuring", "manifest-sha256", manifestHash,
+		"created", manifest.Created)
+	cmd := exec.Command(florist.Path(exe), "configure",
+		"--settings="+florist.Path(settings))
+	outcome.Configured = true
+	if err := florist.CmdRun(log, cmd); err != nil {
+		return outcome, errorf("configure: %s", err)
+	}
+
+	applied := manifestHash + " " + manifest.Created.Format(time.RFC3339) + "\n"
+	if err := florist.WriteFile(appliedPath, applied, 0o600, "root", "root"); err != nil {
+		return outcome, errorf("%s", err)
+	}
+	return outcome, nil
+}
+
+// readApplied returns the SHA-256 and the creation time of the manifest of the last
+// bundle configured successfully, as recorded in file 'appliedPath'. They are empty
+// if the file does not exist or if it has been written by a previous version,
+// which recorded only the SHA-256.
+func readApplied(appliedPath string) (string, time.Time) {
+	buf, err := florist.ReadFile(appliedPath)
+	if err != nil {
+		return "", time.Time{}
+	}
+	fields := strings.Fields(string(buf))
+	if len(fields) == 0 {
+		return "", time.Time{}
+	}
+	if len(fields) < 2 {
+		return fields[0], time.Time{}
+	}
+	created, err := time.Parse(time.RFC3339, fields[1])
+	if err != nil {
+		return fields[0], time.Time{}
+	}
+	return fields[0], created
+}
+
+// fetch returns the contents of 'url', which must be small.
+func fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received %d %s (GET %s)", resp.StatusCode,
+			http.StatusText(resp.StatusCode), url)
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %s", url, err)
+	}
+	if len(buf) > maxManifestSize {
+		return nil, fmt.Errorf("GET %s: response too big", url)
+	}
+	return buf, nil
+}
+
+// Publish creates in directory 'dstDir' a bundle with the provisioner binary
+// 'provisioner' and the settings file 'settings', signed with 'privateKey'. The
+// directory can then be uploaded to the HTTP server.
+func Publish(dstDir string, provisioner string, settings string,
+	privateKey ed25519.PrivateKey,
+) (Manifest, error) {
+	errorf := internal.MakeErrorf("pull.Publish")
+	manifest := Manifest{Created: time.Now().UTC().Round(time.Second)}
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return manifest, errorf("%s", err)
+	}
+
+	copyHash := func(src string, name string) (File, error) {
+		buf, err := os.ReadFile(src)
+		if err != nil {
+			return File{}, err
+		}
+		if err := os.WriteFile(filepath.Join(dstDir, name), buf, 0o644); err != nil {
+			return File{}, err
+		}
+		sum := sha256.Sum256(buf)
+		return File{Name: name, SHA256: hex.EncodeToString(sum[:])}, nil
+	}
+	var err error
+	manifest.Provisioner, err = copyHash(provisioner, filepath.Base(provisioner))
+	if err != nil {
+		return manifest, errorf("%s", err)
+	}
+	manifest.Settings, err = copyHash(settings, "config.json")
+	if err != nil {
+		return manifest, errorf("%s", err)
+	}
+	if manifest.Provisioner.Name == manifest.Settings.Name {
+		return manifest, errorf("provisioner cannot be named %s", manifest.Settings.Name)
+	}
+
+	manifestBuf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, errorf("%s", err)
+	}
+	manifestBuf = append(manifestBuf, '\n')
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, manifestBuf))
+	// A client racing with Publish fails the signature verification and will retry
+	// at the next run.
+	if err := os.WriteFile(filepath.Join(dstDir, SignatureName), []byte(sig+"\n"),
+		0o644); err != nil {
+		return manifest, errorf("%s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dstDir, ManifestName), manifestBuf,
+		0o644); err != nil {
+		return manifest, errorf("%s", err)
+	}
+	return manifest, nil
+}
+
+// Verify checks that 'sig' (base64-encoded) is a valid signature of 'data' by
+// 'publicKey'.
+func Verify(publicKey ed25519.PublicKey, data []byte, sig []byte) error {
+	rawSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("signature: %s", err)
+	}
+	if !ed25519.Verify(publicKey, data, rawSig) {
+		return fmt.Errorf("signature: verification failed")
+	}
+	return nil
+}
+
+// GenerateKey returns a new key pair, base64-encoded. See [ParsePublicKey] and
+// [ParsePrivateKey].
+func GenerateKey() (publicKey string, privateKey string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("pull.GenerateKey: %s", err)
+	}
+	return base64.StdEncoding.EncodeToString(pub),
+		base64.StdEncoding.EncodeToString(priv.Seed()), nil
+}
+
+// ParsePublicKey parses a base64-encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("pull.ParsePublicKey: %s", err)
+	}
+	if len(buf) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("pull.ParsePublicKey: invalid size: %d", len(buf))
+	}
+	return ed25519.PublicKey(buf), nil
+}
+
+// ParsePrivateKey parses a base64-encoded ed25519 private key seed.
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("pull.ParsePrivateKey: %s", err)
+	}
+	if len(buf) != ed25519.SeedSize {
+		return nil, fmt.Errorf("pull.ParsePrivateKey: invalid size: %d", len(buf))
+	}
+	return ed25519.NewKeyFromSeed(buf), nil
+}
@@ -0,0 +1,262 @@
+package pull_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/flowertest"
+	"github.com/marco-m/florist/pkg/pull"
+)
+
+// configureCmd returns the command line of the configure run by Pull, with the
+// paths below the root set by setup.
+func configureCmd() string {
+	return florist.Path("/opt/florist/pull/bundle/provisioner") + " configure " +
+		"--settings=" + florist.Path("/opt/florist/pull/bundle/config.json")
+}
+
+// publisher publishes bundles to a test HTTP server.
+type publisher struct {
+	t          *testing.T
+	srcDir     string
+	dstDir     string
+	url        string
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+func newPublisher(t *testing.T) *publisher {
+	pubKey, privKey := generateKey(t)
+	pb := &publisher{
+		t:          t,
+		srcDir:     t.TempDir(),
+		dstDir:     t.TempDir(),
+		publicKey:  pubKey,
+		privateKey: privKey,
+	}
+	srv := httptest.NewServer(http.FileServer(http.Dir(pb.dstDir)))
+	t.Cleanup(srv.Close)
+	pb.url = srv.URL + "/"
+	return pb
+}
+
+func (pb *publisher) publish(settings string) {
+	pb.t.Helper()
+	prov := filepath.Join(pb.srcDir, "provisioner")
+	assert.NoError(pb.t, os.WriteFile(prov, []byte("#!/bin/true\n"), 0o755), "write")
+	cfg := filepath.Join(pb.srcDir, "settings.json")
+	assert.NoError(pb.t, os.WriteFile(cfg, []byte(settings), 0o644), "write")
+	_, err := pull.Publish(pb.dstDir, prov, cfg, pb.privateKey)
+	assert.NoError(pb.t, err, "pull.Publish")
+}
+
+// backdate rewrites the manifest of the published bundle as if it had been created
+// 'd' earlier, signing it again: this is an older bundle, validly signed.
+func (pb *publisher) backdate(d time.Duration) {
+	pb.t.Helper()
+	fpath := filepath.Join(pb.dstDir, pull.ManifestName)
+	buf, err := os.ReadFile(fpath)
+	assert.NoError(pb.t, err, "os.ReadFile")
+	var manifest pull.Manifest
+	assert.NoError(pb.t, json.Unmarshal(buf, &manifest), "json.Unmarshal")
+	manifest.Created = manifest.Created.Add(-d)
+	buf, err = json.Marshal(manifest)
+	assert.NoError(pb.t, err, "json.Marshal")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(pb.privateKey, buf))
+	assert.NoError(pb.t, os.WriteFile(fpath, buf, 0o644), "os.WriteFile")
+	assert.NoError(pb.t, os.WriteFile(filepath.Join(pb.dstDir, pull.SignatureName),
+		[]byte(sig), 0o644), "os.WriteFile")
+}
+
+func generateKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+	pubStr, privStr, err := pull.GenerateKey()
+	assert.NoError(t, err, "pull.GenerateKey")
+	pub, err := pull.ParsePublicKey(pubStr)
+	assert.NoError(t, err, "pull.ParsePublicKey")
+	priv, err := pull.ParsePrivateKey(privStr)
+	assert.NoError(t, err, "pull.ParsePrivateKey")
+	return pub, priv
+}
+
+// setup makes the florist operations hermetic, without the fake HTTP server of
+// flowertest.New, since the bundle is served by the publisher.
+func setup(t *testing.T) *florist.FakeRunner {
+	assert.NoError(t, florist.SetRoot(t.TempDir()), "florist.SetRoot")
+	fake := florist.NewFakeRunner()
+	florist.SetRunner(fake)
+	t.Cleanup(func() {
+		florist.SetRunner(nil)
+		florist.SetRoot("/")
+	})
+	return fake
+}
+
+func TestPullConfiguresOnlyWhenChanged(t *testing.T) {
+	fake := setup(t)
+	pb := newPublisher(t)
+	pb.publish(`{"color": "red"}`)
+	cfg := pull.Config{URL: pb.url, PublicKey: pb.publicKey}
+
+	type step struct {
+		name           string
+		settings       string // if not empty, publish a new bundle
+		force          bool
+		wantConfigured bool
+	}
+	steps := []step{
+		{name: "first pull", wantConfigured: true},
+		{name: "same bundle", wantConfigured: false},
+		{name: "new bundle", settings: `{"color": "blue"}`, wantConfigured: true},
+		{name: "force", force: true, wantConfigured: true},
+	}
+
+	for _, st := range steps {
+		fake.Reset()
+		if st.settings != "" {
+			pb.publish(st.settings)
+		}
+		cfg.Force = st.force
+
+		outcome, err := pull.Pull(cfg)
+		assert.NoError(t, err, st.name+": pull.Pull")
+
+		assert.Equal(t, outcome.Configured, st.wantConfigured, st.name+": configured")
+		var wantCalls []string
+		if st.wantConfigured {
+			wantCalls = []string{configureCmd()}
+		}
+		assert.DeepEqual(t, fake.Calls(), wantCalls, st.name+": commands")
+	}
+	assert.FileEqualsString(t, florist.Path("/opt/florist/pull/bundle/config.json"),
+		`{"color": "blue"}`)
+}
+
+func TestPullFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		tamper  func(pb *publisher, cfg *pull.Config)
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		fake := setup(t)
+		pb := newPublisher(t)
+		pb.publish(`{}`)
+		cfg := pull.Config{URL: pb.url, PublicKey: pb.publicKey}
+		tc.tamper(pb, &cfg)
+
+		outcome, err := pull.Pull(cfg)
+
+		assert.ErrorContains(t, err, tc.wantErr, "pull.Pull")
+		assert.True(t, !outcome.Configured, "outcome.Configured")
+		assert.DeepEqual(t, fake.Calls(), []string(nil), "commands")
+	}
+
+	testCases := []testCase{
+		{
+			name: "wrong public key",
+			tamper: func(pb *publisher, cfg *pull.Config) {
+				cfg.PublicKey, _ = generateKey(pb.t)
+			},
+			wantErr: "pull.Pull: signature: verification failed",
+		},
+		{
+			name: "tampered manifest",
+			tamper: func(pb *publisher, cfg *pull.Config) {
+				fpath := filepath.Join(pb.dstDir, pull.ManifestName)
+				buf, _ := os.ReadFile(fpath)
+				os.WriteFile(fpath, append(buf, ' '), 0o644)
+			},
+			wantErr: "pull.Pull: signature: verification failed",
+		},
+		{
+			name: "tampered settings",
+			tamper: func(pb *publisher, cfg *pull.Config) {
+				fpath := filepath.Join(pb.dstDir, "config.json")
+				os.WriteFile(fpath, []byte(`{"evil": "yes"}`), 0o644)
+			},
+			wantErr: "pull.Pull: NetFetch: hash mismatch",
+		},
+		{
+			name: "no bundle",
+			tamper: func(pb *publisher, cfg *pull.Config) {
+				cfg.URL += "nope/"
+			},
+			wantErr: "pull.Pull: received 404 Not Found",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestPullRefusesRollback(t *testing.T) {
+	fake := setup(t)
+	pb := newPublisher(t)
+	pb.publish(`{"color": "red"}`)
+	cfg := pull.Config{URL: pb.url, PublicKey: pb.publicKey}
+	outcome, err := pull.Pull(cfg)
+	assert.NoError(t, err, "pull.Pull")
+	assert.True(t, outcome.Configured, "outcome.Configured")
+
+	// An older bundle, validly signed.
+	pb.publish(`{"color": "blue"}`)
+	pb.backdate(time.Hour)
+	fake.Reset()
+	outcome, err = pull.Pull(cfg)
+	assert.ErrorContains(t, err, "possible rollback attack", "pull.Pull")
+	assert.True(t, !outcome.Configured, "outcome.Configured")
+	assert.DeepEqual(t, fake.Calls(), []string(nil), "commands")
+
+	cfg.Force = true
+	outcome, err = pull.Pull(cfg)
+	assert.NoError(t, err, "pull.Pull")
+	assert.True(t, outcome.Configured, "outcome.Configured")
+	assert.FileEqualsString(t, florist.Path("/opt/florist/pull/bundle/config.json"),
+		`{"color": "blue"}`)
+}
+
+func TestPullConfigureFailureIsRetried(t *testing.T) {
+	fake := setup(t)
+	pb := newPublisher(t)
+	pb.publish(`{}`)
+	cfg := pull.Config{URL: pb.url, PublicKey: pb.publicKey}
+
+	fake.On(configureCmd(), "", errors.New("exit status 1"))
+	outcome, err := pull.Pull(cfg)
+	assert.ErrorContains(t, err, "pull.Pull: configure: exit status 1", "pull.Pull")
+	assert.True(t, outcome.Configured, "outcome.Configured")
+
+	fake.On(configureCmd(), "", nil)
+	outcome, err = pull.Pull(cfg)
+	assert.NoError(t, err, "pull.Pull")
+	assert.True(t, outcome.Configured, "outcome.Configured")
+}
+
+func TestInstallTimer(t *testing.T) {
+	h := flowertest.New(t)
+
+	err := pull.InstallTimer(pull.TimerConfig{
+		Command: []string{"/usr/local/bin/prov", "pull", "--url=http://x/100%"},
+	})
+	assert.NoError(t, err, "pull.InstallTimer")
+
+	h.AssertFileContains("/etc/systemd/system/florist-pull.service",
+		`ExecStart="/usr/local/bin/prov" "pull" "--url=http://x/100%%"`)
+	h.AssertFileContains("/etc/systemd/system/florist-pull.timer",
+		"OnUnitActiveSec=3600s\nRandomizedDelaySec=360s\n")
+	h.AssertCommands("systemctl daemon-reload", "systemctl enable --now florist-pull.timer")
+}
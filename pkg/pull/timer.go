@@ -0,0 +1,93 @@
+package pull
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/marco-m/florist/internal"
+	"github.com/marco-m/florist/pkg/florist"
+	"github.com/marco-m/florist/pkg/systemd"
+)
+
+// UnitName is the name (without suffix) of the systemd service and timer installed
+// by [InstallTimer].
+const UnitName = "florist-pull"
+
+// TimerConfig is the configuration of [InstallTimer].
+type TimerConfig struct {
+	// Command line run by the service, for example
+	// []string{"/usr/local/bin/example", "pull", "--url=...", "--public-key=..."}.
+	Command []string
+	// Time between two runs. Default: 1h.
+	Interval time.Duration
+}
+
+// InstallTimer installs and starts a systemd service and timer that run
+// cfg.Command every cfg.Interval (with a random delay, to spread the load of a fleet
+// on the HTTP server) and 5 minutes after boot. The output of the command goes to
+// the journal: journalctl -u florist-pull.
+func InstallTimer(cfg TimerConfig) error {
+	errorf := internal.MakeErrorf("pull.InstallTimer")
+	if len(cfg.Command) == 0 {
+		return errorf("missing Command")
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Hour
+	}
+
+	quoted := make([]string, 0, len(cfg.Command))
+	for _, arg := range cfg.Command {
+		// systemd unit files accept C-style quoting. Escape also '%', the specifier.
+		arg = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(arg)
+		quoted = append(quoted, `"`+arg+`"`)
+	}
+	service := fmt.Sprintf(`[Unit]
+Description=florist pull: configure from the latest signed bundle
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, strings.Join(quoted, " "))
+
+	timer := fmt.Sprintf(`[Unit]
+Description=florist pull: run periodically
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%s
+RandomizedDelaySec=%s
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, systemdSpan(cfg.Interval), systemdSpan(cfg.Interval/10))
+
+	if err := florist.MkdirAll(systemd.UnitDir, 0o755); err != nil {
+		return errorf("%s", err)
+	}
+	for name, contents := range map[string]string{
+		UnitName + ".service": service,
+		UnitName + ".timer":   timer,
+	} {
+		dst := path.Join(systemd.UnitDir, name)
+		if err := florist.WriteFile(dst, contents, 0o644, "root", "root"); err != nil {
+			return errorf("%s", err)
+		}
+	}
+	if err := systemd.DaemonReload(); err != nil {
+		return errorf("%s", err)
+	}
+	if err := systemd.EnableNow(UnitName + ".timer"); err != nil {
+		return errorf("%s", err)
+	}
+	return nil
+}
+
+// systemdSpan formats 'd' as a systemd time span, in seconds.
+func systemdSpan(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d.Round(time.Second)/time.Second))
+}
@@ -0,0 +1,97 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// HealthCheck tells if 'host', just provisioned, is healthy. It should retry until
+// 'ctx' is done; see [RolloutConfig.HealthTimeout].
+type HealthCheck func(ctx context.Context, host Host) error
+
+// WaitForConn waits until a TCP connection to 'address' ("host:port") succeeds,
+// trying every 'pollInterval', or until 'ctx' is done.
+func WaitForConn(ctx context.Context, address string, pollInterval time.Duration) error {
+	var dialer net.Dialer
+	for {
+		dialCtx, cancel := context.WithTimeout(ctx, pollInterval)
+		conn, err := dialer.DialContext(dialCtx, "tcp", address)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("WaitForConn: %s: %s (last error: %s)", address,
+				ctx.Err(), err)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// ConnHealthCheck returns a HealthCheck that waits until port 'port' of the host
+// accepts TCP connections. See [WaitForConn].
+func ConnHealthCheck(port string, pollInterval time.Duration) HealthCheck {
+	return func(ctx context.Context, host Host) error {
+		hostname := hostAddress(host)
+		if h, _, err := net.SplitHostPort(hostname); err == nil {
+			hostname = h
+		}
+		return WaitForConn(ctx, net.JoinHostPort(hostname, port), pollInterval)
+	}
+}
+
+// CommandHealthCheck returns a HealthCheck that runs 'command' on the host over SSH,
+// with the connection parameters of 'cfg', until it exits successfully. For example
+// "systemctl is-active nginx" or "curl -fsS http://localhost:8080/health".
+func CommandHealthCheck(cfg Config, command string, pollInterval time.Duration) HealthCheck {
+	return func(ctx context.Context, host Host) error {
+		var lastErr error
+		for {
+			if lastErr = runCommand(ctx, &cfg, hostAddress(host), command); lastErr == nil {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%q: %s (last error: %s)", command, ctx.Err(), lastErr)
+			case <-time.After(pollInterval):
+			}
+		}
+	}
+}
+
+// runCommand runs 'command' on the host at 'address'.
+func runCommand(ctx context.Context, cfg *Config, address string, command string) error {
+	client, err := dial(ctx, cfg, address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+	if err := session.Run(command); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func hostAddress(host Host) string {
+	if host.Address != "" {
+		return host.Address
+	}
+	return host.Name
+}
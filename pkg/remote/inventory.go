@@ -0,0 +1,132 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+)
+
+// Inventory describes a fleet of hosts, organized in groups, each host with its
+// own settings. It is read from a JSON file by [LoadInventory]:
+//
+//	{
+//	  "settings": {"log_server": "logs.example.com"},
+//	  "groups": {
+//	    "web": {"settings": {"nginx_workers": "4"}}
+//	  },
+//	  "hosts": [
+//	    {"name": "web1", "address": "10.0.0.11", "groups": ["web"]},
+//	    {"name": "web2", "address": "10.0.0.12:2222", "groups": ["web"],
+//	     "settings": {"nginx_workers": "8"}}
+//	  ]
+//	}
+//
+// The settings passed to the configure subcommand of a host are the inventory
+// settings, overlaid by the settings of each group of the host (in the order of
+// Host.Groups), overlaid by the settings of the host. The hosts are provisioned in
+// the order of the file.
+type Inventory struct {
+	Settings map[string]string `json:"settings"`
+	Groups   map[string]Group  `json:"groups"`
+	Hosts    []Host            `json:"hosts"`
+}
+
+// Group is a group of an [Inventory].
+type Group struct {
+	Settings map[string]string `json:"settings"`
+}
+
+// Host is a host of an [Inventory].
+type Host struct {
+	// Name of the host, used in the logs and in the results. Mandatory, unique.
+	Name string `json:"name"`
+	// Address of the host: "host" or "host:port". Default: Name.
+	Address string `json:"address"`
+	// Groups of the host. Each group must exist in Inventory.Groups.
+	Groups []string `json:"groups"`
+	// Settings of the host.
+	Settings map[string]string `json:"settings"`
+}
+
+// LoadInventory reads and validates the inventory file 'fpath'.
+func LoadInventory(fpath string) (*Inventory, error) {
+	buf, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, fmt.Errorf("remote.LoadInventory: %s", err)
+	}
+	var inv Inventory
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&inv); err != nil {
+		return nil, fmt.Errorf("remote.LoadInventory: %s: %s", fpath, err)
+	}
+	if err := inv.Validate(); err != nil {
+		return nil, fmt.Errorf("remote.LoadInventory: %s: %s", fpath, err)
+	}
+	return &inv, nil
+}
+
+// Validate checks that the host names are unique and that the groups exist.
+func (inv *Inventory) Validate() error {
+	seen := make(map[string]bool)
+	for i, host := range inv.Hosts {
+		if host.Name == "" {
+			return fmt.Errorf("host %d: missing name", i)
+		}
+		if seen[host.Name] {
+			return fmt.Errorf("host %s: duplicate name", host.Name)
+		}
+		if _, found := inv.Groups[host.Name]; found {
+			return fmt.Errorf("host %s: same name as a group", host.Name)
+		}
+		seen[host.Name] = true
+		for _, group := range host.Groups {
+			if _, found := inv.Groups[group]; !found {
+				return fmt.Errorf("host %s: unknown group %s", host.Name, group)
+			}
+		}
+	}
+	return nil
+}
+
+// Select returns the hosts matching 'patterns', each the name of a host or of a
+// group, in inventory order. If 'patterns' is empty, it returns all the hosts.
+func (inv *Inventory) Select(patterns ...string) ([]Host, error) {
+	if len(patterns) == 0 {
+		return inv.Hosts, nil
+	}
+	for _, pat := range patterns {
+		_, isGroup := inv.Groups[pat]
+		isHost := slices.ContainsFunc(inv.Hosts, func(h Host) bool { return h.Name == pat })
+		if !isGroup && !isHost {
+			return nil, fmt.Errorf("Inventory.Select: %s: no such host or group", pat)
+		}
+	}
+	var hosts []Host
+	for _, host := range inv.Hosts {
+		for _, pat := range patterns {
+			if host.Name == pat || slices.Contains(host.Groups, pat) {
+				hosts = append(hosts, host)
+				break
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// SettingsOf returns the settings of 'host', overlaying, in order: 'base' (can be
+// nil), the inventory settings, the settings of the groups of the host and the
+// settings of the host.
+func (inv *Inventory) SettingsOf(host Host, base map[string]string) map[string]string {
+	settings := make(map[string]string)
+	maps.Copy(settings, base)
+	maps.Copy(settings, inv.Settings)
+	for _, group := range host.Groups {
+		maps.Copy(settings, inv.Groups[group].Settings)
+	}
+	maps.Copy(settings, host.Settings)
+	return settings
+}
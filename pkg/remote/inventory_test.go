@@ -0,0 +1,103 @@
+package remote_test
+
+import (
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/remote"
+)
+
+func TestInventorySelectAndSettings(t *testing.T) {
+	inv, err := remote.LoadInventory("testdata/inventory.json")
+	assert.NoError(t, err, "remote.LoadInventory")
+
+	type testCase struct {
+		name     string
+		patterns []string
+		want     []string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		hosts, err := inv.Select(tc.patterns...)
+		assert.NoError(t, err, "inv.Select")
+		var names []string
+		for _, h := range hosts {
+			names = append(names, h.Name)
+		}
+		assert.DeepEqual(t, names, tc.want, "selected hosts")
+	}
+
+	testCases := []testCase{
+		{
+			name:     "all hosts",
+			patterns: nil,
+			want:     []string{"web1", "db1", "web2"},
+		},
+		{
+			name:     "group, in inventory order",
+			patterns: []string{"web"},
+			want:     []string{"web1", "web2"},
+		},
+		{
+			name:     "host and group",
+			patterns: []string{"web2", "db"},
+			want:     []string{"db1", "web2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+
+	hosts, err := inv.Select("web2")
+	assert.NoError(t, err, "inv.Select")
+	have := inv.SettingsOf(hosts[0], map[string]string{"base": "b", "region": "base"})
+	want := map[string]string{
+		"base":    "b",      // from base
+		"region":  "eu",     // from inventory
+		"workers": "8",      // from host, overriding group
+		"tls":     "on",     // from group
+		"role":    "canary", // from host
+	}
+	assert.DeepEqual(t, have, want, "settings")
+}
+
+func TestInventoryFailure(t *testing.T) {
+	type testCase struct {
+		name    string
+		inv     remote.Inventory
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		err := tc.inv.Validate()
+		assert.ErrorContains(t, err, tc.wantErr, "inv.Validate")
+	}
+
+	testCases := []testCase{
+		{
+			name:    "missing name",
+			inv:     remote.Inventory{Hosts: []remote.Host{{Address: "a"}}},
+			wantErr: "host 0: missing name",
+		},
+		{
+			name:    "duplicate name",
+			inv:     remote.Inventory{Hosts: []remote.Host{{Name: "a"}, {Name: "a"}}},
+			wantErr: "host a: duplicate name",
+		},
+		{
+			name:    "unknown group",
+			inv:     remote.Inventory{Hosts: []remote.Host{{Name: "a", Groups: []string{"x"}}}},
+			wantErr: "host a: unknown group x",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+
+	inv := remote.Inventory{}
+	_, err := inv.Select("nope")
+	assert.ErrorContains(t, err, "Inventory.Select: nope: no such host or group", "inv.Select")
+}
@@ -0,0 +1,414 @@
+// Package remote pushes a provisioner binary to one or more hosts over SSH and runs
+// it there, as an alternative to copying it by hand or via Packer.
+//
+// For each host, [Run] uploads the provisioner binary (and optionally the settings
+// file) to [florist.WorkDir], runs the requested subcommands (install, configure)
+// with sudo, streams their output prefixed by the host name and returns a [Result]
+// that can be marshaled to JSON.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/marco-m/florist/internal"
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+// SettingsName is the name of the settings file uploaded to Config.RemoteDir.
+const SettingsName = "config.json"
+
+// Config is the configuration of [Run].
+type Config struct {
+	// Local path of the provisioner binary. Mandatory.
+	Binary string
+	// Local path of the settings file (JSON), passed to the configure subcommand.
+	// Optional.
+	Settings string
+	// The provisioner subcommands to run, in order. Default: install, configure.
+	Phases []string
+	// Extra arguments passed to the provisioner before the subcommand, for example
+	// "--log-level=DEBUG".
+	Args []string
+
+	// SSH user. Mandatory.
+	User string
+	// SSH authentication methods, for example ssh.PublicKeys. Mandatory.
+	Auth []ssh.AuthMethod
+	// Verifies the host keys, for example knownhosts.New. Mandatory.
+	HostKeyCallback ssh.HostKeyCallback
+	// Timeout to establish the SSH connection. Default: 30s.
+	DialTimeout time.Duration
+
+	// Directory on the host where to upload the files. Default: florist.WorkDir.
+	RemoteDir string
+	// If true, upload the files and run the provisioner directly instead of via
+	// "sudo -n". Useful when the SSH user is root.
+	NoSudo bool
+	// Maximum number of hosts provisioned at the same time. Default: all.
+	Parallel int
+	// Output of the provisioners, each line prefixed with the host name.
+	// Default: os.Stdout.
+	LogOutput io.Writer
+}
+
+// Result is the outcome of provisioning one host.
+type Result struct {
+	Host    string        `json:"host"`
+	OK      bool          `json:"ok"`
+	Error   string        `json:"error,omitempty"`
+	Start   time.Time     `json:"start"`
+	Elapsed time.Duration `json:"elapsed"`
+	Phases  []PhaseResult `json:"phases"`
+}
+
+// PhaseResult is the outcome of running one provisioner subcommand on a host.
+type PhaseResult struct {
+	Phase    string        `json:"phase"`
+	ExitCode int           `json:"exit_code"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// Run provisions 'hosts' (in the form "host" or "host:port") as configured by 'cfg',
+// and returns one Result per host, in the same order. A failure on a host does not
+// stop the other hosts; the returned error is about the configuration only. To know
+// if all hosts succeeded, use [Failed].
+func Run(ctx context.Context, cfg Config, hosts []string) ([]Result, error) {
+	errorf := internal.MakeErrorf("remote.Run")
+	if err := cfg.setDefaults(); err != nil {
+		return nil, errorf("%s", err)
+	}
+	var settings []byte
+	if cfg.Settings != "" {
+		var err error
+		if settings, err = os.ReadFile(cfg.Settings); err != nil {
+			return nil, errorf("%s", err)
+		}
+	}
+	targets := make([]target, 0, len(hosts))
+	for _, host := range hosts {
+		targets = append(targets, target{name: host, address: host, settings: settings})
+	}
+	results, err := runTargets(ctx, &cfg, targets)
+	if err != nil {
+		return nil, errorf("%s", err)
+	}
+	return results, nil
+}
+
+// target is a host to provision, with its own settings.
+type target struct {
+	name     string
+	address  string
+	settings []byte
+}
+
+// runTargets provisions 'targets', at most cfg.Parallel at a time. The defaults of
+// 'cfg' must have been already applied.
+func runTargets(ctx context.Context, cfg *Config, targets []target) ([]Result, error) {
+	binary, err := os.ReadFile(cfg.Binary)
+	if err != nil {
+		return nil, err
+	}
+	parallel := cfg.Parallel
+	if parallel <= 0 {
+		parallel = len(targets)
+	}
+
+	var outMu sync.Mutex
+	results := make([]Result, len(targets))
+	sem := make(chan struct{}, max(parallel, 1))
+	var wg sync.WaitGroup
+	for i, tg := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			pv := provisioning{
+				cfg:    cfg,
+				target: tg,
+				binary: binary,
+				out:    newPrefixWriter(&outMu, cfg.LogOutput, tg.name),
+				errOut: newPrefixWriter(&outMu, cfg.LogOutput, tg.name),
+			}
+			results[i] = pv.run(ctx)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// setDefaults validates 'cfg' and sets the defaults of the missing fields.
+func (cfg *Config) setDefaults() error {
+	if cfg.Binary == "" {
+		return fmt.Errorf("missing Binary")
+	}
+	if cfg.User == "" {
+		return fmt.Errorf("missing User")
+	}
+	if len(cfg.Auth) == 0 {
+		return fmt.Errorf("missing Auth")
+	}
+	if cfg.HostKeyCallback == nil {
+		return fmt.Errorf("missing HostKeyCallback")
+	}
+	if len(cfg.Phases) == 0 {
+		cfg.Phases = []string{"install", "configure"}
+	}
+	for _, phase := range cfg.Phases {
+		if phase != "install" && phase != "configure" {
+			return fmt.Errorf("unknown phase %q (want install or configure)", phase)
+		}
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = 30 * time.Second
+	}
+	if cfg.RemoteDir == "" {
+		cfg.RemoteDir = florist.WorkDir
+	}
+	if cfg.LogOutput == nil {
+		cfg.LogOutput = os.Stdout
+	}
+	return nil
+}
+
+// Failed returns the hosts that were not provisioned successfully.
+func Failed(results []Result) []string {
+	var failed []string
+	for _, res := range results {
+		if !res.OK {
+			failed = append(failed, res.Host)
+		}
+	}
+	return failed
+}
+
+// provisioning is the provisioning of a single host.
+type provisioning struct {
+	cfg    *Config
+	target target
+	binary []byte
+	// One writer per stream of the provisioner, each with its own buffer, so
+	// that stdout and stderr cannot mix within a line.
+	out    *prefixWriter
+	errOut *prefixWriter
+}
+
+func (pv *provisioning) run(ctx context.Context) Result {
+	res := Result{Host: pv.target.name, Start: time.Now()}
+	err := pv.provision(ctx, &res)
+	pv.out.Flush()
+	pv.errOut.Flush()
+	res.Elapsed = time.Since(res.Start)
+	if err != nil {
+		res.Error = err.Error()
+		fmt.Fprintf(pv.out, "error: %s\n", err)
+		pv.out.Flush()
+		return res
+	}
+	res.OK = true
+	return res
+}
+
+func (pv *provisioning) provision(ctx context.Context, res *Result) error {
+	client, err := pv.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	// Interrupt any running session when the context is canceled.
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
+
+	exe := path.Join(pv.cfg.RemoteDir, filepath.Base(pv.cfg.Binary))
+	if err := upload(client, pv.binary, exe, "0755", pv.cfg.NoSudo); err != nil {
+		return fmt.Errorf("upload %s: %s", exe, err)
+	}
+	settings := path.Join(pv.cfg.RemoteDir, SettingsName)
+	if pv.target.settings != nil {
+		if err := upload(client, pv.target.settings, settings, "0600",
+			pv.cfg.NoSudo); err != nil {
+			return fmt.Errorf("upload %s: %s", settings, err)
+		}
+	}
+
+	for _, phase := range pv.cfg.Phases {
+		args := []string{exe}
+		args = append(args, pv.cfg.Args...)
+		args = append(args, phase)
+		if phase == "configure" && pv.target.settings != nil {
+			args = append(args, "--settings="+settings)
+		}
+		if !pv.cfg.NoSudo {
+			args = append([]string{"sudo", "-n"}, args...)
+		}
+
+		start := time.Now()
+		exitCode, err := pv.exec(client, args)
+		res.Phases = append(res.Phases, PhaseResult{
+			Phase: phase, ExitCode: exitCode, Elapsed: time.Since(start),
+		})
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %s", phase, ctx.Err())
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", phase, err)
+		}
+	}
+	return nil
+}
+
+func (pv *provisioning) dial(ctx context.Context) (*ssh.Client, error) {
+	return dial(ctx, pv.cfg, pv.target.address)
+}
+
+// dial opens an SSH connection to 'address' ("host" or "host:port").
+func dial(ctx context.Context, cfg *Config, address string) (*ssh.Client, error) {
+	addr := address
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	sshCfg := &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            cfg.Auth,
+		HostKeyCallback: cfg.HostKeyCallback,
+		Timeout:         cfg.DialTimeout,
+	}
+	dialer := net.Dialer{Timeout: cfg.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// The SSH handshake has no context: bound it with the dial timeout.
+	conn.SetDeadline(time.Now().Add(cfg.DialTimeout))
+	cconn, chans, reqs, err := ssh.NewClientConn(conn, addr, sshCfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(cconn, chans, reqs), nil
+}
+
+// exec runs command 'args' on the host, streaming its output, and returns its exit
+// code.
+func (pv *provisioning) exec(client *ssh.Client, args []string) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+	session.Stdout = pv.out
+	session.Stderr = pv.errOut
+
+	err = session.Run(shellJoin(args))
+	pv.out.Flush()
+	pv.errOut.Flush()
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), err
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// upload writes 'contents' to file 'dst' on the host, with mode 'mode'. Since 'dst'
+// is in a directory that the provisioner, running as root, makes owned by root, the
+// SSH user first writes to a temporary directory of its own and then, with "sudo -n"
+// unless 'noSudo', moves the file into place with install(1). Install replaces
+// 'dst' instead of writing into it, to avoid "text file busy" errors when 'dst' is
+// an executable left running by a previous provisioning.
+func upload(client *ssh.Client, contents []byte, dst string, mode string, noSudo bool) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	var stderr bytes.Buffer
+	session.Stdin = bytes.NewReader(contents)
+	session.Stderr = &stderr
+
+	sudo := "sudo -n "
+	if noSudo {
+		sudo = ""
+	}
+	script := fmt.Sprintf(`tmp=$(mktemp -d) && trap 'rm -rf "$tmp"' EXIT && `+
+		`cat > "$tmp/upload" && %sinstall -D -m %s "$tmp/upload" %s`,
+		sudo, mode, shellQuote(dst))
+	if err := session.Run(script); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// shellJoin returns 'args' quoted for the POSIX shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote returns 's' quoted for the POSIX shell, only if needed.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func newPrefixWriter(mu *sync.Mutex, out io.Writer, name string) *prefixWriter {
+	return &prefixWriter{mu: mu, out: out, prefix: name + " | "}
+}
+
+// prefixWriter writes to 'out' complete lines prefixed by 'prefix'. The mutex is
+// shared by the writers of all the hosts, so that lines do not get interleaved.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(pw.out, "%s%s", pw.prefix, pw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line, if not terminated by a newline.
+func (pw *prefixWriter) Flush() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if len(pw.buf) > 0 {
+		fmt.Fprintf(pw.out, "%s%s\n", pw.prefix, pw.buf)
+		pw.buf = nil
+	}
+}
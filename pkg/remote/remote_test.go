@@ -0,0 +1,276 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marco-m/rosina/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/marco-m/florist/pkg/remote"
+)
+
+// provisionerScript stands in for a provisioner binary.
+const provisionerScript = `#!/bin/sh
+echo "running $*"
+for arg; do
+    case "$arg" in --settings=*) cat "${arg#--settings=}"; echo ;; esac
+done
+case "$FAIL_CONFIGURE $* " in
+"1 "*" configure "*)
+    echo "configure failed" >&2
+    exit 3
+    ;;
+esac
+`
+
+func TestRunSuccess(t *testing.T) {
+	srv := newSSHServer(t, newSigner(t), "")
+	remoteDir := t.TempDir()
+	var out bytes.Buffer
+	cfg := srv.config(t, remoteDir, &out)
+	cfg.Settings = writeFile(t, "settings.json", `{"foo": "bar"}`)
+
+	results, err := remote.Run(context.Background(), cfg, []string{srv.addr})
+	assert.NoError(t, err, "remote.Run")
+
+	assert.Equal(t, len(results), 1, "len(results)")
+	res := results[0]
+	assert.True(t, res.OK, "result OK, error: "+res.Error)
+	assert.Equal(t, res.Host, srv.addr, "host")
+	assert.Equal(t, len(res.Phases), 2, "len(phases)")
+	assert.Equal(t, res.Phases[1].Phase, "configure", "phase")
+	assert.DeepEqual(t, remote.Failed(results), []string(nil), "failed")
+
+	exe := filepath.Join(remoteDir, "provisioner")
+	settings := filepath.Join(remoteDir, remote.SettingsName)
+	assert.FileEqualsString(t, exe, provisionerScript)
+	assert.FileEqualsString(t, settings, `{"foo": "bar"}`)
+	want := srv.addr + " | running --log-level=DEBUG install\n" +
+		srv.addr + " | running --log-level=DEBUG configure --settings=" + settings + "\n" +
+		srv.addr + ` | {"foo": "bar"}` + "\n"
+	assert.Equal(t, out.String(), want, "output")
+}
+
+// sudoScript stands in for sudo, with the remote dir (%[1]s) playing the part of a
+// directory owned by root: only the commands run via sudo can write to it. It logs
+// its invocations to %[2]s.
+const sudoScript = `#!/bin/sh
+[ "$1" = -n ] && shift
+echo "sudo $*" >> %[2]s
+chmod u+w %[1]s 2> /dev/null
+"$@"
+rc=$?
+chmod a-w %[1]s
+exit $rc
+`
+
+func TestRunTwiceWithSudo(t *testing.T) {
+	binDir := t.TempDir()
+	remoteDir := filepath.Join(t.TempDir(), "florist")
+	t.Cleanup(func() { os.Chmod(remoteDir, 0o755) })
+	sudoLog := filepath.Join(t.TempDir(), "sudo.log")
+	assert.NoError(t, os.WriteFile(filepath.Join(binDir, "sudo"),
+		[]byte(fmt.Sprintf(sudoScript, remoteDir, sudoLog)), 0o755), "os.WriteFile")
+	srv := newSSHServer(t, newSigner(t), "PATH="+binDir+":"+os.Getenv("PATH"))
+	cfg := srv.config(t, remoteDir, &bytes.Buffer{})
+	cfg.Settings = writeFile(t, "settings.json", `{"foo": "bar"}`)
+	cfg.NoSudo = false
+
+	// The second run finds the remote dir owned by "root".
+	for i := range 2 {
+		results, err := remote.Run(context.Background(), cfg, []string{srv.addr})
+		assert.NoError(t, err, "remote.Run")
+		assert.True(t, results[0].OK, fmt.Sprintf("run %d: result OK, error: %s",
+			i, results[0].Error))
+	}
+
+	exe := filepath.Join(remoteDir, "provisioner")
+	assert.FileEqualsString(t, exe, provisionerScript)
+	assert.FileContains(t, sudoLog, "install -D -m 0755 ")
+	assert.FileContains(t, sudoLog, "sudo "+exe+" --log-level=DEBUG install\n")
+}
+
+func TestRunSeparatesStdoutAndStderr(t *testing.T) {
+	srv := newSSHServer(t, newSigner(t), "")
+	var out bytes.Buffer
+	cfg := srv.config(t, t.TempDir(), &out)
+	cfg.Binary = writeFile(t, "provisioner", `#!/bin/sh
+printf 'stdout begins, '
+sleep 0.1
+echo 'to stderr' >&2
+sleep 0.1
+echo 'stdout ends'
+`)
+	cfg.Phases = []string{"install"}
+
+	results, err := remote.Run(context.Background(), cfg, []string{srv.addr})
+	assert.NoError(t, err, "remote.Run")
+
+	assert.True(t, results[0].OK, "result OK, error: "+results[0].Error)
+	assert.True(t, strings.Contains(out.String(),
+		srv.addr+" | stdout begins, stdout ends\n"), "output:\n"+out.String())
+	assert.True(t, strings.Contains(out.String(), srv.addr+" | to stderr\n"),
+		"output:\n"+out.String())
+}
+
+func TestRunPhaseFailure(t *testing.T) {
+	clientKey := newSigner(t)
+	srvOK := newSSHServer(t, clientKey, "")
+	srvKO := newSSHServer(t, clientKey, "FAIL_CONFIGURE=1")
+	var out bytes.Buffer
+	cfg := srvOK.config(t, t.TempDir(), &out)
+	cfg.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+
+	results, err := remote.Run(context.Background(), cfg, []string{srvOK.addr, srvKO.addr})
+	assert.NoError(t, err, "remote.Run")
+
+	assert.DeepEqual(t, remote.Failed(results), []string{srvKO.addr}, "failed")
+	res := results[1]
+	assert.Equal(t, res.Error, "configure: Process exited with status 3", "error")
+	assert.Equal(t, res.Phases[1].ExitCode, 3, "exit code")
+	assert.True(t, strings.Contains(out.String(), srvKO.addr+" | configure failed\n"),
+		"output:\n"+out.String())
+}
+
+func TestRunHostKeyMismatch(t *testing.T) {
+	srv := newSSHServer(t, newSigner(t), "")
+	cfg := srv.config(t, t.TempDir(), &bytes.Buffer{})
+	cfg.HostKeyCallback = ssh.FixedHostKey(newSigner(t).PublicKey())
+
+	results, err := remote.Run(context.Background(), cfg, []string{srv.addr})
+	assert.NoError(t, err, "remote.Run")
+
+	assert.True(t, !results[0].OK, "result OK")
+	assert.True(t, strings.HasPrefix(results[0].Error, "ssh: handshake failed: "),
+		"error: "+results[0].Error)
+}
+
+func TestRunConfigFailure(t *testing.T) {
+	_, err := remote.Run(context.Background(), remote.Config{}, []string{"host"})
+	assert.ErrorContains(t, err, "remote.Run: missing Binary", "remote.Run")
+}
+
+func writeFile(t *testing.T, name string, contents string) string {
+	t.Helper()
+	fpath := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(fpath, []byte(contents), 0o755), "os.WriteFile")
+	return fpath
+}
+
+// sshServer is a minimal stand-in for sshd: it accepts a single client key and
+// runs the "exec" requests with the local shell, adding 'env' to the environment.
+type sshServer struct {
+	addr      string
+	hostKey   ssh.Signer
+	clientKey ssh.Signer
+	env       string
+}
+
+func newSSHServer(t *testing.T, clientKey ssh.Signer, env string) *sshServer {
+	t.Helper()
+	srv := &sshServer{hostKey: newSigner(t), clientKey: clientKey, env: env}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "net.Listen")
+	t.Cleanup(func() { lis.Close() })
+	srv.addr = lis.Addr().String()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+	return srv
+}
+
+func (srv *sshServer) config(t *testing.T, remoteDir string, out *bytes.Buffer) remote.Config {
+	return remote.Config{
+		Binary:          writeFile(t, "provisioner", provisionerScript),
+		Args:            []string{"--log-level=DEBUG"},
+		User:            "florist",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(srv.clientKey)},
+		HostKeyCallback: ssh.FixedHostKey(srv.hostKey.PublicKey()),
+		RemoteDir:       remoteDir,
+		NoSudo:          true,
+		LogOutput:       out,
+	}
+}
+
+func (srv *sshServer) serve(conn net.Conn) {
+	defer conn.Close()
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), srv.clientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, net.ErrClosed
+		},
+	}
+	cfg.AddHostKey(srv.hostKey)
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			return
+		}
+		go srv.session(ch, chReqs)
+	}
+}
+
+func (srv *sshServer) session(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" || len(req.Payload) < 4 {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		command := string(req.Payload[4:])
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Env = append(os.Environ(), srv.env)
+		cmd.Stdin = ch
+		cmd.Stdout = ch
+		cmd.Stderr = ch.Stderr()
+		status := uint32(0)
+		if err := cmd.Run(); err != nil {
+			status = 255
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				status = uint32(exitErr.ExitCode())
+			}
+		}
+		payload := binary.BigEndian.AppendUint32(nil, status)
+		ch.SendRequest("exit-status", false, payload)
+		return
+	}
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "ed25519.GenerateKey")
+	signer, err := ssh.NewSignerFromKey(priv)
+	assert.NoError(t, err, "ssh.NewSignerFromKey")
+	return signer
+}
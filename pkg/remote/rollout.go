@@ -0,0 +1,169 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marco-m/florist/internal"
+)
+
+// RolloutConfig is the configuration of [Rollout].
+type RolloutConfig struct {
+	// Number of hosts provisioned in each batch. Default: 1.
+	BatchSize int
+	// Number of failed hosts tolerated. When exceeded, the rollout is aborted after
+	// the current batch. Default: 0, that is abort at the first failure.
+	MaxFailures int
+	// If not nil, it is called for each host successfully provisioned in a batch,
+	// before starting the next batch. A host failing the health check counts as a
+	// failed host. See [ConnHealthCheck] and [CommandHealthCheck].
+	HealthCheck HealthCheck
+	// Timeout of the health check of a host. Default: 5m.
+	HealthTimeout time.Duration
+}
+
+// RolloutResult is the outcome of [Rollout].
+type RolloutResult struct {
+	// Results of the hosts provisioned, in order.
+	Results []Result `json:"results"`
+	// Hosts not provisioned because the rollout was aborted.
+	Skipped []string `json:"skipped,omitempty"`
+	// Why the rollout was aborted. Empty if not aborted.
+	Aborted string `json:"aborted,omitempty"`
+}
+
+// Err returns an error if the rollout was aborted or if any host failed.
+func (rr *RolloutResult) Err() error {
+	failed := Failed(rr.Results)
+	if rr.Aborted != "" {
+		return fmt.Errorf("rollout aborted: %s (failed: %s; skipped: %s)", rr.Aborted,
+			strings.Join(failed, ", "), strings.Join(rr.Skipped, ", "))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("rollout: failed hosts (%d/%d): %s", len(failed),
+			len(rr.Results), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Rollout provisions the hosts of 'inv' selected by 'patterns' (see
+// [Inventory.Select]) in batches of rcfg.BatchSize hosts, so that a faulty change
+// reaches only a part of the fleet. After each batch, it runs rcfg.HealthCheck on
+// the hosts of the batch; if the failed hosts exceed rcfg.MaxFailures, it aborts
+// the rollout, skipping the remaining hosts.
+//
+// The settings of each host are computed by [Inventory.SettingsOf], using the
+// settings file cfg.Settings (if any) as base. The returned error is about the
+// configuration only; to know the outcome of the rollout, use [RolloutResult.Err].
+func Rollout(ctx context.Context, cfg Config, rcfg RolloutConfig, inv *Inventory,
+	patterns ...string,
+) (*RolloutResult, error) {
+	errorf := internal.MakeErrorf("remote.Rollout")
+	if err := cfg.setDefaults(); err != nil {
+		return nil, errorf("%s", err)
+	}
+	if rcfg.BatchSize <= 0 {
+		rcfg.BatchSize = 1
+	}
+	if rcfg.HealthTimeout == 0 {
+		rcfg.HealthTimeout = 5 * time.Minute
+	}
+	var base map[string]string
+	if cfg.Settings != "" {
+		buf, err := os.ReadFile(cfg.Settings)
+		if err != nil {
+			return nil, errorf("%s", err)
+		}
+		if err := json.Unmarshal(buf, &base); err != nil {
+			return nil, errorf("%s: %s", cfg.Settings, err)
+		}
+	}
+	hosts, err := inv.Select(patterns...)
+	if err != nil {
+		return nil, errorf("%s", err)
+	}
+	targets := make([]target, 0, len(hosts))
+	for _, host := range hosts {
+		settings, err := json.MarshalIndent(inv.SettingsOf(host, base), "", "  ")
+		if err != nil {
+			return nil, errorf("%s", err)
+		}
+		targets = append(targets, target{
+			name: host.Name, address: hostAddress(host), settings: settings,
+		})
+	}
+
+	rr := &RolloutResult{}
+	batches := (len(targets) + rcfg.BatchSize - 1) / rcfg.BatchSize
+	failures := 0
+	for i := 0; i < len(targets); i += rcfg.BatchSize {
+		batch := targets[i:min(i+rcfg.BatchSize, len(targets))]
+		batchHosts := hosts[i:min(i+rcfg.BatchSize, len(targets))]
+		names := make([]string, 0, len(batch))
+		for _, tg := range batch {
+			names = append(names, tg.name)
+		}
+		fmt.Fprintf(cfg.LogOutput, "rollout: batch %d/%d: %s\n", i/rcfg.BatchSize+1,
+			batches, strings.Join(names, ", "))
+
+		results, err := runTargets(ctx, &cfg, batch)
+		if err != nil {
+			return nil, errorf("%s", err)
+		}
+		if rcfg.HealthCheck != nil {
+			healthCheck(ctx, &cfg, &rcfg, batchHosts, results)
+		}
+		rr.Results = append(rr.Results, results...)
+
+		failures += len(Failed(results))
+		switch {
+		case ctx.Err() != nil:
+			rr.Aborted = ctx.Err().Error()
+		case failures > rcfg.MaxFailures:
+			rr.Aborted = fmt.Sprintf("%d failed hosts, max failures: %d", failures,
+				rcfg.MaxFailures)
+		}
+		if rr.Aborted != "" {
+			for _, tg := range targets[i+len(batch):] {
+				rr.Skipped = append(rr.Skipped, tg.name)
+			}
+			fmt.Fprintf(cfg.LogOutput, "rollout: aborted: %s\n", rr.Aborted)
+			break
+		}
+	}
+	return rr, nil
+}
+
+// healthCheck runs in parallel the health check of the hosts provisioned
+// successfully, marking as failed the ones that fail it.
+func healthCheck(ctx context.Context, cfg *Config, rcfg *RolloutConfig, hosts []Host,
+	results []Result,
+) {
+	var outMu sync.Mutex
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		if !results[i].OK {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out := newPrefixWriter(&outMu, cfg.LogOutput, host.Name)
+			hctx, cancel := context.WithTimeout(ctx, rcfg.HealthTimeout)
+			defer cancel()
+			if err := rcfg.HealthCheck(hctx, host); err != nil {
+				results[i].OK = false
+				results[i].Error = fmt.Sprintf("health check: %s", err)
+				fmt.Fprintf(out, "health check: failed: %s\n", err)
+				return
+			}
+			fmt.Fprintf(out, "health check: ok\n")
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,159 @@
+package remote_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marco-m/rosina/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/marco-m/florist/pkg/remote"
+)
+
+// newFleet returns an inventory with one host per env (see newSSHServer), named
+// h1, h2, ... and a remote.Config to provision them.
+func newFleet(t *testing.T, envs ...string) (*remote.Inventory, remote.Config, *bytes.Buffer) {
+	t.Helper()
+	clientKey := newSigner(t)
+	inv := &remote.Inventory{Settings: map[string]string{"color": "red"}}
+	var srv *sshServer
+	for i, env := range envs {
+		srv = newSSHServer(t, clientKey, env)
+		inv.Hosts = append(inv.Hosts, remote.Host{
+			Name:     fmt.Sprintf("h%d", i+1),
+			Address:  srv.addr,
+			Settings: map[string]string{"id": fmt.Sprint(i + 1)},
+		})
+	}
+	var out bytes.Buffer
+	cfg := srv.config(t, t.TempDir(), &out)
+	cfg.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	return inv, cfg, &out
+}
+
+func TestRolloutSuccess(t *testing.T) {
+	inv, cfg, out := newFleet(t, "", "", "")
+	var checked []string
+	rcfg := remote.RolloutConfig{
+		BatchSize: 1,
+		HealthCheck: func(ctx context.Context, host remote.Host) error {
+			checked = append(checked, host.Name) // Batches of 1 host: no race.
+			return nil
+		},
+	}
+
+	rr, err := remote.Rollout(context.Background(), cfg, rcfg, inv)
+	assert.NoError(t, err, "remote.Rollout")
+
+	assert.NoError(t, rr.Err(), "rr.Err")
+	assert.Equal(t, len(rr.Results), 3, "len(results)")
+	assert.DeepEqual(t, checked, []string{"h1", "h2", "h3"}, "health checked")
+	for _, want := range []string{
+		"rollout: batch 1/3: h1\n",
+		"h2 | health check: ok\n",
+		`h3 |   "color": "red",` + "\n",
+		`h3 |   "id": "3"` + "\n",
+	} {
+		assert.True(t, strings.Contains(out.String(), want),
+			fmt.Sprintf("output does not contain %q:\n%s", want, out))
+	}
+}
+
+func TestRolloutAbort(t *testing.T) {
+	type testCase struct {
+		name        string
+		envs        []string
+		rcfg        remote.RolloutConfig
+		wantFailed  []string
+		wantSkipped []string
+		wantErr     string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		inv, cfg, _ := newFleet(t, tc.envs...)
+
+		rr, err := remote.Rollout(context.Background(), cfg, tc.rcfg, inv)
+		assert.NoError(t, err, "remote.Rollout")
+
+		assert.DeepEqual(t, remote.Failed(rr.Results), tc.wantFailed, "failed")
+		assert.DeepEqual(t, rr.Skipped, tc.wantSkipped, "skipped")
+		assert.ErrorContains(t, rr.Err(), tc.wantErr, "rr.Err")
+	}
+
+	failing := "FAIL_CONFIGURE=1"
+	testCases := []testCase{
+		{
+			name:        "abort at first failure",
+			envs:        []string{"", failing, "", ""},
+			rcfg:        remote.RolloutConfig{BatchSize: 1},
+			wantFailed:  []string{"h2"},
+			wantSkipped: []string{"h3", "h4"},
+			wantErr:     "rollout aborted: 1 failed hosts, max failures: 0",
+		},
+		{
+			name:        "tolerate failures",
+			envs:        []string{failing, "", failing, ""},
+			rcfg:        remote.RolloutConfig{BatchSize: 2, MaxFailures: 1},
+			wantFailed:  []string{"h1", "h3"},
+			wantSkipped: nil,
+			wantErr:     "rollout aborted: 2 failed hosts, max failures: 1",
+		},
+		{
+			name:        "all batches done with tolerated failure",
+			envs:        []string{"", failing, ""},
+			rcfg:        remote.RolloutConfig{BatchSize: 2, MaxFailures: 1},
+			wantFailed:  []string{"h2"},
+			wantSkipped: nil,
+			wantErr:     "rollout: failed hosts (1/3): h2",
+		},
+		{
+			name: "health check failure",
+			envs: []string{"", "", ""},
+			rcfg: remote.RolloutConfig{
+				BatchSize:     1,
+				HealthTimeout: 50 * time.Millisecond,
+				HealthCheck: func(ctx context.Context, host remote.Host) error {
+					if host.Name == "h1" {
+						<-ctx.Done()
+						return ctx.Err()
+					}
+					return nil
+				},
+			},
+			wantFailed:  []string{"h1"},
+			wantSkipped: []string{"h2", "h3"},
+			wantErr:     "rollout aborted: 1 failed hosts, max failures: 0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestConnHealthCheck(t *testing.T) {
+	inv, _, _ := newFleet(t, "")
+	host := inv.Hosts[0]
+	_, port, _ := strings.Cut(host.Address, ":")
+
+	check := remote.ConnHealthCheck(port, 10*time.Millisecond)
+	assert.NoError(t, check(context.Background(), host), "health check")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err, "net.Listen")
+	closed := lis.Addr().String()
+	lis.Close()
+	_, closedPort, _ := strings.Cut(closed, ":")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	check = remote.ConnHealthCheck(closedPort, 10*time.Millisecond)
+	err = check(ctx, host)
+	assert.ErrorContains(t, err, "WaitForConn: "+closed+": context deadline exceeded",
+		"health check")
+}
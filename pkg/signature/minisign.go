@@ -0,0 +1,109 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Minisign verifies minisign signatures (.minisig files).
+// https://jedisct1.github.io/minisign/
+type Minisign struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// The signature algorithms of minisign: legacy signs the data, prehashed signs the
+// BLAKE2b-512 of the data.
+const (
+	minisignLegacy    = "Ed"
+	minisignPrehashed = "ED"
+)
+
+// NewMinisign returns a verifier for publicKey, either the contents of the
+// minisign.pub file or only its last line (as in "minisign -P RWQ...").
+func NewMinisign(publicKey string) (*Minisign, error) {
+	lines := strings.Split(strings.TrimSpace(publicKey), "\n")
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("signature.NewMinisign: %s", err)
+	}
+	if len(buf) != 2+8+ed25519.PublicKeySize || string(buf[:2]) != minisignLegacy {
+		return nil, fmt.Errorf("signature.NewMinisign: not a minisign public key")
+	}
+	var v Minisign
+	copy(v.keyID[:], buf[2:10])
+	v.key = buf[10:]
+	return &v, nil
+}
+
+// Verify returns nil if sig, the contents of a .minisig file, is a valid signature
+// of data, including the global signature of the trusted comment.
+func (v *Minisign) Verify(data io.Reader, sig []byte) error {
+	errorf := func(format string, a ...any) error {
+		return fmt.Errorf("minisign: "+format, a...)
+	}
+
+	// untrusted comment, signature, trusted comment, global signature.
+	lines := strings.Split(strings.TrimSpace(string(sig)), "\n")
+	if len(lines) != 4 {
+		return errorf("invalid signature: want 4 lines, have %d", len(lines))
+	}
+	sigBuf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return errorf("decoding signature: %s", err)
+	}
+	if len(sigBuf) != 2+8+ed25519.SignatureSize {
+		return errorf("invalid signature size: %d", len(sigBuf))
+	}
+	algo, keyID, signature := string(sigBuf[:2]), sigBuf[2:10], sigBuf[10:]
+	if !bytes.Equal(keyID, v.keyID[:]) {
+		return errorf("signed by key %X, want key %X", reverse(keyID), reverse(v.keyID[:]))
+	}
+	trusted, found := strings.CutPrefix(strings.TrimRight(lines[2], "\r"),
+		"trusted comment: ")
+	if !found {
+		return errorf("invalid signature: missing trusted comment")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return errorf("decoding global signature: %s", err)
+	}
+
+	var msg []byte
+	switch algo {
+	case minisignLegacy:
+		msg, err = io.ReadAll(data)
+	case minisignPrehashed:
+		hasher, _ := blake2b.New512(nil) // Cannot fail without a key.
+		_, err = io.Copy(hasher, data)
+		msg = hasher.Sum(nil)
+	default:
+		return errorf("unknown signature algorithm %q", algo)
+	}
+	if err != nil {
+		return errorf("%s", err)
+	}
+	if !ed25519.Verify(v.key, msg, signature) {
+		return errorf("invalid signature")
+	}
+	if !ed25519.Verify(v.key, slices.Concat(signature, []byte(trusted)), globalSig) {
+		return errorf("invalid signature of the trusted comment")
+	}
+	return nil
+}
+
+// reverse returns the key ID as printed by minisign, which is little-endian.
+func reverse(keyID []byte) []byte {
+	out := make([]byte, len(keyID))
+	for i, b := range keyID {
+		out[len(keyID)-1-i] = b
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+// Package signature verifies the detached signatures that upstream projects publish
+// along with their artifacts: OpenPGP (HashiCorp, Go), minisign and plain ed25519.
+//
+// The verifiers implement [florist.Verifier], so that they can be used with
+// [florist.ChecksumFile] (to verify a signed checksum file, as published by
+// HashiCorp) and with [florist.NetFetchSigned] (to verify a signed artifact, as
+// published by Go).
+//
+// The public keys should be embedded in the provisioner (for example with
+// go:embed), so that they come from the same trusted source as the provisioner
+// itself, not from the same place as the artifacts.
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/marco-m/florist/pkg/florist"
+)
+
+var (
+	_ florist.Verifier = (*OpenPGP)(nil)
+	_ florist.Verifier = (*Minisign)(nil)
+	_ florist.Verifier = (*Ed25519)(nil)
+)
+
+// OpenPGP verifies OpenPGP detached signatures, binary (.sig) or ASCII-armored
+// (.asc).
+type OpenPGP struct {
+	keyring openpgp.EntityList
+}
+
+// NewOpenPGP returns a verifier accepting signatures made by any of armoredKeys,
+// each an ASCII-armored public key block, as exported by "gpg --armor --export".
+func NewOpenPGP(armoredKeys ...string) (*OpenPGP, error) {
+	if len(armoredKeys) == 0 {
+		return nil, fmt.Errorf("signature.NewOpenPGP: missing keys")
+	}
+	var keyring openpgp.EntityList
+	for i, armored := range armoredKeys {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+		if err != nil {
+			return nil, fmt.Errorf("signature.NewOpenPGP: key %d: %s", i, err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	return &OpenPGP{keyring: keyring}, nil
+}
+
+// Verify returns nil if sig is a valid signature of data by one of the keys.
+func (v *OpenPGP) Verify(data io.Reader, sig []byte) error {
+	check := openpgp.CheckDetachedSignature
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN PGP SIGNATURE-----")) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+	if _, err := check(v.keyring, data, bytes.NewReader(sig), nil); err != nil {
+		return fmt.Errorf("OpenPGP: %s", err)
+	}
+	return nil
+}
+
+// Ed25519 verifies plain ed25519 signatures, as made by package pull.
+type Ed25519 struct {
+	key ed25519.PublicKey
+}
+
+// NewEd25519 returns a verifier for the base64-encoded ed25519 public key.
+func NewEd25519(publicKey string) (*Ed25519, error) {
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("signature.NewEd25519: %s", err)
+	}
+	if len(buf) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("signature.NewEd25519: invalid size: %d", len(buf))
+	}
+	return &Ed25519{key: buf}, nil
+}
+
+// Verify returns nil if sig is a valid signature of data. The signature is either
+// raw or base64-encoded.
+func (v *Ed25519) Verify(data io.Reader, sig []byte) error {
+	if len(sig) != ed25519.SignatureSize {
+		raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return fmt.Errorf("ed25519: decoding signature: %s", err)
+		}
+		sig = raw
+	}
+	msg, err := io.ReadAll(data)
+	if err != nil {
+		return fmt.Errorf("ed25519: %s", err)
+	}
+	if !ed25519.Verify(v.key, msg, sig) {
+		return fmt.Errorf("ed25519: invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package signature_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/marco-m/rosina/assert"
+
+	"github.com/marco-m/florist/pkg/flowertest"
+	"github.com/marco-m/florist/pkg/signature"
+)
+
+// Made by the minisign tool, signing the file "test" containing "test".
+const (
+	minisignKey    = "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"
+	minisignLegacy = "untrusted comment: signature from minisign secret key\n" +
+		"RWQf6LRCGA9i59SLOFxz6NxvASXDJeRtuZykwQepbDEGt87ig1BNpWaVWuNrm73YiIiJbq71Wi+dP9eKL8OC351vwIasSSbXxwA=\n" +
+		"trusted comment: timestamp:1635442742\tfile:test\n" +
+		"0YteLgV960ia80vnA/fHbvkyjl/IoP/HNOCaZfrF0CdhAlp7ok+Tpkya+VpWPX5C/Is3q8a/kEDSY7fBmmgJCg==\n"
+	minisignPrehashed = "untrusted comment: signature from minisign secret key\n" +
+		"RUQf6LRCGA9i559r3g7V1qNyJDApGip8MfqcadIgT9CuhV3EMhHoN1mGTkUidF/z7SrlQgXdy8ofjb7bNJJylDOocrCo8KLzZwo=\n" +
+		"trusted comment: timestamp:1635443258\tfile:test\thashed\n" +
+		"/cj37GK60vryibFn+ftOgbCvW9NKhKYgjVpFFQUcWPAnjO23wrvVDTt7cloNC06maoBli9q6qwZDXXoaxweICQ==\n"
+)
+
+func TestMinisign(t *testing.T) {
+	type testCase struct {
+		name    string
+		key     string
+		data    string
+		sig     string
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		verifier, err := signature.NewMinisign(tc.key)
+		assert.NoError(t, err, "signature.NewMinisign")
+
+		err = verifier.Verify(strings.NewReader(tc.data), []byte(tc.sig))
+
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr, "verifier.Verify")
+			return
+		}
+		assert.NoError(t, err, "verifier.Verify")
+	}
+
+	testCases := []testCase{
+		{
+			name: "legacy",
+			key:  minisignKey,
+			data: "test",
+			sig:  minisignLegacy,
+		},
+		{
+			name: "prehashed, key from minisign.pub",
+			key:  "untrusted comment: minisign public key E7620F1842B4E81F\n" + minisignKey + "\n",
+			data: "test",
+			sig:  minisignPrehashed,
+		},
+		{
+			name:    "tampered data",
+			key:     minisignKey,
+			data:    "TEST",
+			sig:     minisignPrehashed,
+			wantErr: "minisign: invalid signature",
+		},
+		{
+			name:    "tampered trusted comment",
+			key:     minisignKey,
+			data:    "test",
+			sig:     strings.Replace(minisignLegacy, "file:test", "file:evil", 1),
+			wantErr: "minisign: invalid signature of the trusted comment",
+		},
+		{
+			name:    "other key",
+			key:     "RWQAAAAAAAAAAHmlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3",
+			data:    "test",
+			sig:     minisignLegacy,
+			wantErr: "minisign: signed by key E7620F1842B4E81F, want key 0000000000000000",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestNewMinisignFailure(t *testing.T) {
+	_, err := signature.NewMinisign(base64.StdEncoding.EncodeToString([]byte("banana")))
+
+	assert.ErrorContains(t, err, "signature.NewMinisign: not a minisign public key",
+		"signature.NewMinisign")
+}
+
+func TestOpenPGP(t *testing.T) {
+	signer, armoredKey := flowertest.NewOpenPGPKey(t)
+	_, otherKey := flowertest.NewOpenPGPKey(t)
+	data := "banana  banana_1.0_linux_amd64.zip\n"
+
+	var binarySig, armoredSig bytes.Buffer
+	err := openpgp.DetachSign(&binarySig, signer, strings.NewReader(data), nil)
+	assert.NoError(t, err, "openpgp.DetachSign")
+	err = openpgp.ArmoredDetachSign(&armoredSig, signer, strings.NewReader(data), nil)
+	assert.NoError(t, err, "openpgp.ArmoredDetachSign")
+
+	type testCase struct {
+		name    string
+		keys    []string
+		data    string
+		sig     []byte
+		wantErr string
+	}
+
+	test := func(t *testing.T, tc testCase) {
+		verifier, err := signature.NewOpenPGP(tc.keys...)
+		assert.NoError(t, err, "signature.NewOpenPGP")
+
+		err = verifier.Verify(strings.NewReader(tc.data), tc.sig)
+
+		if tc.wantErr != "" {
+			assert.ErrorContains(t, err, tc.wantErr, "verifier.Verify")
+			return
+		}
+		assert.NoError(t, err, "verifier.Verify")
+	}
+
+	testCases := []testCase{
+		{
+			name: "binary signature",
+			keys: []string{armoredKey},
+			data: data,
+			sig:  binarySig.Bytes(),
+		},
+		{
+			name: "armored signature, key among others",
+			keys: []string{otherKey, armoredKey},
+			data: data,
+			sig:  armoredSig.Bytes(),
+		},
+		{
+			name:    "tampered data",
+			keys:    []string{armoredKey},
+			data:    strings.ToUpper(data),
+			sig:     binarySig.Bytes(),
+			wantErr: "OpenPGP: openpgp: invalid signature",
+		},
+		{
+			name:    "other key",
+			keys:    []string{otherKey},
+			data:    data,
+			sig:     armoredSig.Bytes(),
+			wantErr: "OpenPGP: openpgp: signature made by unknown entity",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc) })
+	}
+}
+
+func TestNewOpenPGPFailure(t *testing.T) {
+	_, err := signature.NewOpenPGP("banana")
+
+	assert.ErrorContains(t, err, "signature.NewOpenPGP: key 0: ", "signature.NewOpenPGP")
+}
+
+func TestEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "ed25519.GenerateKey")
+	verifier, err := signature.NewEd25519(base64.StdEncoding.EncodeToString(pub))
+	assert.NoError(t, err, "signature.NewEd25519")
+	sig := ed25519.Sign(priv, []byte("banana"))
+
+	err = verifier.Verify(strings.NewReader("banana"), sig)
+	assert.NoError(t, err, "verifier.Verify raw")
+
+	err = verifier.Verify(strings.NewReader("banana"),
+		[]byte(base64.StdEncoding.EncodeToString(sig)+"\n"))
+	assert.NoError(t, err, "verifier.Verify base64")
+
+	err = verifier.Verify(strings.NewReader("cherry"), sig)
+	assert.ErrorContains(t, err, "ed25519: invalid signature", "verifier.Verify")
+}
@@ -7,7 +7,6 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
-	"strconv"
 	"strings"
 
 	"github.com/marco-m/florist/pkg/florist"
@@ -41,7 +40,7 @@ func AddAuthorizedKeys(username string, fsys fs.FS) error {
 
 	// If $HOME/.ssh doesn't exist, create it, correct owner and permissions.
 	sshDir := filepath.Join(theUser.HomeDir, ".ssh")
-	if err := os.MkdirAll(sshDir, 0o700); err != nil {
+	if err := florist.MkdirAll(sshDir, 0o700); err != nil {
 		return fmt.Errorf("AddAuthorizedKeys: %s", err)
 	}
 	if err := florist.Chown(sshDir, username); err != nil {
@@ -49,14 +48,12 @@ func AddAuthorizedKeys(username string, fsys fs.FS) error {
 	}
 
 	authorizedKeysPath := filepath.Join(sshDir, "authorized_keys")
-	fi, err := os.OpenFile(authorizedKeysPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	fi, err := florist.OpenFile(authorizedKeysPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
 	if err != nil {
 		return fmt.Errorf("AddAuthorizedKeys: %s", err)
 	}
 	defer fi.Close()
-	uid, _ := strconv.Atoi(theUser.Uid)
-	gid, _ := strconv.Atoi(theUser.Gid)
-	if err := os.Chown(authorizedKeysPath, uid, gid); err != nil {
+	if err := florist.Chown(authorizedKeysPath, username); err != nil {
 		return fmt.Errorf("AddAuthorizedKeys: %s", err)
 	}
 
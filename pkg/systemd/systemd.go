@@ -8,6 +8,32 @@ import (
 	"github.com/marco-m/florist/pkg/florist"
 )
 
+// UnitDir is the directory of the unit files installed by the system administrator.
+const UnitDir = "/etc/systemd/system"
+
+// DaemonReload executes "systemctl daemon-reload", needed after adding or changing
+// a unit file.
+func DaemonReload() error {
+	log := slog.With("pkg", "systemd")
+
+	cmd := exec.Command("systemctl", "daemon-reload")
+	if err := florist.CmdRun(log, cmd); err != nil {
+		return fmt.Errorf("florist.systemd: daemon-reload: %s", err)
+	}
+	return nil
+}
+
+// EnableNow executes "systemctl enable --now unit": enable and start.
+func EnableNow(unit string) error {
+	log := slog.With("pkg", "systemd").With("unit", unit)
+
+	cmd := exec.Command("systemctl", "enable", "--now", unit)
+	if err := florist.CmdRun(log, cmd); err != nil {
+		return fmt.Errorf("florist.systemd: enable --now: %s", err)
+	}
+	return nil
+}
+
 func Enable(unit string) error {
 	log := slog.With("pkg", "systemd").With("unit", unit)
 